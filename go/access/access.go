@@ -0,0 +1,118 @@
+package access
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RoleAdmin sees and manages the whole tenant. Account owners, who
+	// aren't linked to anyone else's tenant, are always admins.
+	RoleAdmin = "admin"
+	// RoleManager is limited to the employees reporting to them, directly
+	// or through other supervisors.
+	RoleManager = "manager"
+)
+
+// Middleware resolves the caller's tenant and role. It runs after
+// middleware.AuthMiddleware and rewrites userSub to the tenant a linked user
+// belongs to, so handlers keep scoping by userSub. The authenticated
+// subject stays available as callerSub.
+func Middleware(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !resolve(db, c) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminOnly is Middleware for routes managers may not use.
+func AdminOnly(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !resolve(db, c) {
+			c.Abort()
+			return
+		}
+		if c.GetString("role") != RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action requires an admin"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func resolve(db *sql.DB, c *gin.Context) bool {
+	callerSub := c.GetString("userSub")
+	if callerSub == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: userSub not found"})
+		return false
+	}
+
+	var tenant, role string
+	var employeeID sql.NullInt64
+	err := db.QueryRow(`
+        SELECT tenant, role, employeeId
+        FROM tenantUsers
+        WHERE userSub = ? and deleted IS NULL and accepted IS NOT NULL
+    `, callerSub).Scan(&tenant, &role, &employeeID)
+	switch {
+	case err == sql.ErrNoRows:
+		tenant, role = callerSub, RoleAdmin
+	case err != nil:
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve access"})
+		return false
+	}
+
+	c.Set("userSub", tenant)
+	c.Set("callerSub", callerSub)
+	c.Set("role", role)
+	if employeeID.Valid {
+		c.Set("employeeId", employeeID.Int64)
+	}
+	return true
+}
+
+// IsManager reports whether the caller's view is limited to their reports.
+func IsManager(c *gin.Context) bool {
+	return c.GetString("role") == RoleManager
+}
+
+// Scope returns a condition limiting column, an employee id, to the
+// caller's reporting subtree. It is empty for admins. A manager who isn't
+// linked to an employee record sees no one.
+func Scope(c *gin.Context, column string) (string, []interface{}) {
+	if !IsManager(c) {
+		return "", nil
+	}
+
+	employeeID, ok := c.Get("employeeId")
+	if !ok {
+		return " and 1 = 0", nil
+	}
+
+	return fmt.Sprintf(` and %s in (
+        WITH RECURSIVE reports AS (
+            SELECT id FROM employees WHERE supervisorId = ? and createdBy = ? and deleted IS NULL
+            UNION
+            SELECT r.id FROM employees r JOIN reports on r.supervisorId = reports.id WHERE r.deleted IS NULL
+        ) SELECT id FROM reports)`, column), []interface{}{employeeID, c.GetString("userSub")}
+}
+
+// Allows reports whether the caller may see and manage an employee.
+func Allows(db *sql.DB, c *gin.Context, employeeID interface{}) (bool, error) {
+	if !IsManager(c) {
+		return true, nil
+	}
+
+	scope, args := Scope(c, "?")
+	var allowed bool
+	err := db.QueryRow("SELECT 1 = 1"+scope, append([]interface{}{employeeID}, args...)...).Scan(&allowed)
+	return allowed, err
+}
@@ -0,0 +1,465 @@
+package access
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// User links another login to this tenant. UserSub is the subject of that
+// login's token; EmployeeID is the employee record a manager's subtree
+// hangs from. The link is an invitation until that login accepts it.
+type User struct {
+	ID         int     `json:"id"`
+	UserSub    string  `json:"userSub" validate:"required,max=255"`
+	Role       string  `json:"role" validate:"required,oneof=admin manager"`
+	EmployeeID *int    `json:"employeeId" validate:"omitempty,gt=0"`
+	Created    string  `json:"created"`
+	Accepted   *string `json:"accepted"`
+}
+
+// Invitation is a pending link as seen by the invited login.
+type Invitation struct {
+	ID      int    `json:"id"`
+	Tenant  string `json:"tenant"`
+	Role    string `json:"role"`
+	Created string `json:"created"`
+}
+
+// ownedTables are the tables whose createdBy marks the tenant a row belongs
+// to.
+var ownedTables = []string{
+	"employees", "licenses", "employeeLicenses", "orgUnits", "customFields",
+	"tags", "employeeGroups", "hrisConnections", "scimTokens", "onboardingTemplates",
+	"credentialRequirements", "notes", "ceActivities", "events",
+}
+
+// ownsData reports whether a login has an account of its own: data it
+// created or logins it has linked. Linking it to another tenant would hide
+// all of that.
+func ownsData(db utils.DB, userSub string) (bool, error) {
+	checks := []string{"SELECT 1 FROM tenantUsers WHERE tenant = ? and deleted IS NULL"}
+	args := []interface{}{userSub}
+	for _, table := range ownedTables {
+		checks = append(checks, fmt.Sprintf("SELECT 1 FROM %s WHERE createdBy = ?", table))
+		args = append(args, userSub)
+	}
+
+	var owns bool
+	err := db.QueryRow("SELECT EXISTS ("+strings.Join(checks, " UNION ALL ")+")", args...).Scan(&owns)
+	return owns, err
+}
+
+func (user *User) Normalize() {
+	user.UserSub = strings.TrimSpace(user.UserSub)
+}
+
+func (user *User) Check() validation.FieldErrors {
+	if user.Role == RoleManager && user.EmployeeID == nil {
+		return validation.FieldErrors{"employeeId": "is required for managers"}
+	}
+	return nil
+}
+
+// GetMe returns the caller's role so the UI can hide what they can't use.
+func GetMe(c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	me := gin.H{"tenant": userSubStr, "userSub": c.GetString("callerSub"), "role": c.GetString("role"), "employeeId": nil}
+	if employeeID, ok := c.Get("employeeId"); ok {
+		me["employeeId"] = employeeID
+	}
+
+	c.JSON(http.StatusOK, me)
+}
+
+func GetUsers(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, userSub, role, employeeId, created, accepted
+        FROM tenantUsers
+        WHERE tenant = ? and deleted IS NULL
+        ORDER BY created
+    `, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.UserSub, &user.Role, &user.EmployeeID, &user.Created, &user.Accepted); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan user data"})
+			return
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, users)
+}
+
+// checkUser makes sure a link points at one of the tenant's employees and
+// that the login isn't already linked elsewhere or running its own account.
+// It writes the error response itself.
+func checkUser(db *sql.DB, c *gin.Context, user User, userSub string, exceptID string) bool {
+	if user.UserSub == userSub || user.UserSub == c.GetString("callerSub") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{"userSub": "can't link your own login"}})
+		return false
+	}
+
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM tenantUsers
+        WHERE userSub = ? and deleted IS NULL and id <> ? and (accepted IS NOT NULL or tenant = ?)
+    `, user.UserSub, exceptID, userSub).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user"})
+		return false
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This login is already linked to an account"})
+		return false
+	}
+
+	owns, err := ownsData(db, user.UserSub)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user"})
+		return false
+	}
+	if owns {
+		c.JSON(http.StatusConflict, gin.H{"error": "This login already has its own account"})
+		return false
+	}
+
+	if user.EmployeeID == nil {
+		return true
+	}
+
+	err = db.QueryRow(`
+        SELECT COUNT(*) FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, *user.EmployeeID, userSub).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{"employeeId": "does not exist"}})
+		return false
+	}
+
+	return true
+}
+
+func PostUser(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var user User
+	if !validation.Bind(c, &user) {
+		return
+	}
+
+	if !checkUser(db, c, user, userSubStr, "0") {
+		return
+	}
+
+	result, err := db.Exec(`
+        INSERT INTO tenantUsers (tenant, userSub, role, employeeId)
+        VALUES (?, ?, ?, ?)
+    `, userSubStr, user.UserSub, user.Role, user.EmployeeID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert user"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted user ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User invited successfully", "id": id})
+}
+
+func PutUser(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var user User
+	if !validation.Bind(c, &user) {
+		return
+	}
+
+	if !checkUser(db, c, user, userSubStr, id) {
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE tenantUsers
+        SET accepted = IF(userSub = ?, accepted, NULL), userSub = ?, role = ?, employeeId = ?
+        WHERE id = ? and tenant = ? and deleted IS NULL
+    `, user.UserSub, user.UserSub, user.Role, user.EmployeeID, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM tenantUsers WHERE id = ? and tenant = ? and deleted IS NULL`, id, userSubStr).Scan(&count); err != nil || count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+}
+
+// DeleteUser unlinks a login. The next request it makes is treated as its
+// own, empty account.
+func DeleteUser(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE tenantUsers
+        SET deleted = current_timestamp()
+        WHERE id = ? and tenant = ? and deleted IS NULL
+    `, c.Param("id"), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink user"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlinked successfully"})
+}
+
+// GetInvitations lists the links waiting for the caller's login to accept
+// them. Its routes skip access.Middleware, so userSub is the login itself.
+func GetInvitations(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, tenant, role, created
+        FROM tenantUsers
+        WHERE userSub = ? and deleted IS NULL and accepted IS NULL
+        ORDER BY created
+    `, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query invitations"})
+		return
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		if err := rows.Scan(&invitation.ID, &invitation.Tenant, &invitation.Role, &invitation.Created); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan invitation data"})
+			return
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, invitations)
+}
+
+// AcceptInvitation moves the caller's login into the inviting tenant and
+// withdraws any other invitations it had.
+func AcceptInvitation(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+        SELECT id FROM tenantUsers
+        WHERE id = ? and userSub = ? and deleted IS NULL and accepted IS NULL
+        FOR UPDATE
+    `, c.Param("id"), userSubStr).Scan(&id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invitation"})
+		return
+	}
+
+	var count int
+	err = tx.QueryRow(`
+        SELECT COUNT(*) FROM tenantUsers
+        WHERE userSub = ? and deleted IS NULL and accepted IS NOT NULL
+    `, userSubStr).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This login is already linked to an account"})
+		return
+	}
+
+	owns, err := ownsData(tx, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	if owns {
+		c.JSON(http.StatusConflict, gin.H{"error": "This login already has its own account"})
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE tenantUsers SET accepted = current_timestamp() WHERE id = ?`, id); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	_, err = tx.Exec(`
+        UPDATE tenantUsers
+        SET deleted = current_timestamp()
+        WHERE userSub = ? and id <> ? and deleted IS NULL and accepted IS NULL
+    `, userSubStr, id)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation accepted successfully"})
+}
+
+func DeclineInvitation(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE tenantUsers
+        SET deleted = current_timestamp()
+        WHERE id = ? and userSub = ? and deleted IS NULL and accepted IS NULL
+    `, c.Param("id"), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline invitation"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation declined successfully"})
+}
@@ -0,0 +1,263 @@
+package catalog
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/benfortenberry/accredi-track/licenses"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// catalog.json is the built-in list of common credentials. Bump its version
+// whenever an entry changes so imported license types show which edition
+// they came from.
+//
+//go:embed catalog.json
+var data []byte
+
+// Catalog is the bundled set of credential definitions tenants can import
+// as license types.
+type Catalog struct {
+	Version    int      `json:"version"`
+	Industries []string `json:"industries"`
+	Entries    []Entry  `json:"entries"`
+}
+
+// Entry is one credential in the catalog. Key stays the same across
+// catalog versions.
+type Entry struct {
+	Key              string   `json:"key"`
+	Name             string   `json:"name"`
+	Industries       []string `json:"industries"`
+	Category         string   `json:"category"`
+	IssuingAuthority string   `json:"issuingAuthority"`
+	Description      string   `json:"description"`
+	ValidityMonths   *int     `json:"validityMonths"`
+	Critical         bool     `json:"critical"`
+	// ImportedAs is the tenant's license type imported from the entry, if
+	// any.
+	ImportedAs *int `json:"importedAs"`
+}
+
+var (
+	loadOnce sync.Once
+	loaded   Catalog
+	loadErr  error
+)
+
+// Load returns the built-in catalog.
+func Load() (Catalog, error) {
+	loadOnce.Do(func() {
+		loadErr = json.Unmarshal(data, &loaded)
+	})
+	return loaded, loadErr
+}
+
+// license is the license type an import of the entry creates.
+func (entry Entry) license(version int) licenses.License {
+	key := entry.Key
+	return licenses.License{
+		Name:             entry.Name,
+		IssuingAuthority: entry.IssuingAuthority,
+		Category:         entry.Category,
+		Description:      entry.Description,
+		ValidityMonths:   entry.ValidityMonths,
+		Critical:         entry.Critical,
+		CatalogKey:       &key,
+		CatalogVersion:   &version,
+	}
+}
+
+// imported maps catalog keys to the tenant's live license types imported
+// from them.
+func imported(db *sql.DB, userSub string) (map[string]int, error) {
+	rows, err := db.Query(`
+        SELECT catalogKey, MIN(id) FROM licenses
+        WHERE createdBy = ? and deleted IS NULL and catalogKey IS NOT NULL
+        GROUP BY catalogKey
+    `, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]int{}
+	for rows.Next() {
+		var key string
+		var id int
+		if err := rows.Scan(&key, &id); err != nil {
+			return nil, err
+		}
+		ids[key] = id
+	}
+	return ids, rows.Err()
+}
+
+// Get lists the catalog, narrowed by ?industry, ?category and ?q, a search
+// of entry names, and marks the entries the tenant has already imported.
+func Get(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	cat, err := Load()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load credential catalog"})
+		return
+	}
+
+	industry := c.Query("industry")
+	if industry != "" && !contains(cat.Industries, industry) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "industry must be one of: " + strings.Join(cat.Industries, ", ")})
+		return
+	}
+	category := c.Query("category")
+	search := strings.ToLower(strings.TrimSpace(c.Query("q")))
+
+	ids, err := imported(db, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query licenses"})
+		return
+	}
+
+	entries := []Entry{}
+	for _, entry := range cat.Entries {
+		if industry != "" && !contains(entry.Industries, industry) {
+			continue
+		}
+		if category != "" && entry.Category != category {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(entry.Name), search) {
+			continue
+		}
+		if id, ok := ids[entry.Key]; ok {
+			entry.ImportedAs = &id
+		}
+		entries = append(entries, entry)
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"version":    cat.Version,
+		"industries": cat.Industries,
+		"entries":    entries,
+	})
+}
+
+// ImportRequest picks catalog entries to import by key.
+type ImportRequest struct {
+	Keys []string `json:"keys" validate:"required,min=1,max=100,dive,required"`
+}
+
+func (req *ImportRequest) Normalize() {
+	for i, key := range req.Keys {
+		req.Keys[i] = strings.TrimSpace(key)
+	}
+}
+
+// Imported pairs a catalog key with the license type it maps to.
+type Imported struct {
+	Key       string `json:"key"`
+	LicenseID int    `json:"licenseId"`
+}
+
+// PostImport creates license types from catalog entries. Entries the tenant
+// already imported are skipped and reported with their existing license
+// type.
+func PostImport(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var req ImportRequest
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	cat, err := Load()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load credential catalog"})
+		return
+	}
+
+	byKey := map[string]Entry{}
+	for _, entry := range cat.Entries {
+		byKey[entry.Key] = entry
+	}
+
+	fields := validation.FieldErrors{}
+	for i, key := range req.Keys {
+		if _, ok := byKey[key]; !ok {
+			fields[fmt.Sprintf("keys[%d]", i)] = "is not in the catalog"
+		}
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return
+	}
+
+	ids, err := imported(db, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query licenses"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import catalog entries"})
+		return
+	}
+	defer tx.Rollback()
+
+	created, skipped := []Imported{}, []Imported{}
+	for _, key := range req.Keys {
+		if id, ok := ids[key]; ok {
+			skipped = append(skipped, Imported{key, id})
+			continue
+		}
+
+		id, err := licenses.Insert(tx, byKey[key].license(cat.Version), userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import catalog entries"})
+			return
+		}
+		ids[key] = int(id)
+		created = append(created, Imported{key, int(id)})
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import catalog entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": cat.Version, "imported": created, "skipped": skipped})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,263 @@
+package ce
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Activity is a course, conference or other CE an employee completed.
+type Activity struct {
+	ID            int     `json:"id"`
+	EmployeeID    int     `json:"employeeId"`
+	Title         string  `json:"title" validate:"required,max=200"`
+	Provider      string  `json:"provider" validate:"max=200"`
+	CompletedDate string  `json:"completedDate" validate:"required,datetime=2006-01-02"`
+	Hours         float64 `json:"hours" validate:"gt=0,lte=1000"`
+	Category      string  `json:"category" validate:"max=100"`
+}
+
+func (a *Activity) Normalize() {
+	a.Title = strings.TrimSpace(a.Title)
+	a.Provider = strings.TrimSpace(a.Provider)
+	a.CompletedDate = validation.NormalizeDate(a.CompletedDate)
+	a.Category = strings.TrimSpace(a.Category)
+}
+
+func (a *Activity) Check() validation.FieldErrors {
+	completed, err := validation.ParseDate(a.CompletedDate)
+	if err == nil && completed.After(time.Now()) {
+		return validation.FieldErrors{"completedDate": "can't be in the future"}
+	}
+	return nil
+}
+
+// allowEmployee checks that the caller can see the employee and that they
+// haven't been offboarded. It writes the error response itself.
+func allowEmployee(db *sql.DB, c *gin.Context, employeeID interface{}, userSub string) bool {
+	allowed, err := access.Allows(db, c, employeeID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return false
+	}
+
+	var offboarded bool
+	err = db.QueryRow(`
+        SELECT offboarded IS NOT NULL FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, employeeID, userSub).Scan(&offboarded)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return false
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return false
+	}
+	if offboarded && c.Request.Method != http.MethodGet {
+		c.JSON(http.StatusConflict, gin.H{"error": "Employee has been offboarded; their records are read-only"})
+		return false
+	}
+	return true
+}
+
+// allowActivity loads the employee an activity belongs to and checks it
+// like allowEmployee.
+func allowActivity(db *sql.DB, c *gin.Context, id string, userSub string) bool {
+	var employeeID int
+	err := db.QueryRow(`
+        SELECT employeeId FROM ceActivities
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSub).Scan(&employeeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CE activity not found"})
+		return false
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve CE activity"})
+		return false
+	}
+	return allowEmployee(db, c, employeeID, userSub)
+}
+
+func loadActivity(db *sql.DB, id interface{}, userSub string) (Activity, error) {
+	var a Activity
+	err := db.QueryRow(`
+        SELECT id, employeeId, title, provider, completedDate, hours, category
+        FROM ceActivities
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSub).Scan(&a.ID, &a.EmployeeID, &a.Title, &a.Provider, &a.CompletedDate, &a.Hours, &a.Category)
+	return a, err
+}
+
+// GetActivities lists an employee's CE activities, most recent first.
+func GetActivities(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+	if !allowEmployee(db, c, id, userSubStr) {
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, employeeId, title, provider, completedDate, hours, category
+        FROM ceActivities
+        WHERE employeeId = ? and deleted IS NULL and createdBy = ?
+        ORDER BY completedDate DESC, id DESC
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query CE activities"})
+		return
+	}
+	defer rows.Close()
+
+	activities := []Activity{}
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.ID, &a.EmployeeID, &a.Title, &a.Provider, &a.CompletedDate, &a.Hours, &a.Category); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan CE activity data"})
+			return
+		}
+		activities = append(activities, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, activities)
+}
+
+func PostActivity(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	employeeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var a Activity
+	if !validation.Bind(c, &a) {
+		return
+	}
+
+	if !allowEmployee(db, c, employeeID, userSubStr) {
+		return
+	}
+
+	result, err := db.Exec(`
+        INSERT INTO ceActivities (employeeId, title, provider, completedDate, hours, category, createdBy)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+    `, employeeID, a.Title, a.Provider, a.CompletedDate, a.Hours, a.Category, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert CE activity"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted CE activity ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "CE activity inserted successfully", "id": id})
+}
+
+func PutActivity(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var a Activity
+	if !validation.Bind(c, &a) {
+		return
+	}
+
+	if !allowActivity(db, c, id, userSubStr) {
+		return
+	}
+
+	_, err := db.Exec(`
+        UPDATE ceActivities
+        SET title = ?, provider = ?, completedDate = ?, hours = ?, category = ?
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, a.Title, a.Provider, a.CompletedDate, a.Hours, a.Category, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update CE activity"})
+		return
+	}
+
+	updated, err := loadActivity(db, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated CE activity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func DeleteActivity(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+	if !allowActivity(db, c, id, userSubStr) {
+		return
+	}
+
+	_, err := db.Exec(`
+        UPDATE ceActivities
+        SET deleted = current_timestamp()
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete CE activity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "CE activity deleted successfully"})
+}
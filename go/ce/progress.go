@@ -0,0 +1,340 @@
+package ce
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/mailer"
+	"github.com/benfortenberry/accredi-track/notifications"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// alertInterval is how often StartAlertJob looks for people behind pace.
+const alertInterval = 24 * time.Hour
+
+// alertKind is the notification kind for behind-pace alerts. Each employee
+// license is alerted at most once per realertDays.
+const (
+	alertKind   = "ceBehindPace"
+	realertDays = 30
+)
+
+// Progress is how far an employee is with the CE one of their licenses
+// needs before it expires. ExpectedHours is what they would have earned by
+// now at an even pace through the cycle.
+type Progress struct {
+	EmployeeLicenseID int                `json:"employeeLicenseId"`
+	EmployeeID        int                `json:"employeeId"`
+	FirstName         string             `json:"firstName"`
+	LastName          string             `json:"lastName"`
+	LicenseID         int                `json:"licenseId"`
+	LicenseName       string             `json:"licenseName"`
+	LicenseVersion    int                `json:"licenseVersion"`
+	IssueDate         string             `json:"issueDate"`
+	ExpDate           string             `json:"expDate"`
+	DaysLeft          int                `json:"daysLeft"`
+	RequiredHours     float64            `json:"requiredHours"`
+	EarnedHours       float64            `json:"earnedHours"`
+	ExpectedHours     float64            `json:"expectedHours"`
+	RemainingHours    float64            `json:"remainingHours"`
+	Categories        []CategoryProgress `json:"categories"`
+	Complete          bool               `json:"complete"`
+	BehindPace        bool               `json:"behindPace"`
+
+	email string
+}
+
+// CategoryProgress tracks one category minimum of a requirement.
+type CategoryProgress struct {
+	Category      string  `json:"category"`
+	RequiredHours float64 `json:"requiredHours"`
+	EarnedHours   float64 `json:"earnedHours"`
+}
+
+// Find works out CE progress for the current cycle of every unexpired
+// employee license issued under a license type version with a CE
+// requirement. scope is a condition on
+// el.employeeId selecting the employees to include. Activities count
+// towards a cycle when they were completed between its issue and expiration
+// dates.
+func Find(db *sql.DB, userSub string, scope string, scopeArgs []interface{}) ([]Progress, error) {
+	args := append([]interface{}{userSub}, scopeArgs...)
+	from := `
+        FROM employeeLicenses el
+        JOIN employees e on el.employeeId = e.id and e.deleted IS NULL and e.offboarded IS NULL
+        JOIN licenses l on el.licenseId = l.id and l.deleted IS NULL
+        JOIN licenseVersions v on el.licenseVersionId = v.id and v.ceRequirement IS NOT NULL`
+	where := `
+        WHERE el.createdBy = ? and el.deleted IS NULL and el.expDate >= CURDATE()` + scope
+
+	rows, err := db.Query(`
+        SELECT el.id, el.employeeId, e.firstName, e.lastName, e.email, el.licenseId, l.name, v.version,
+            el.issueDate, el.expDate, v.ceRequirement,
+            DATEDIFF(el.expDate, el.issueDate), DATEDIFF(CURDATE(), el.issueDate), DATEDIFF(el.expDate, CURDATE())
+        `+from+where+`
+        ORDER BY el.expDate, el.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var progress []Progress
+	requirements := map[int]Requirement{}
+	elapsed := map[int]float64{}
+	for rows.Next() {
+		var p Progress
+		var requirement string
+		var cycleDays, daysIn int
+		if err := rows.Scan(
+			&p.EmployeeLicenseID, &p.EmployeeID, &p.FirstName, &p.LastName, &p.email, &p.LicenseID, &p.LicenseName, &p.LicenseVersion,
+			&p.IssueDate, &p.ExpDate, &requirement, &cycleDays, &daysIn, &p.DaysLeft,
+		); err != nil {
+			return nil, err
+		}
+
+		var req Requirement
+		if err := json.Unmarshal([]byte(requirement), &req); err != nil {
+			return nil, err
+		}
+		requirements[p.EmployeeLicenseID] = req
+
+		fraction := 1.0
+		if cycleDays > 0 {
+			fraction = math.Min(math.Max(float64(daysIn)/float64(cycleDays), 0), 1)
+		}
+		elapsed[p.EmployeeLicenseID] = fraction
+		progress = append(progress, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	earned := map[int]map[string]float64{}
+	hourRows, err := db.Query(`
+        SELECT el.id, a.category, SUM(a.hours)
+        `+from+`
+        JOIN ceActivities a on a.employeeId = el.employeeId and a.deleted IS NULL
+            and a.completedDate BETWEEN el.issueDate AND el.expDate`+where+`
+        GROUP BY el.id, a.category`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer hourRows.Close()
+	for hourRows.Next() {
+		var id int
+		var category string
+		var hours float64
+		if err := hourRows.Scan(&id, &category, &hours); err != nil {
+			return nil, err
+		}
+		if earned[id] == nil {
+			earned[id] = map[string]float64{}
+		}
+		earned[id][category] = hours
+	}
+	if err := hourRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range progress {
+		measure(&progress[i], requirements[progress[i].EmployeeLicenseID], earned[progress[i].EmployeeLicenseID], elapsed[progress[i].EmployeeLicenseID])
+	}
+	if progress == nil {
+		progress = []Progress{}
+	}
+	return progress, nil
+}
+
+// measure compares the hours earned by category against a requirement,
+// fraction of the way through the cycle.
+func measure(p *Progress, req Requirement, earned map[string]float64, fraction float64) {
+	for _, hours := range earned {
+		p.EarnedHours += hours
+	}
+	p.EarnedHours = round(p.EarnedHours)
+	p.RequiredHours = req.Hours
+	p.ExpectedHours = round(req.Hours * fraction)
+	p.RemainingHours = round(math.Max(req.Hours-p.EarnedHours, 0))
+
+	p.Complete = p.EarnedHours >= req.Hours
+	p.BehindPace = p.EarnedHours < p.ExpectedHours
+
+	p.Categories = []CategoryProgress{}
+	for category, hours := range req.Categories {
+		cat := CategoryProgress{Category: category, RequiredHours: hours, EarnedHours: round(earned[category])}
+		if cat.EarnedHours < hours {
+			p.Complete = false
+			if cat.EarnedHours < round(hours*fraction) {
+				p.BehindPace = true
+			}
+		}
+		p.Categories = append(p.Categories, cat)
+	}
+	sort.Slice(p.Categories, func(i, j int) bool { return p.Categories[i].Category < p.Categories[j].Category })
+
+	if p.Complete {
+		p.BehindPace = false
+	}
+}
+
+func round(hours float64) float64 {
+	return math.Round(hours*100) / 100
+}
+
+// GetEmployeeProgress returns an employee's CE progress for each license
+// that needs it.
+func GetEmployeeProgress(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+	if !allowEmployee(db, c, id, userSubStr) {
+		return
+	}
+
+	progress, err := Find(db, userSubStr, " and el.employeeId = ?", []interface{}{id})
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute CE progress"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, progress)
+}
+
+// GetProgress lists CE progress across the employees the caller can see.
+// ?behind=true keeps only those behind pace.
+func GetProgress(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	scope, scopeArgs := access.Scope(c, "el.employeeId")
+	progress, err := Find(db, userSubStr, scope, scopeArgs)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute CE progress"})
+		return
+	}
+
+	if c.Query("behind") == "true" {
+		behind := []Progress{}
+		for _, p := range progress {
+			if p.BehindPace {
+				behind = append(behind, p)
+			}
+		}
+		progress = behind
+	}
+
+	c.IndentedJSON(http.StatusOK, progress)
+}
+
+// Alert records a notification, and emails the employee, for each license
+// of the tenant's employees that is behind pace and hasn't been alerted
+// about recently.
+func Alert(db *sql.DB, userSub string) error {
+	progress, err := Find(db, userSub, "", nil)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range progress {
+		if !p.BehindPace {
+			continue
+		}
+
+		var recent int
+		err := db.QueryRow(`
+            SELECT COUNT(*) FROM notifications
+            WHERE userSub = ? and kind = ? and employeeLicenseId = ?
+              and created > DATE_SUB(NOW(), INTERVAL ? DAY)
+        `, userSub, alertKind, p.EmployeeLicenseID, realertDays).Scan(&recent)
+		if err != nil {
+			return err
+		}
+		if recent > 0 {
+			continue
+		}
+
+		message := fmt.Sprintf("%s %s has %.2f of %.2f CE hours for %s, which expires %s; %.2f would be on pace.",
+			p.FirstName, p.LastName, p.EarnedHours, p.RequiredHours, p.LicenseName, p.ExpDate, p.ExpectedHours)
+		employeeID, employeeLicenseID := p.EmployeeID, p.EmployeeLicenseID
+		err = notifications.Record(db, userSub, notifications.Notification{
+			EmployeeID:        &employeeID,
+			EmployeeLicenseID: &employeeLicenseID,
+			Kind:              alertKind,
+			Recipient:         p.email,
+			Message:           message,
+		})
+		if err != nil {
+			return err
+		}
+
+		if p.email != "" {
+			if err := mailer.Send(p.email, "Continuing education behind pace for "+p.LicenseName, message); err != nil {
+				log.Println("Error: ", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// StartAlertJob runs Alert for every tenant with CE requirements once a day
+// in the background.
+func StartAlertJob(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(alertInterval)
+		defer ticker.Stop()
+
+		for {
+			tenants, err := tenants(db)
+			if err != nil {
+				log.Printf("Failed to load tenants for CE alerts: %v", err)
+			}
+			for _, tenant := range tenants {
+				if err := Alert(db, tenant); err != nil {
+					log.Printf("CE alerts for %s failed: %v", tenant, err)
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func tenants(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+        SELECT DISTINCT createdBy FROM licenseVersions
+        WHERE ceRequirement IS NOT NULL
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var tenant string
+		if err := rows.Scan(&tenant); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
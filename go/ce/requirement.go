@@ -0,0 +1,35 @@
+package ce
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/validation"
+)
+
+// Requirement is the continuing education a license type needs in each
+// renewal cycle, from issueDate to expDate. Categories sets minimum hours
+// in particular categories; they count towards Hours.
+type Requirement struct {
+	Hours      float64            `json:"hours" validate:"gt=0,lte=1000"`
+	Categories map[string]float64 `json:"categories,omitempty" validate:"omitempty,dive,keys,required,max=100,endkeys,gt=0,lte=1000"`
+}
+
+// Check makes sure the category minimums fit in the total. prefix is the
+// json name the requirement sits under in the request.
+func (req Requirement) Check(prefix string) validation.FieldErrors {
+	fields := validation.FieldErrors{}
+
+	total := 0.0
+	for category, hours := range req.Categories {
+		if strings.TrimSpace(category) != category {
+			fields[fmt.Sprintf("%s.categories[%s]", prefix, category)] = "must not start or end with spaces"
+		}
+		total += hours
+	}
+	if total > req.Hours {
+		fields[prefix+".categories"] = "add up to more than hours"
+	}
+
+	return fields
+}
@@ -0,0 +1,366 @@
+package compliance
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/licenses"
+	"github.com/benfortenberry/accredi-track/onboarding"
+	"github.com/benfortenberry/accredi-track/requirements"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Credential statuses.
+const (
+	StatusActive   = licenses.StatusActive
+	StatusExpiring = licenses.StatusExpiring
+	StatusExpired  = licenses.StatusExpired
+	StatusMissing  = "missing"
+	StatusWaived   = "waived"
+	StatusInvalid  = licenses.StatusInvalid
+)
+
+// Credential is one license type an employee holds or is required to hold.
+// Held licenses report the record with the latest expiration date; missing
+// ones report when they are due.
+type Credential struct {
+	LicenseID         int     `json:"licenseId"`
+	LicenseName       string  `json:"licenseName"`
+	Required          bool    `json:"required"`
+	Status            string  `json:"status"`
+	EmployeeLicenseID *int    `json:"employeeLicenseId"`
+	IssueDate         *string `json:"issueDate"`
+	ExpDate           *string `json:"expDate"`
+	DaysUntilExpiry   *int    `json:"daysUntilExpiry"`
+	DueDate           *string `json:"dueDate"`
+	DaysUntilDue      *int    `json:"daysUntilDue"`
+	// InvalidDueTo is set for held licenses whose prerequisites are missing
+	// or expired.
+	InvalidDueTo []licenses.Blocker `json:"invalidDueTo,omitempty"`
+}
+
+// Action is the next thing that has to happen to keep an employee
+// compliant: renewing a held license or obtaining a missing one. Days is
+// negative when it is already overdue and nil when a requirement has no due
+// date yet. Unblocks names the license an action on a prerequisite makes
+// valid again.
+type Action struct {
+	Kind        string  `json:"kind"`
+	LicenseID   int     `json:"licenseId"`
+	LicenseName string  `json:"licenseName"`
+	DueDate     *string `json:"dueDate"`
+	Days        *int    `json:"days"`
+	Unblocks    string  `json:"unblocks,omitempty"`
+}
+
+type placeholder struct {
+	status  string
+	dueDate string
+	days    int
+}
+
+type Scorecard struct {
+	EmployeeID  int          `json:"employeeId"`
+	FirstName   string       `json:"firstName"`
+	LastName    string       `json:"lastName"`
+	Compliant   bool         `json:"compliant"`
+	Percentage  float64      `json:"compliancePercentage"`
+	Credentials []Credential `json:"credentials"`
+	Missing     []Credential `json:"missing"`
+	NextAction  *Action      `json:"nextAction"`
+}
+
+// GetEmployee returns an employee's compliance scorecard.
+func GetEmployee(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	employeeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	allowed, err := access.Allows(db, c, employeeID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	card := Scorecard{EmployeeID: int(employeeID)}
+	err = db.QueryRow(`
+        SELECT firstName, lastName FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, employeeID, userSubStr).Scan(&card.FirstName, &card.LastName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+
+	credentials, err := Credentials(db, employeeID, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute compliance"})
+		return
+	}
+
+	score(&card, credentials)
+
+	c.IndentedJSON(http.StatusOK, card)
+}
+
+// Credentials lists everything an employee holds or is required to hold,
+// ordered by license name.
+func Credentials(db *sql.DB, employeeID int64, userSub string) ([]Credential, error) {
+	byLicense := map[int]*Credential{}
+
+	// Newest expiration first so the first record seen for a license type is
+	// the one that counts.
+	rows, err := db.Query(`
+        SELECT el.id, el.licenseId, COALESCE(l.name, ''), el.issueDate, el.expDate,
+            DATEDIFF(el.expDate, CURDATE())
+        FROM employeeLicenses el
+        LEFT JOIN licenses l on el.licenseId = l.id
+        WHERE el.employeeId = ? and el.deleted IS NULL and el.createdBy = ?
+        ORDER BY el.expDate DESC, el.id DESC
+    `, employeeID, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cred Credential
+		var employeeLicenseID, days int
+		var issueDate, expDate string
+		if err := rows.Scan(&employeeLicenseID, &cred.LicenseID, &cred.LicenseName, &issueDate, &expDate, &days); err != nil {
+			return nil, err
+		}
+		if _, seen := byLicense[cred.LicenseID]; seen {
+			continue
+		}
+
+		cred.EmployeeLicenseID = &employeeLicenseID
+		cred.IssueDate = &issueDate
+		cred.ExpDate = &expDate
+		cred.DaysUntilExpiry = &days
+		switch {
+		case days < 0:
+			cred.Status = StatusExpired
+		case days <= licenses.ExpiringWindowDays:
+			cred.Status = StatusExpiring
+		default:
+			cred.Status = StatusActive
+		}
+		byLicense[cred.LicenseID] = &cred
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	invalid, err := licenses.Invalid(db, userSub, " and el.employeeId = ?", []interface{}{employeeID})
+	if err != nil {
+		return nil, err
+	}
+	for _, cred := range byLicense {
+		if blockers := invalid[*cred.EmployeeLicenseID]; len(blockers) > 0 && cred.Status != StatusExpired {
+			cred.Status = StatusInvalid
+			cred.InvalidDueTo = blockers
+		}
+	}
+
+	required, err := onboarding.Requirements(db, employeeID, userSub)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix, err := requirements.Required(db, employeeID, userSub)
+	if err != nil {
+		return nil, err
+	}
+	for licenseID := range matrix {
+		if _, ok := required[licenseID]; !ok {
+			required[licenseID] = onboarding.Requirement{}
+		}
+	}
+
+	// Placeholders carry the due date of a missing requirement and record
+	// requirements HR has waived.
+	placeholders := map[int]placeholder{}
+	placeholderRows, err := db.Query(`
+        SELECT p.licenseId, p.status, p.dueDate, DATEDIFF(p.dueDate, CURDATE())
+        FROM credentialPlaceholders p
+        WHERE p.employeeId = ? and p.createdBy = ?
+    `, employeeID, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer placeholderRows.Close()
+
+	for placeholderRows.Next() {
+		var licenseID int
+		var p placeholder
+		if err := placeholderRows.Scan(&licenseID, &p.status, &p.dueDate, &p.days); err != nil {
+			return nil, err
+		}
+		placeholders[licenseID] = p
+		if p.status == "missing" {
+			required[licenseID] = onboarding.Requirement{}
+		}
+	}
+	if err := placeholderRows.Err(); err != nil {
+		return nil, err
+	}
+
+	var names map[int]string
+	for licenseID := range required {
+		if cred, held := byLicense[licenseID]; held {
+			cred.Required = true
+			continue
+		}
+
+		if names == nil {
+			if names, err = licenseNames(db, userSub); err != nil {
+				return nil, err
+			}
+		}
+
+		cred := &Credential{LicenseID: licenseID, LicenseName: names[licenseID], Required: true, Status: StatusMissing}
+		if p, ok := placeholders[licenseID]; ok {
+			dueDate, days := p.dueDate, p.days
+			cred.DueDate = &dueDate
+			cred.DaysUntilDue = &days
+			if p.status == "waived" {
+				cred.Status = StatusWaived
+			}
+		}
+		byLicense[licenseID] = cred
+	}
+
+	credentials := make([]Credential, 0, len(byLicense))
+	for _, cred := range byLicense {
+		credentials = append(credentials, *cred)
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		if credentials[i].LicenseName != credentials[j].LicenseName {
+			return credentials[i].LicenseName < credentials[j].LicenseName
+		}
+		return credentials[i].LicenseID < credentials[j].LicenseID
+	})
+
+	return credentials, nil
+}
+
+// score fills in the summary fields of a scorecard. Waived requirements
+// don't count either way; everything else counts as compliant while it is
+// held, unexpired and its prerequisites are in order.
+func score(card *Scorecard, credentials []Credential) {
+	card.Credentials = credentials
+	card.Missing = []Credential{}
+
+	counted, compliant := 0, 0
+	for _, cred := range credentials {
+		switch cred.Status {
+		case StatusWaived:
+			continue
+		case StatusActive, StatusExpiring:
+			compliant++
+		case StatusMissing:
+			card.Missing = append(card.Missing, cred)
+		}
+		counted++
+
+		action := nextAction(cred)
+		if action != nil && sooner(action, card.NextAction) {
+			card.NextAction = action
+		}
+	}
+
+	card.Compliant = counted == compliant
+	card.Percentage = 100
+	if counted > 0 {
+		card.Percentage = math.Round(float64(compliant)/float64(counted)*1000) / 10
+	}
+}
+
+func nextAction(cred Credential) *Action {
+	action := &Action{LicenseID: cred.LicenseID, LicenseName: cred.LicenseName}
+	switch cred.Status {
+	case StatusMissing:
+		action.Kind = "obtain"
+		action.DueDate = cred.DueDate
+		action.Days = cred.DaysUntilDue
+	case StatusActive, StatusExpiring, StatusExpired:
+		action.Kind = "renew"
+		action.DueDate = cred.ExpDate
+		action.Days = cred.DaysUntilExpiry
+	case StatusInvalid:
+		// The license itself is fine; the root cause has to be fixed, and
+		// it is due now.
+		blocker := cred.InvalidDueTo[0]
+		action.Kind = "renew"
+		if blocker.Status == licenses.BlockerMissing {
+			action.Kind = "obtain"
+		}
+		action.LicenseID = blocker.LicenseID
+		action.LicenseName = blocker.LicenseName
+		action.Unblocks = cred.LicenseName
+	default:
+		return nil
+	}
+	return action
+}
+
+// sooner reports whether a is due before b. Actions without a due date are
+// treated as due now.
+func sooner(a *Action, b *Action) bool {
+	if b == nil {
+		return true
+	}
+	days := func(action *Action) int {
+		if action.Days == nil {
+			return 0
+		}
+		return *action.Days
+	}
+	return days(a) < days(b)
+}
+
+func licenseNames(db *sql.DB, userSub string) (map[int]string, error) {
+	rows, err := db.Query(`SELECT id, name FROM licenses WHERE createdBy = ?`, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
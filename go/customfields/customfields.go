@@ -0,0 +1,241 @@
+package customfields
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+var keyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// Field is a tenant-defined attribute that can be set on every employee.
+type Field struct {
+	ID       int      `json:"id"`
+	Key      string   `json:"key" validate:"required,max=50"`
+	Label    string   `json:"label" validate:"required,max=100"`
+	Type     string   `json:"type" validate:"required,oneof=text number date select boolean"`
+	Options  []string `json:"options,omitempty" validate:"dive,required,max=100"`
+	Required bool     `json:"required"`
+}
+
+func (field *Field) Normalize() {
+	field.Key = strings.TrimSpace(field.Key)
+	field.Label = strings.TrimSpace(field.Label)
+	for i, option := range field.Options {
+		field.Options[i] = strings.TrimSpace(option)
+	}
+}
+
+func (field *Field) Check() validation.FieldErrors {
+	fields := validation.FieldErrors{}
+	if field.Key != "" && !keyPattern.MatchString(field.Key) {
+		fields["key"] = "must start with a letter and contain only letters, digits and underscores"
+	}
+	if field.Type == "select" && len(field.Options) == 0 {
+		fields["options"] = "is required for select fields"
+	}
+	return fields
+}
+
+// Definitions returns the tenant's live custom fields.
+func Definitions(db *sql.DB, userSub string) ([]Field, error) {
+	rows, err := db.Query(`
+        SELECT id, fieldKey, label, type, options, required
+        FROM customFields
+        WHERE deleted IS NULL and createdBy = ?
+        ORDER BY id
+    `, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []Field{}
+	for rows.Next() {
+		var field Field
+		var options sql.NullString
+		if err := rows.Scan(
+			&field.ID, &field.Key, &field.Label, &field.Type, &options, &field.Required,
+		); err != nil {
+			return nil, err
+		}
+		if options.Valid && options.String != "" {
+			if err := json.Unmarshal([]byte(options.String), &field.Options); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, rows.Err()
+}
+
+func Get(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	fields, err := Definitions(db, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query custom fields"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, fields)
+}
+
+func Post(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var field Field
+	if !validation.Bind(c, &field) {
+		return
+	}
+
+	var existing int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM customFields
+        WHERE fieldKey = ? and deleted IS NULL and createdBy = ?
+    `, field.Key, userSubStr).Scan(&existing)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert custom field"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": gin.H{"key": "is already in use"}})
+		return
+	}
+
+	options, _ := json.Marshal(field.Options)
+
+	result, err := db.Exec(`
+        INSERT INTO customFields (
+            fieldKey, label, type, options, required, createdBy
+        ) VALUES (?, ?, ?, ?, ?, ?)
+    `, field.Key, field.Label, field.Type, options, field.Required, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert custom field"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted custom field ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Custom field inserted successfully", "id": id})
+}
+
+// Put updates the label, options and required flag. The key and type are
+// fixed once created because stored values depend on them.
+func Put(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var existing Field
+	err := db.QueryRow(`
+        SELECT id, fieldKey, type
+        FROM customFields
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSubStr).Scan(&existing.ID, &existing.Key, &existing.Type)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "custom field not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve custom field"})
+		return
+	}
+
+	var field Field
+	if err := c.ShouldBindJSON(&field); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	field.ID = existing.ID
+	field.Key = existing.Key
+	field.Type = existing.Type
+
+	if fields := validation.Validate(&field); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return
+	}
+
+	options, _ := json.Marshal(field.Options)
+
+	_, err = db.Exec(`
+        UPDATE customFields
+        SET label = ?, options = ?, required = ?
+        WHERE id = ?
+    `, field.Label, options, field.Required, field.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update custom field"})
+		return
+	}
+
+	c.JSON(http.StatusOK, field)
+}
+
+func Delete(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	result, err := db.Exec(`
+        UPDATE customFields
+        SET deleted = current_timestamp()
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete custom field"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "custom field not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Custom field deleted successfully"})
+}
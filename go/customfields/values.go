@@ -0,0 +1,221 @@
+package customfields
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// maxTextLength caps free-text values so they stay readable in exports.
+const maxTextLength = 500
+
+// Check validates submitted values against the tenant's definitions and
+// returns them in their stored string form, keyed by field ID. Errors are
+// keyed as customFields.<key> to match the request body.
+func Check(defs []Field, values map[string]interface{}) (map[int]string, validation.FieldErrors) {
+	stored := map[int]string{}
+	fields := validation.FieldErrors{}
+
+	known := map[string]bool{}
+	for _, def := range defs {
+		known[def.Key] = true
+		name := "customFields." + def.Key
+
+		raw, present := values[def.Key]
+		if !present || raw == nil || raw == "" {
+			if def.Required {
+				fields[name] = "is required"
+			}
+			continue
+		}
+
+		value, msg := convert(def, raw)
+		if msg != "" {
+			fields[name] = msg
+			continue
+		}
+		stored[def.ID] = value
+	}
+
+	for key := range values {
+		if !known[key] {
+			fields["customFields."+key] = "is not a defined custom field"
+		}
+	}
+
+	return stored, fields
+}
+
+// convert turns a JSON value into the string stored for a field, or returns
+// a message describing why it doesn't fit the field's type.
+func convert(def Field, raw interface{}) (string, string) {
+	switch def.Type {
+	case "number":
+		switch v := raw.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), ""
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return strconv.FormatFloat(n, 'f', -1, 64), ""
+			}
+		}
+		return "", "must be a number"
+
+	case "boolean":
+		switch v := raw.(type) {
+		case bool:
+			return strconv.FormatBool(v), ""
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return strconv.FormatBool(b), ""
+			}
+		}
+		return "", "must be true or false"
+
+	case "date":
+		if v, ok := raw.(string); ok {
+			date := validation.NormalizeDate(v)
+			if _, err := validation.ParseDate(date); err == nil {
+				return date, ""
+			}
+		}
+		return "", "must be a date in YYYY-MM-DD format"
+
+	case "select":
+		if v, ok := raw.(string); ok && slices.Contains(def.Options, strings.TrimSpace(v)) {
+			return strings.TrimSpace(v), ""
+		}
+		return "", "must be one of: " + strings.Join(def.Options, ", ")
+
+	default:
+		v, ok := raw.(string)
+		if !ok {
+			return "", "must be text"
+		}
+		v = strings.TrimSpace(v)
+		if len(v) > maxTextLength {
+			return "", fmt.Sprintf("must be at most %d characters", maxTextLength)
+		}
+		return v, ""
+	}
+}
+
+// typed converts a stored string back into the JSON type of its field.
+func typed(fieldType, value string) interface{} {
+	switch fieldType {
+	case "number":
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// Save replaces every custom field value of an employee with values.
+func Save(db utils.DB, employeeID int64, values map[int]string) error {
+	if _, err := db.Exec(`DELETE FROM employeeCustomFieldValues WHERE employeeId = ?`, employeeID); err != nil {
+		return err
+	}
+
+	for fieldID, value := range values {
+		_, err := db.Exec(`
+            INSERT INTO employeeCustomFieldValues (
+                employeeId, fieldId, value
+            ) VALUES (?, ?, ?)
+        `, employeeID, fieldID, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load returns the custom field values of the tenant's employees keyed by
+// employee ID and then field key. Pass employeeID 0 for every employee.
+func Load(db *sql.DB, userSub string, employeeID int) (map[int]map[string]interface{}, error) {
+	query := `
+        SELECT v.employeeId, f.fieldKey, f.type, v.value
+        FROM employeeCustomFieldValues v
+        JOIN customFields f on v.fieldId = f.id
+        WHERE f.deleted IS NULL and f.createdBy = ?
+    `
+	args := []interface{}{userSub}
+	if employeeID != 0 {
+		query += " and v.employeeId = ?"
+		args = append(args, employeeID)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := map[int]map[string]interface{}{}
+	for rows.Next() {
+		var id int
+		var key, fieldType, value string
+		if err := rows.Scan(&id, &key, &fieldType, &value); err != nil {
+			return nil, err
+		}
+		if values[id] == nil {
+			values[id] = map[string]interface{}{}
+		}
+		values[id][key] = typed(fieldType, value)
+	}
+
+	return values, rows.Err()
+}
+
+// Filter turns query parameters of the form cf.<key>=<value> into a
+// condition on column, an employee id. Numbers and booleans are compared in
+// their stored form, so cf.badge=0042 and cf.badge=42 match the same value.
+func Filter(db *sql.DB, c *gin.Context, userSub string, column string) (string, []interface{}, error) {
+	var requested []string
+	for param := range c.Request.URL.Query() {
+		if strings.HasPrefix(param, "cf.") {
+			requested = append(requested, param)
+		}
+	}
+	if len(requested) == 0 {
+		return "", nil, nil
+	}
+	slices.Sort(requested)
+
+	defs, err := Definitions(db, userSub)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var clause strings.Builder
+	var args []interface{}
+
+	for _, param := range requested {
+		key := strings.TrimPrefix(param, "cf.")
+		idx := slices.IndexFunc(defs, func(def Field) bool { return def.Key == key })
+		if idx < 0 {
+			return "", nil, fmt.Errorf("unknown custom field %q", key)
+		}
+
+		value, msg := convert(defs[idx], c.Query(param))
+		if msg != "" {
+			return "", nil, fmt.Errorf("custom field %q %s", key, msg)
+		}
+
+		fmt.Fprintf(&clause, " and %s in (select employeeId from employeeCustomFieldValues where fieldId = ? and value = ?)", column)
+		args = append(args, defs[idx].ID, value)
+	}
+
+	return clause.String(), args, nil
+}
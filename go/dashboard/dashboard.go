@@ -5,8 +5,15 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/groups"
+	"github.com/benfortenberry/accredi-track/licenses"
+	"github.com/benfortenberry/accredi-track/orgunits"
+	"github.com/benfortenberry/accredi-track/requirements"
 	"github.com/benfortenberry/accredi-track/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -19,6 +26,21 @@ type Metrics struct {
 	NotificationCount     int     `json:"notificationCount"`
 	ComplianceRate        float64 `json:"complianceRate"`
 	TotalEmployeeLicenses int     `json:"totalEmployeeLicenses"`
+	// MissingRequired counts required licenses employees have never had on
+	// file.
+	MissingRequired int `json:"missingRequired"`
+	// InvalidCount counts unexpired licenses that don't count because a
+	// prerequisite is missing or expired; RootCauses says which.
+	InvalidCount int         `json:"invalidCount"`
+	RootCauses   []RootCause `json:"rootCauses"`
+}
+
+// RootCause is a prerequisite license type holding up others, with how
+// many employee licenses it invalidates.
+type RootCause struct {
+	LicenseID       int    `json:"licenseId"`
+	LicenseName     string `json:"licenseName"`
+	InvalidLicenses int    `json:"invalidLicenses"`
 }
 
 type EmployeeLicense struct {
@@ -55,7 +77,7 @@ func isPastDate(date time.Time) bool {
 
 func isAlmostPastDate(date time.Time) bool {
 	// Get current date, truncated to remove time
-	soon := time.Now().Truncate(24*time.Hour).AddDate(0, 0, 30)
+	soon := time.Now().Truncate(24*time.Hour).AddDate(0, 0, licenses.ExpiringWindowDays)
 	fmt.Println(soon)
 
 	// Truncate input date to remove time
@@ -73,6 +95,75 @@ func toFixed(num float64, precision int) float64 {
 	return float64(round(num*output)) / output
 }
 
+// scopeFilter narrows a dashboard query to the caller's reports when they
+// are a manager, to the location or department requested in the query
+// string, including everything below it, and to the requested group or
+// tag. Offboarded employees are always left out. column is the employee id
+// column of the query being narrowed. It writes the error response itself when the scope can't
+// be resolved.
+func scopeFilter(db *sql.DB, c *gin.Context, column string) (string, []interface{}, bool) {
+	scope, args, err := orgunits.Scope(db, c, column)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location or department"})
+		return "", nil, false
+	}
+
+	groupScope, groupArgs, err := groups.Filter(db, c, column)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", nil, false
+	}
+
+	accessScope, accessArgs := access.Scope(c, column)
+	activeScope := fmt.Sprintf(" and %s not in (select id from employees where offboarded is not null)", column)
+
+	return activeScope + accessScope + scope + groupScope, append(append(accessArgs, args...), groupArgs...), true
+}
+
+// complianceRate is the percentage of licenses that count. Required
+// licenses nobody has on file count against it along with expired and
+// invalid ones; expired required licenses are already among the total.
+func complianceRate(total int, expired int, invalid int, missing int) float64 {
+	if total+missing == 0 {
+		return 100
+	}
+	return toFixed(float64(total-expired-invalid)/float64(total+missing), 2) * 100
+}
+
+// rootCauses counts the unexpired licenses invalidated by prerequisites and
+// groups them by the prerequisite to blame, worst first.
+func rootCauses(employeeLicenses []EmployeeLicense, invalid map[int][]licenses.Blocker) (int, []RootCause) {
+	count := 0
+	byLicense := map[int]*RootCause{}
+	causes := []RootCause{}
+	for _, lic := range employeeLicenses {
+		expDate, err := time.Parse("2006-01-02", lic.ExpDate)
+		if err != nil || isPastDate(expDate) || len(invalid[lic.ID]) == 0 {
+			continue
+		}
+		count++
+		for _, blocker := range invalid[lic.ID] {
+			if byLicense[blocker.LicenseID] == nil {
+				byLicense[blocker.LicenseID] = &RootCause{LicenseID: blocker.LicenseID, LicenseName: blocker.LicenseName}
+			}
+			byLicense[blocker.LicenseID].InvalidLicenses++
+		}
+	}
+
+	for _, cause := range byLicense {
+		causes = append(causes, *cause)
+	}
+	sort.Slice(causes, func(i, j int) bool {
+		if causes[i].InvalidLicenses != causes[j].InvalidLicenses {
+			return causes[i].InvalidLicenses > causes[j].InvalidLicenses
+		}
+		return causes[i].LicenseName < causes[j].LicenseName
+	})
+	return count, causes
+}
+
 func Get(db *sql.DB, c *gin.Context) {
 
 	// Convert userSub to a string
@@ -84,12 +175,22 @@ func Get(db *sql.DB, c *gin.Context) {
 
 	var metrics Metrics
 
+	employeeScope, employeeScopeArgs, ok := scopeFilter(db, c, "e.id")
+	if !ok {
+		return
+	}
+
+	licenseScope, licenseScopeArgs, ok := scopeFilter(db, c, "el.employeeId")
+	if !ok {
+		return
+	}
+
 	queryTotalEmployees := (`
 	select count(*) as count from employees e 
-where e.deleted is null and createdBy = ? `)
+where e.deleted is null and createdBy = ? ` + employeeScope)
 
 	//total employees
-	err1 := db.QueryRow(queryTotalEmployees, userSubStr).Scan(
+	err1 := db.QueryRow(queryTotalEmployees, append([]interface{}{userSubStr}, employeeScopeArgs...)...).Scan(
 		&metrics.TotalEmployees,
 	)
 
@@ -124,11 +225,11 @@ where e.deleted is null and createdBy = ? `)
 		 and el.deleted IS NULL
 		and el.createdBy = ?
 	where el.deleted is null
-	`)
+	` + licenseScope)
 
 	var employeeLicenses []EmployeeLicense
 
-	rows, err2 := db.Query(queryEmployeeLicenses, userSubStr)
+	rows, err2 := db.Query(queryEmployeeLicenses, append([]interface{}{userSubStr}, licenseScopeArgs...)...)
 
 	if err2 != nil {
 		if err2 == sql.ErrNoRows {
@@ -182,20 +283,42 @@ where e.deleted is null and createdBy = ? `)
 
 	}
 
-	totalActive := len(employeeLicenses) - len(expiredEmployeeLicenses)
-	metrics.ComplianceRate = toFixed(float64(totalActive)/float64(len(employeeLicenses)), 2) * 100
+	gaps, err := requirements.Find(db, userSubStr, employeeScope, employeeScopeArgs)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dashboard metrics"})
+		return
+	}
+	for _, gap := range gaps {
+		if gap.Status == requirements.GapMissing {
+			metrics.MissingRequired++
+		}
+	}
+
+	invalid, err := licenses.Invalid(db, userSubStr, licenseScope, licenseScopeArgs)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dashboard metrics"})
+		return
+	}
+	metrics.InvalidCount, metrics.RootCauses = rootCauses(employeeLicenses, invalid)
+
+	metrics.ComplianceRate = complianceRate(len(employeeLicenses), len(expiredEmployeeLicenses), metrics.InvalidCount, metrics.MissingRequired)
 	metrics.ExpiredCount = len(expiredEmployeeLicenses)
 	metrics.ExpiringSoon = len(expiringSoonEmployeeLicenses)
 	metrics.TotalEmployeeLicenses = len(employeeLicenses)
-	metrics.LicenseAvg = float32(len(employeeLicenses)) / float32(metrics.TotalEmployees)
+	if metrics.TotalEmployees > 0 {
+		metrics.LicenseAvg = float32(len(employeeLicenses)) / float32(metrics.TotalEmployees)
+	}
 
 	//notifications last 30 days
 
 	queryNotifications := (`
-	select count(*) as count from notifications
-where userSub = ? `)
+	select count(*) as count from notifications n
+join employees e on n.employeeId = e.id
+where n.userSub = ? ` + employeeScope)
 
-	err3 := db.QueryRow(queryNotifications, userSubStr).Scan(
+	err3 := db.QueryRow(queryNotifications, append([]interface{}{userSubStr}, employeeScopeArgs...)...).Scan(
 		&metrics.NotificationCount,
 	)
 
@@ -222,14 +345,19 @@ func GetLicenseChartData(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	scope, scopeArgs, ok := scopeFilter(db, c, "el.employeeId")
+	if !ok {
+		return
+	}
+
 	var licenseChartData []LicenseChartData
 	query := (`
 	SELECT COUNT(el.id) as count, l.name 
 FROM employeeLicenses el 
 left join licenses l on el.licenseId = l.id 
-where el.deleted is null and el.expDate > CURDATE() and el.createdby = ?
+where el.deleted is null and el.expDate > CURDATE() and el.createdby = ?` + scope + `
 GROUP BY l.name `)
-	rows, err := db.Query(query, userSubStr)
+	rows, err := db.Query(query, append([]interface{}{userSubStr}, scopeArgs...)...)
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query license chart"})
@@ -267,14 +395,19 @@ func GetExpiredLicenseChartData(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	scope, scopeArgs, ok := scopeFilter(db, c, "el.employeeId")
+	if !ok {
+		return
+	}
+
 	var licenseChartData []LicenseChartData
 	query := (`
 	SELECT COUNT(el.id) as count, l.name 
 FROM employeeLicenses el 
 left join licenses l on el.licenseId = l.id 
-where el.deleted is null and el.expDate < CURDATE() and el.createdby = ?
+where el.deleted is null and el.expDate < CURDATE() and el.createdby = ?` + scope + `
 GROUP BY l.name`)
-	rows, err := db.Query(query, userSubStr)
+	rows, err := db.Query(query, append([]interface{}{userSubStr}, scopeArgs...)...)
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query expired license chart"})
@@ -312,56 +445,31 @@ func GetExpiringsByMonth(db *sql.DB, c *gin.Context) {
 		return
 	}
 
-	var licenseChartData []LicenseExpiringChartData
-	query := (`
-	
-    
+	scope, scopeArgs, ok := scopeFilter(db, c, "employeeId")
+	if !ok {
+		return
+	}
+
+	// One bucket per month for the next five months.
+	var buckets []string
+	var args []interface{}
+	for month := 1; month <= 5; month++ {
+		buckets = append(buckets, fmt.Sprintf(`
    SELECT
-	DATE_FORMAT(DATE_ADD(CURDATE(), INTERVAL 1 MONTH), '%M') AS month,
+	DATE_FORMAT(DATE_ADD(CURDATE(), INTERVAL %[1]d MONTH), '%%M') AS month,
 	COUNT(*) AS count
 FROM
 	employeeLicenses
 WHERE
-	expDate BETWEEN CURDATE() AND DATE_ADD(CURDATE(), INTERVAL 1 MONTH)
-	and deleted is null  and createdBy= ?
-union all 
-       SELECT
-	DATE_FORMAT(DATE_ADD(CURDATE(), INTERVAL 2 MONTH), '%M') AS month,
-	COUNT(*) AS count
-FROM
-	employeeLicenses
-WHERE
-	expDate BETWEEN DATE_ADD(CURDATE(), INTERVAL 1 MONTH) AND DATE_ADD(CURDATE(), INTERVAL 2 MONTH)
-	and deleted is null  and createdBy= ?
-union all
-       SELECT
-	DATE_FORMAT(DATE_ADD(CURDATE(), INTERVAL 3 MONTH), '%M') AS month,
-	COUNT(*) AS count
-FROM
-	employeeLicenses
-WHERE
-	expDate BETWEEN DATE_ADD(CURDATE(), INTERVAL 2 MONTH) AND DATE_ADD(CURDATE(), INTERVAL 3 MONTH)
-	and deleted is null  and createdBy= ?
-	union all
-  SELECT
-	DATE_FORMAT(DATE_ADD(CURDATE(), INTERVAL 4 MONTH), '%M') AS month,
-	COUNT(*) AS count
-FROM
-	employeeLicenses
-WHERE
-	expDate BETWEEN DATE_ADD(CURDATE(), INTERVAL 3 MONTH) AND DATE_ADD(CURDATE(), INTERVAL 4 MONTH)
-	and deleted is null and createdBy= ?
-		union all
-  SELECT
-	DATE_FORMAT(DATE_ADD(CURDATE(), INTERVAL 5 MONTH), '%M') AS month,
-	COUNT(*) AS count
-FROM
-	employeeLicenses
-WHERE
-	expDate BETWEEN DATE_ADD(CURDATE(), INTERVAL 4 MONTH) AND DATE_ADD(CURDATE(), INTERVAL 5 MONTH)
-	and deleted is null  and createdBy= ?
-`)
-	rows, err := db.Query(query, userSubStr, userSubStr, userSubStr, userSubStr, userSubStr)
+	expDate BETWEEN DATE_ADD(CURDATE(), INTERVAL %[2]d MONTH) AND DATE_ADD(CURDATE(), INTERVAL %[1]d MONTH)
+	and deleted is null  and createdBy= ?%[3]s`, month, month-1, scope))
+		args = append(args, userSubStr)
+		args = append(args, scopeArgs...)
+	}
+
+	var licenseChartData []LicenseExpiringChartData
+	query := strings.Join(buckets, "\nunion all")
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query expiring license chart"})
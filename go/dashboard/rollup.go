@@ -0,0 +1,186 @@
+package dashboard
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/licenses"
+	"github.com/benfortenberry/accredi-track/orgunits"
+	"github.com/benfortenberry/accredi-track/requirements"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type RollupNode struct {
+	ID                    int     `json:"id"`
+	Name                  string  `json:"name"`
+	ParentID              *int    `json:"parentId"`
+	TotalEmployees        int     `json:"totalEmployees"`
+	TotalEmployeeLicenses int     `json:"totalEmployeeLicenses"`
+	ExpiredCount          int     `json:"expiredCount"`
+	ExpiringSoon          int     `json:"expiringSoon"`
+	ComplianceRate        float64 `json:"complianceRate"`
+	// MissingRequired and InvalidCount count against ComplianceRate the
+	// same way they do on the dashboard.
+	MissingRequired int `json:"missingRequired"`
+	InvalidCount    int `json:"invalidCount"`
+}
+
+// GetRollup returns compliance for every node of the location or department
+// tree (?kind=department), with each node's numbers including everything
+// below it.
+func GetRollup(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	kind := orgunits.Location
+	if c.Query("kind") == string(orgunits.Department) {
+		kind = orgunits.Department
+	}
+
+	units, err := orgunits.List(db, kind, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query rollup nodes"})
+		return
+	}
+
+	nodes := make(map[int]*RollupNode, len(units))
+	rollup := make([]*RollupNode, 0, len(units))
+	for _, unit := range units {
+		node := &RollupNode{ID: unit.ID, Name: unit.Name, ParentID: unit.ParentID}
+		nodes[unit.ID] = node
+		rollup = append(rollup, node)
+	}
+
+	// addUp applies fn to a node and every ancestor. The step limit guards
+	// against a cycle sneaking into the tree.
+	addUp := func(id int, fn func(*RollupNode)) {
+		for steps := 0; steps <= len(nodes); steps++ {
+			node, ok := nodes[id]
+			if !ok {
+				return
+			}
+			fn(node)
+			if node.ParentID == nil {
+				return
+			}
+			id = *node.ParentID
+		}
+	}
+
+	column := orgunits.EmployeeColumn(kind)
+	scope, scopeArgs := access.Scope(c, "e.id")
+
+	// Employees are counted here rather than taken from the org unit list so
+	// a manager's rollup only covers their reports.
+	countQuery := fmt.Sprintf(`
+	select e.id, e.%s
+	from employees e
+	where e.deleted is null and e.offboarded is null and e.createdBy = ? and e.%s is not null%s`, column, column, scope)
+
+	countRows, err := db.Query(countQuery, append([]interface{}{userSubStr}, scopeArgs...)...)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query rollup data"})
+		return
+	}
+	defer countRows.Close()
+
+	employeeNodes := map[int]int{}
+	for countRows.Next() {
+		var employeeID, nodeID int
+		if err := countRows.Scan(&employeeID, &nodeID); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan rollup data"})
+			return
+		}
+		employeeNodes[employeeID] = nodeID
+		addUp(nodeID, func(node *RollupNode) { node.TotalEmployees++ })
+	}
+
+	if err := countRows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	gaps, err := requirements.Find(db, userSubStr, scope, scopeArgs)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query rollup data"})
+		return
+	}
+	for _, gap := range gaps {
+		if nodeID, ok := employeeNodes[gap.EmployeeID]; ok && gap.Status == requirements.GapMissing {
+			addUp(nodeID, func(node *RollupNode) { node.MissingRequired++ })
+		}
+	}
+
+	licenseScope, licenseScopeArgs := access.Scope(c, "el.employeeId")
+	invalid, err := licenses.Invalid(db, userSubStr, licenseScope, licenseScopeArgs)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query rollup data"})
+		return
+	}
+
+	query := fmt.Sprintf(`
+	select
+		el.id,
+		e.%s,
+		el.expDate < CURDATE() as expired,
+		el.expDate between CURDATE() and DATE_ADD(CURDATE(), INTERVAL ? DAY) as expiringSoon
+	from employeeLicenses el
+	join employees e on el.employeeId = e.id
+	where el.deleted is null and e.deleted is null and e.offboarded is null
+		and e.createdBy = ? and e.%s is not null%s`, column, column, scope)
+
+	rows, err := db.Query(query, append([]interface{}{licenses.ExpiringWindowDays, userSubStr}, scopeArgs...)...)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query rollup data"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, nodeID int
+		var expired, expiringSoon bool
+		if err := rows.Scan(&id, &nodeID, &expired, &expiringSoon); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan rollup data"})
+			return
+		}
+
+		addUp(nodeID, func(node *RollupNode) {
+			node.TotalEmployeeLicenses++
+			if expired {
+				node.ExpiredCount++
+			} else if expiringSoon {
+				node.ExpiringSoon++
+			}
+			if !expired && len(invalid[id]) > 0 {
+				node.InvalidCount++
+			}
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	for _, node := range rollup {
+		node.ComplianceRate = complianceRate(node.TotalEmployeeLicenses, node.ExpiredCount, node.InvalidCount, node.MissingRequired)
+	}
+
+	c.IndentedJSON(http.StatusOK, rollup)
+}
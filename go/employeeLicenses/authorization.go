@@ -0,0 +1,112 @@
+package employeeLicesnses
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/jurisdictions"
+	"github.com/benfortenberry/accredi-track/licenses"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Authorization says whether an employee was licensed to practice in a
+// jurisdiction on a date, and by which licenses.
+type Authorization struct {
+	EmployeeID   int                    `json:"employeeId"`
+	Jurisdiction string                 `json:"jurisdiction"`
+	Date         string                 `json:"date"`
+	Authorized   bool                   `json:"authorized"`
+	Licenses     []jurisdictions.Record `json:"licenses"`
+}
+
+// GetAuthorization answers "is this employee licensed to practice in
+// ?jurisdiction on ?date", today by default. Any license type in the
+// license category counts unless ?licenseId names one. From today on,
+// licenses invalid for want of a prerequisite don't count.
+func GetAuthorization(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	employeeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	if !allowEmployee(db, c, employeeID) {
+		return
+	}
+
+	jurisdiction := strings.ToUpper(strings.TrimSpace(c.Query("jurisdiction")))
+	if jurisdiction == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "jurisdiction is required"})
+		return
+	}
+
+	today := time.Now().Format(validation.DateLayout)
+	date := today
+	if param := c.Query("date"); param != "" {
+		date = validation.NormalizeDate(param)
+		if _, err := validation.ParseDate(date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+			return
+		}
+	}
+
+	scope := " and el.employeeId = ?"
+	scopeArgs := []interface{}{employeeID}
+	if param := c.Query("licenseId"); param != "" {
+		licenseID, err := strconv.Atoi(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid licenseId"})
+			return
+		}
+		scope += " and el.licenseId = ?"
+		scopeArgs = append(scopeArgs, licenseID)
+	} else {
+		scope += " and l.category = 'license'"
+	}
+
+	records, err := jurisdictions.Records(db, userSubStr, scope, scopeArgs)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query employee licenses"})
+		return
+	}
+
+	// Prerequisite status is only known as of now, so it isn't applied to
+	// past dates.
+	invalid := map[int][]licenses.Blocker{}
+	if date >= today {
+		if invalid, err = licenses.Invalid(db, userSubStr, " and el.employeeId = ?", []interface{}{employeeID}); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check license prerequisites"})
+			return
+		}
+	}
+
+	auth := Authorization{
+		EmployeeID:   employeeID,
+		Jurisdiction: jurisdiction,
+		Date:         date,
+		Licenses:     []jurisdictions.Record{},
+	}
+	for _, r := range records {
+		if r.ValidOn(date) && r.Covers(jurisdiction) && len(invalid[r.EmployeeLicenseID]) == 0 {
+			auth.Licenses = append(auth.Licenses, r)
+		}
+	}
+	auth.Authorized = len(auth.Licenses) > 0
+
+	c.JSON(http.StatusOK, auth)
+}
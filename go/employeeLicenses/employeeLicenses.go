@@ -2,13 +2,27 @@ package employeeLicesnses
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
-
+	"strconv"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/expiration"
+	"github.com/benfortenberry/accredi-track/jurisdictions"
+	"github.com/benfortenberry/accredi-track/licenses"
+	"github.com/benfortenberry/accredi-track/onboarding"
+	"github.com/benfortenberry/accredi-track/timeline"
 	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
 	"github.com/gin-gonic/gin"
 )
 
+// errOffboarded is returned when writing to an offboarded employee's
+// licenses.
+const errOffboarded = "Employee has been offboarded; their licenses are read-only"
+
 type EmployeeLicense struct {
 	ID          int    `json:"id"`
 	EmployeeID  int    `json:"employeeId"`
@@ -20,14 +34,88 @@ type EmployeeLicense struct {
 	LicenseID   int    `json:"licenseId"`
 	IssueDate   string `json:"issueDate"`
 	ExpDate     string `json:"expDate"`
+	// ExpDateOverridden is set when expDate was kept against the license
+	// type's expiration rule.
+	ExpDateOverridden bool `json:"expDateOverridden"`
+	// Jurisdictions and Multistate are as recorded; ValidIn is where that
+	// makes the license valid.
+	Jurisdictions []string `json:"jurisdictions"`
+	Multistate    bool     `json:"multistate"`
+	ValidIn       []string `json:"validIn"`
+	// LicenseVersion is the version of the license type in force when it
+	// was issued, and AppliedRule the expiration rule that version set.
+	LicenseVersion *int             `json:"licenseVersion"`
+	AppliedRule    *expiration.Rule `json:"appliedRule"`
+	// Status is active, expired or invalidDueToPrerequisite, in which case
+	// InvalidDueTo names the prerequisites to sort out.
+	Status       string             `json:"status"`
+	InvalidDueTo []licenses.Blocker `json:"invalidDueTo"`
 }
 
+// EmployeeLicenseInsert is the body accepted by Post. ExpDate can be left
+// out when the license type has an expiration rule; giving one that differs
+// from the rule's date needs ExpDateOverride.
 type EmployeeLicenseInsert struct {
-	ID         int    `json:"id"`
-	EmployeeID int    `json:"employeeId"`
-	LicenseID  int    `json:"licenseId"`
-	IssueDate  string `json:"issueDate"`
-	ExpDate    string `json:"expDate"`
+	ID              int    `json:"id"`
+	EmployeeID      int    `json:"employeeId" validate:"required,gt=0"`
+	LicenseID       int    `json:"licenseId" validate:"required,gt=0"`
+	IssueDate       string `json:"issueDate" validate:"required,datetime=2006-01-02"`
+	ExpDate         string `json:"expDate" validate:"omitempty,datetime=2006-01-02"`
+	ExpDateOverride bool   `json:"expDateOverride"`
+	// Jurisdictions are where the license is valid on its own. Multistate
+	// makes it valid across its license type's compact as well.
+	Jurisdictions []string `json:"jurisdictions" validate:"max=60,dive,required,max=100"`
+	Multistate    bool     `json:"multistate"`
+}
+
+// EmployeeLicenseUpdate is the body accepted by Put. The employee a license
+// belongs to can't be changed, so it isn't required here.
+type EmployeeLicenseUpdate struct {
+	LicenseID       int    `json:"licenseId" validate:"required,gt=0"`
+	IssueDate       string `json:"issueDate" validate:"required,datetime=2006-01-02"`
+	ExpDate         string `json:"expDate" validate:"omitempty,datetime=2006-01-02"`
+	ExpDateOverride bool   `json:"expDateOverride"`
+	// Jurisdictions are where the license is valid on its own. Multistate
+	// makes it valid across its license type's compact as well.
+	Jurisdictions []string `json:"jurisdictions" validate:"max=60,dive,required,max=100"`
+	Multistate    bool     `json:"multistate"`
+}
+
+func (lic *EmployeeLicenseInsert) Normalize() {
+	lic.IssueDate = validation.NormalizeDate(lic.IssueDate)
+	lic.ExpDate = validation.NormalizeDate(lic.ExpDate)
+	lic.Jurisdictions = jurisdictions.Normalize(lic.Jurisdictions)
+}
+
+func (lic *EmployeeLicenseInsert) Check() validation.FieldErrors {
+	return checkDates(lic.IssueDate, lic.ExpDate)
+}
+
+func (lic *EmployeeLicenseUpdate) Normalize() {
+	lic.IssueDate = validation.NormalizeDate(lic.IssueDate)
+	lic.ExpDate = validation.NormalizeDate(lic.ExpDate)
+	lic.Jurisdictions = jurisdictions.Normalize(lic.Jurisdictions)
+}
+
+func (lic *EmployeeLicenseUpdate) Check() validation.FieldErrors {
+	return checkDates(lic.IssueDate, lic.ExpDate)
+}
+
+// checkDates makes sure a license doesn't expire before it was issued. Format
+// problems are left to the struct tags.
+func checkDates(issueDate, expDate string) validation.FieldErrors {
+	issued, err := validation.ParseDate(issueDate)
+	if err != nil {
+		return nil
+	}
+	expires, err := validation.ParseDate(expDate)
+	if err != nil {
+		return nil
+	}
+	if expires.Before(issued) {
+		return validation.FieldErrors{"expDate": "must be on or after issueDate"}
+	}
+	return nil
 }
 
 func Get(db *sql.DB, c *gin.Context) {
@@ -40,6 +128,10 @@ func Get(db *sql.DB, c *gin.Context) {
 
 	id := c.Param("id")
 
+	if !allowEmployee(db, c, id) {
+		return
+	}
+
 	var employeeLicenses []EmployeeLicense
 	query := `
 select
@@ -48,6 +140,9 @@ select
 	el.licenseId,
 	el.issueDate,
 	el.expDate,
+	el.expDateOverridden,
+	el.jurisdictions,
+	el.multistate,
 	l.name  as licenseName
 from
 	employeeLicenses el
@@ -70,15 +165,22 @@ left join licenses l on
 
 	for rows.Next() {
 		var lic EmployeeLicense
+		var own sql.NullString
 		if err := rows.Scan(
 			&lic.ID, &lic.EmployeeID, &lic.LicenseID,
-			&lic.IssueDate, &lic.ExpDate,
+			&lic.IssueDate, &lic.ExpDate, &lic.ExpDateOverridden,
+			&own, &lic.Multistate,
 			&lic.LicenseName,
 		); err != nil {
 			fmt.Println("Error: ", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan employee license data"})
 			return
 		}
+		if lic.Jurisdictions, err = jurisdictions.Decode(own); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan employee license data"})
+			return
+		}
 		employeeLicenses = append(employeeLicenses, lic)
 	}
 
@@ -88,6 +190,12 @@ left join licenses l on
 		return
 	}
 
+	if err := withStatus(db, employeeLicenses, id, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check license prerequisites"})
+		return
+	}
+
 	c.IndentedJSON(http.StatusOK, employeeLicenses)
 }
 
@@ -100,10 +208,52 @@ func Post(db *sql.DB, c *gin.Context) {
 	}
 
 	var lic EmployeeLicenseInsert
-	if err := c.BindJSON(&lic); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if !validation.Bind(c, &lic) {
+		return
+	}
+
+	if !allowEmployee(db, c, lic.EmployeeID) {
+		return
+	}
+
+	var offboarded bool
+	err := db.QueryRow(`
+        SELECT COUNT(*) > 0 FROM employees
+        WHERE id = ? and offboarded IS NOT NULL and createdBy = ?
+    `, lic.EmployeeID, userSubStr).Scan(&offboarded)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+	if offboarded {
+		c.JSON(http.StatusConflict, gin.H{"error": errOffboarded})
+		return
+	}
+
+	if !checkMultistate(db, c, lic.LicenseID, lic.Multistate, userSubStr) {
+		return
+	}
+	validIn, err := jurisdictions.Encode(lic.Jurisdictions)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert employee license"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert employee license"})
 		return
 	}
+	defer tx.Rollback()
+
+	expDate, overridden, versionID, ok := resolveExpDate(tx, c, lic.EmployeeID, lic.LicenseID, lic.IssueDate, lic.ExpDate, lic.ExpDateOverride, userSubStr)
+	if !ok {
+		return
+	}
+	lic.ExpDate = expDate
 
 	// Prepare the SQL statement for inserting
 	query := `
@@ -112,16 +262,24 @@ func Post(db *sql.DB, c *gin.Context) {
 			licenseId,
 			issueDate,
 			expDate,
+			expDateOverridden,
+			jurisdictions,
+			multistate,
+			licenseVersionId,
 			createdBy
-        ) VALUES (?, ?, ?, ?, ?)
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
     `
 
 	// Execute the query
-	result, err := db.Exec(query,
+	result, err := tx.Exec(query,
 		lic.EmployeeID,
 		lic.LicenseID,
 		lic.IssueDate,
 		lic.ExpDate,
+		overridden,
+		validIn,
+		lic.Multistate,
+		versionID,
 		userSubStr,
 	)
 	if err != nil {
@@ -138,13 +296,38 @@ func Post(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	if err := onboarding.Fulfill(tx, id, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding placeholders"})
+		return
+	}
+
+	licenseID := int(id)
+	err = timeline.Record(tx, userSubStr, timeline.Entry{
+		EmployeeID:        lic.EmployeeID,
+		EmployeeLicenseID: &licenseID,
+		Kind:              timeline.LicenseAdded,
+		Detail:            gin.H{"issueDate": lic.IssueDate, "expDate": lic.ExpDate},
+	})
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record employee license activity"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert employee license"})
+		return
+	}
+
 	// Respond with the ID of the newly created
 	c.JSON(http.StatusOK, gin.H{"message": "Employee License inserted successfully", "id": id})
 }
 
 func Delete(db *sql.DB, c *gin.Context) {
 
-	_, ok := utils.GetUserSub(c)
+	userSubStr, ok := utils.GetUserSub(c)
 	if !ok {
 		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
 		return
@@ -153,6 +336,10 @@ func Delete(db *sql.DB, c *gin.Context) {
 	// Get the ID from the URL parameter
 	id := c.Param("id")
 
+	if !allowLicense(db, c, id, userSubStr) {
+		return
+	}
+
 	// Prepare the SQL statement for deleting
 	query := `
         UPDATE employeeLicenses
@@ -181,13 +368,19 @@ func Delete(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	if err := record(db, id, timeline.LicenseRemoved, nil, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record employee license activity"})
+		return
+	}
+
 	// Respond with a success message
 	c.JSON(http.StatusOK, gin.H{"message": "Employee License deleted successfully"})
 }
 
 func Put(db *sql.DB, c *gin.Context) {
 
-	_, ok := utils.GetUserSub(c)
+	userSubStr, ok := utils.GetUserSub(c)
 	if !ok {
 		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
 		return
@@ -196,11 +389,47 @@ func Put(db *sql.DB, c *gin.Context) {
 	// Get the ID from the URL parameter
 	id := c.Param("id")
 
-	var lic EmployeeLicenseInsert
-	if err := c.BindJSON(&lic); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	var lic EmployeeLicenseUpdate
+	if !validation.Bind(c, &lic) {
+		return
+	}
+
+	if !allowLicense(db, c, id, userSubStr) {
+		return
+	}
+
+	if !checkMultistate(db, c, lic.LicenseID, lic.Multistate, userSubStr) {
+		return
+	}
+	validIn, err := jurisdictions.Encode(lic.Jurisdictions)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee license"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee license"})
 		return
 	}
+	defer tx.Rollback()
+
+	var previousExpDate string
+	var employeeID int
+	err = tx.QueryRow(`SELECT expDate, employeeId FROM employeeLicenses WHERE id = ? FOR UPDATE`, id).Scan(&previousExpDate, &employeeID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee license"})
+		return
+	}
+
+	expDate, overridden, versionID, ok := resolveExpDate(tx, c, employeeID, lic.LicenseID, lic.IssueDate, lic.ExpDate, lic.ExpDateOverride, userSubStr)
+	if !ok {
+		return
+	}
+	lic.ExpDate = expDate
 
 	// Prepare the SQL statement for updating
 	query := `
@@ -208,17 +437,25 @@ func Put(db *sql.DB, c *gin.Context) {
 		SET 
 			licenseId = ?,
 			issueDate = ?,
-			expDate = ?
+			expDate = ?,
+			expDateOverridden = ?,
+			jurisdictions = ?,
+			multistate = ?,
+			licenseVersionId = ?
         WHERE id = ?
     `
 
 	// fmt.Println(lic.LicenseID, lic.IssueDate, lic.ExpDate, id)
 
 	// Execute the query
-	_, err := db.Exec(query,
+	_, err = tx.Exec(query,
 		lic.LicenseID,
 		lic.IssueDate,
 		lic.ExpDate,
+		overridden,
+		validIn,
+		lic.Multistate,
+		versionID,
 		id,
 	)
 	if err != nil {
@@ -227,13 +464,43 @@ func Put(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	licenseID, _ := strconv.ParseInt(id, 10, 64)
+	if err := onboarding.Fulfill(tx, licenseID, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding placeholders"})
+		return
+	}
+
+	// Pushing the expiration date out is a renewal; anything else is a
+	// correction.
+	kind := timeline.LicenseUpdated
+	if lic.ExpDate > previousExpDate {
+		kind = timeline.LicenseRenewed
+	}
+	detail := gin.H{"issueDate": lic.IssueDate, "expDate": lic.ExpDate, "previousExpDate": previousExpDate}
+	if err := record(tx, id, kind, detail, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record employee license activity"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee license"})
+		return
+	}
+
 	var updatedLicense EmployeeLicense
+	var own sql.NullString
 	getQuery := `
 		 SELECT el.id,
 	el.employeeId ,
 	el.licenseId,
 	el.issueDate,
 	el.expDate,
+	el.expDateOverridden,
+	el.jurisdictions,
+	el.multistate,
 	e.firstName,
 	e.lastName,
 	e.phone1,
@@ -253,6 +520,9 @@ left join licenses l on
 		&updatedLicense.LicenseID,
 		&updatedLicense.IssueDate,
 		&updatedLicense.ExpDate,
+		&updatedLicense.ExpDateOverridden,
+		&own,
+		&updatedLicense.Multistate,
 		&updatedLicense.FirstName,
 		&updatedLicense.LastName,
 		&updatedLicense.Phone1,
@@ -264,8 +534,218 @@ left join licenses l on
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated employee license"})
 		return
 	}
+	if updatedLicense.Jurisdictions, err = jurisdictions.Decode(own); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated employee license"})
+		return
+	}
+
+	updated := []EmployeeLicense{updatedLicense}
+	if err := withStatus(db, updated, updatedLicense.EmployeeID, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check license prerequisites"})
+		return
+	}
+	updatedLicense = updated[0]
 
 	// Respond with the updated data
 	c.JSON(http.StatusOK, updatedLicense)
 
 }
+
+// withStatus fills in the derived status of an employee's licenses, where
+// they are valid and the rules they were issued under.
+func withStatus(db *sql.DB, employeeLicenses []EmployeeLicense, employeeID interface{}, userSub string) error {
+	invalid, err := licenses.Invalid(db, userSub, " and el.employeeId = ?", []interface{}{employeeID})
+	if err != nil {
+		return err
+	}
+
+	records, err := jurisdictions.Records(db, userSub, " and el.employeeId = ?", []interface{}{employeeID})
+	if err != nil {
+		return err
+	}
+	validIn := map[int][]string{}
+	for _, r := range records {
+		validIn[r.EmployeeLicenseID] = r.ValidIn
+	}
+
+	versions, err := issuedUnder(db, employeeID, userSub)
+	if err != nil {
+		return err
+	}
+
+	today := time.Now().Format(validation.DateLayout)
+	for i := range employeeLicenses {
+		lic := &employeeLicenses[i]
+		lic.InvalidDueTo = []licenses.Blocker{}
+		lic.ValidIn = validIn[lic.ID]
+		if lic.ValidIn == nil {
+			lic.ValidIn = []string{}
+		}
+		if v, ok := versions[lic.ID]; ok {
+			lic.LicenseVersion, lic.AppliedRule = &v.version, v.rule
+		}
+		switch blockers := invalid[lic.ID]; {
+		case lic.ExpDate < today:
+			lic.Status = "expired"
+		case len(blockers) > 0:
+			lic.Status = licenses.StatusInvalid
+			lic.InvalidDueTo = blockers
+		default:
+			lic.Status = "active"
+		}
+	}
+	return nil
+}
+
+type issued struct {
+	version int
+	rule    *expiration.Rule
+}
+
+// issuedUnder returns the license type version each of an employee's
+// licenses is pinned to, with the expiration rule it set.
+func issuedUnder(db *sql.DB, employeeID interface{}, userSub string) (map[int]issued, error) {
+	rows, err := db.Query(`
+        SELECT el.id, v.version, v.expirationRule, v.validityMonths
+        FROM employeeLicenses el
+        JOIN licenseVersions v on el.licenseVersionId = v.id
+        WHERE el.employeeId = ? and el.deleted IS NULL and el.createdBy = ?
+    `, employeeID, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]issued{}
+	for rows.Next() {
+		var id int
+		var v issued
+		var encoded sql.NullString
+		var validityMonths *int
+		if err := rows.Scan(&id, &v.version, &encoded, &validityMonths); err != nil {
+			return nil, err
+		}
+		if encoded.Valid {
+			v.rule = &expiration.Rule{}
+			if err := json.Unmarshal([]byte(encoded.String), v.rule); err != nil {
+				return nil, err
+			}
+		}
+		v.rule = expiration.Effective(v.rule, validityMonths)
+		versions[id] = v
+	}
+
+	return versions, rows.Err()
+}
+
+// allowEmployee checks that a manager is working on one of their reports.
+// Employees outside their subtree are reported as not found. It writes the
+// error response itself.
+func allowEmployee(db *sql.DB, c *gin.Context, employeeID interface{}) bool {
+	allowed, err := access.Allows(db, c, employeeID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return false
+	}
+	return true
+}
+
+// allowLicense is allowEmployee for the employee holding an employee
+// license. It also refuses changes to the licenses of offboarded employees,
+// which are kept as read-only history.
+func allowLicense(db *sql.DB, c *gin.Context, id string, userSub string) bool {
+	var employeeID int
+	var offboarded bool
+	err := db.QueryRow(`
+        SELECT el.employeeId, e.offboarded IS NOT NULL
+        FROM employeeLicenses el
+        JOIN employees e on el.employeeId = e.id
+        WHERE el.id = ? and el.deleted IS NULL and el.createdBy = ?
+    `, id, userSub).Scan(&employeeID, &offboarded)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "employee license not found"})
+		return false
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+		return false
+	}
+
+	if offboarded {
+		c.JSON(http.StatusConflict, gin.H{"error": errOffboarded})
+		return false
+	}
+
+	if !access.IsManager(c) {
+		return true
+	}
+
+	return allowEmployee(db, c, employeeID)
+}
+
+// record adds a timeline entry for the employee holding an employee license.
+func record(db utils.DB, id string, kind string, detail interface{}, userSub string) error {
+	var employeeID, licenseID int
+	err := db.QueryRow(`
+        SELECT employeeId, id FROM employeeLicenses WHERE id = ? and createdBy = ?
+    `, id, userSub).Scan(&employeeID, &licenseID)
+	if err != nil {
+		return err
+	}
+
+	return timeline.Record(db, userSub, timeline.Entry{
+		EmployeeID:        employeeID,
+		EmployeeLicenseID: &licenseID,
+		Kind:              kind,
+		Detail:            detail,
+	})
+}
+
+// checkMultistate makes sure only licenses of a compact license type are
+// marked multistate. It writes the 400 response itself.
+func checkMultistate(db *sql.DB, c *gin.Context, licenseID int, multistate bool, userSub string) bool {
+	if !multistate {
+		return true
+	}
+
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM licenses
+        WHERE id = ? and compact IS NOT NULL and deleted IS NULL and createdBy = ?
+    `, licenseID, userSub).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{"multistate": "license type is not part of a compact"}})
+		return false
+	}
+	return true
+}
+
+// resolveExpDate is expiration.Resolve for a handler: it returns the
+// date, whether it overrides the rule and the version to pin, and writes
+// the error response itself.
+func resolveExpDate(db utils.DB, c *gin.Context, employeeID int, licenseID int, issueDate string, expDate string, override bool, userSub string) (string, bool, int, bool) {
+	resolved, fields, err := expiration.Resolve(db, employeeID, licenseID, issueDate, expDate, override, userSub)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve expiration date"})
+		return "", false, 0, false
+	}
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return "", false, 0, false
+	}
+	return resolved.ExpDate, resolved.Overridden, resolved.VersionID, true
+}
@@ -0,0 +1,497 @@
+package employees
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// nameMatchThreshold is the minimum Jaro-Winkler similarity for two full
+// names to be reported as a likely duplicate.
+const nameMatchThreshold = 0.9
+
+type DuplicateMatch struct {
+	Employees []Employee `json:"employees"`
+	Reasons   []string   `json:"reasons"`
+	Score     float64    `json:"score"`
+}
+
+type MergeRequest struct {
+	SurvivorID  int `json:"survivorId" validate:"required,gt=0"`
+	DuplicateID int `json:"duplicateId" validate:"required,gt=0"`
+	// Fields picks which record wins for a conflicting field, keyed by the
+	// json field name with a value of "survivor" or "duplicate".
+	Fields map[string]string `json:"fields" validate:"dive,keys,oneof=firstName lastName phone1 email,endkeys,oneof=survivor duplicate"`
+}
+
+func (req *MergeRequest) Check() validation.FieldErrors {
+	if req.SurvivorID != 0 && req.SurvivorID == req.DuplicateID {
+		return validation.FieldErrors{"duplicateId": "must be a different employee than survivorId"}
+	}
+	return nil
+}
+
+func GetDuplicates(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	query := `
+        SELECT id, firstName, lastName, phone1, email
+        FROM employees
+        WHERE deleted IS NULL and offboarded IS NULL and createdBy = ?
+    `
+	rows, err := db.Query(query, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query employees"})
+		return
+	}
+	defer rows.Close()
+
+	var employees []Employee
+	for rows.Next() {
+		var emp Employee
+		if err := rows.Scan(
+			&emp.ID, &emp.FirstName, &emp.LastName, &emp.Phone1, &emp.Email,
+		); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan employee data"})
+			return
+		}
+		employees = append(employees, emp)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, findDuplicates(employees))
+}
+
+// findDuplicates compares every pair of employees and returns the pairs that
+// share an email or phone number or have near-identical names, best first.
+func findDuplicates(employees []Employee) []DuplicateMatch {
+	matches := []DuplicateMatch{}
+
+	for i := 0; i < len(employees); i++ {
+		a := employees[i]
+		for j := i + 1; j < len(employees); j++ {
+			b := employees[j]
+
+			var reasons []string
+			score := 0.0
+
+			if email := validation.NormalizeEmail(a.Email); email != "" && email == validation.NormalizeEmail(b.Email) {
+				reasons = append(reasons, "email")
+				score = 1
+			}
+
+			if phone := phoneDigits(a.Phone1); phone != "" && phone == phoneDigits(b.Phone1) {
+				reasons = append(reasons, "phone")
+				score = max(score, 0.9)
+			}
+
+			similarity := jaroWinkler(normalizeName(a), normalizeName(b))
+			if similarity >= nameMatchThreshold {
+				reasons = append(reasons, "name")
+				score = max(score, similarity*0.85)
+			}
+
+			if len(reasons) == 0 {
+				continue
+			}
+
+			matches = append(matches, DuplicateMatch{
+				Employees: []Employee{a, b},
+				Reasons:   reasons,
+				Score:     float64(round(score*100)) / 100,
+			})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	return matches
+}
+
+func Merge(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var req MergeRequest
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start merge"})
+		return
+	}
+	defer tx.Rollback()
+
+	getQuery := `
+        SELECT id, firstName, lastName, phone1, email
+        FROM employees
+        WHERE id = ? AND deleted IS NULL and offboarded IS NULL and createdBy = ?
+        FOR UPDATE
+    `
+
+	var survivor, duplicate Employee
+	for _, target := range []struct {
+		id  int
+		emp *Employee
+	}{{req.SurvivorID, &survivor}, {req.DuplicateID, &duplicate}} {
+		err := tx.QueryRow(getQuery, target.id, userSubStr).Scan(
+			&target.emp.ID,
+			&target.emp.FirstName,
+			&target.emp.LastName,
+			&target.emp.Phone1,
+			&target.emp.Email,
+		)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Employee %d not found", target.id)})
+			return
+		}
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+			return
+		}
+	}
+
+	// An employee has one SCIM identity, and two records from the same HRIS
+	// feed would both keep syncing into the survivor.
+	var scimCount, sharedSources int
+	err = tx.QueryRow(`
+        SELECT
+            ( SELECT COUNT(*) FROM scimUsers WHERE employeeId IN (?, ?) and createdBy = ? ),
+            ( SELECT COUNT(*) FROM employeeExternalIds s
+              JOIN employeeExternalIds d on d.source = s.source and d.createdBy = s.createdBy
+              WHERE s.employeeId = ? and d.employeeId = ? and s.createdBy = ? )
+    `, survivor.ID, duplicate.ID, userSubStr, survivor.ID, duplicate.ID, userSubStr).Scan(&scimCount, &sharedSources)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check external identities"})
+		return
+	}
+	if scimCount > 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Both employees are provisioned through SCIM; deprovision the duplicate first"})
+		return
+	}
+	if sharedSources > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Both employees are synced from the same HRIS connection; remove the duplicate there first"})
+		return
+	}
+
+	merged := reconcile(survivor, duplicate, req.Fields)
+
+	_, err = tx.Exec(`
+        UPDATE employees
+        SET firstName = ?, lastName = ?, phone1 = ?, email = ?
+        WHERE id = ?
+    `, merged.FirstName, merged.LastName, merged.Phone1, merged.Email, survivor.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update surviving employee"})
+		return
+	}
+
+	result, err := tx.Exec(`
+        UPDATE employeeLicenses
+        SET employeeId = ?
+        WHERE employeeId = ? and createdBy = ?
+    `, survivor.ID, duplicate.ID, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move employee licenses"})
+		return
+	}
+
+	licensesMoved, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	// License history follows the licenses to the survivor's timeline.
+	_, err = tx.Exec(`
+        UPDATE employeeActivity
+        SET employeeId = ?
+        WHERE employeeId = ? and employeeLicenseId IS NOT NULL and createdBy = ?
+    `, survivor.ID, duplicate.ID, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move employee license history"})
+		return
+	}
+
+	// CE counts towards the licenses it was earned for.
+	_, err = tx.Exec(`
+        UPDATE ceActivities
+        SET employeeId = ?
+        WHERE employeeId = ? and createdBy = ?
+    `, survivor.ID, duplicate.ID, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move CE activities"})
+		return
+	}
+
+	_, err = tx.Exec(`
+        INSERT IGNORE INTO employeeTags (employeeId, tagId)
+        SELECT ?, tagId
+        FROM employeeTags
+        WHERE employeeId = ?
+    `, survivor.ID, duplicate.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move employee tags"})
+		return
+	}
+
+	_, err = tx.Exec(`
+        INSERT IGNORE INTO employeeJurisdictions (employeeId, jurisdiction)
+        SELECT ?, jurisdiction
+        FROM employeeJurisdictions
+        WHERE employeeId = ?
+    `, survivor.ID, duplicate.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move employee jurisdictions"})
+		return
+	}
+
+	// Reports and manager logins follow the survivor. A survivor that
+	// reported to the duplicate would end up supervising itself, so that
+	// link is dropped.
+	for _, update := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE employees SET supervisorId = NULL WHERE id = ? and supervisorId = ?`, []interface{}{survivor.ID, duplicate.ID}},
+		{`UPDATE employees SET supervisorId = ? WHERE supervisorId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSubStr}},
+		{`UPDATE tenantUsers SET employeeId = ? WHERE employeeId = ? and tenant = ?`, []interface{}{survivor.ID, duplicate.ID, userSubStr}},
+	} {
+		if _, err := tx.Exec(update.query, update.args...); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move reporting lines"})
+			return
+		}
+	}
+
+	// Notes, documents, portal submissions and external identities move to
+	// the survivor so they outlive the duplicate and syncs stop updating it.
+	// The survivor's own placeholder wins when both have one for a license.
+	for _, update := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE notes SET employeeId = ? WHERE employeeId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSubStr}},
+		{`UPDATE documents SET employeeId = ? WHERE employeeId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSubStr}},
+		{`UPDATE pendingChanges SET employeeId = ? WHERE employeeId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSubStr}},
+		{`UPDATE IGNORE credentialPlaceholders SET employeeId = ? WHERE employeeId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSubStr}},
+		{`DELETE FROM credentialPlaceholders WHERE employeeId = ? and createdBy = ?`, []interface{}{duplicate.ID, userSubStr}},
+		{`UPDATE scimUsers SET employeeId = ? WHERE employeeId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSubStr}},
+		{`UPDATE employeeExternalIds SET employeeId = ? WHERE employeeId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSubStr}},
+	} {
+		if _, err := tx.Exec(update.query, update.args...); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move employee records"})
+			return
+		}
+	}
+
+	// Custom field values only fill gaps on the survivor.
+	_, err = tx.Exec(`
+        INSERT IGNORE INTO employeeCustomFieldValues (employeeId, fieldId, value)
+        SELECT ?, fieldId, value
+        FROM employeeCustomFieldValues
+        WHERE employeeId = ?
+    `, survivor.ID, duplicate.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move custom field values"})
+		return
+	}
+
+	_, err = tx.Exec(`
+        UPDATE employees
+        SET deleted = current_timestamp()
+        WHERE id = ?
+    `, duplicate.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete duplicate employee"})
+		return
+	}
+
+	survivorBefore, _ := json.Marshal(survivor)
+	duplicateBefore, _ := json.Marshal(duplicate)
+
+	_, err = tx.Exec(`
+        INSERT INTO employeeMerges (
+            survivorId, duplicateId, survivorBefore, duplicateBefore,
+            licensesMoved, createdBy
+        ) VALUES (?, ?, ?, ?, ?, ?)
+    `, survivor.ID, duplicate.ID, survivorBefore, duplicateBefore, licensesMoved, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record merge"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit merge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Employees merged successfully",
+		"employee":      merged,
+		"licensesMoved": licensesMoved,
+	})
+}
+
+// reconcile builds the surviving record. A field takes the duplicate's value
+// when the caller asked for it or when the survivor has nothing there.
+func reconcile(survivor, duplicate Employee, fields map[string]string) Employee {
+	pick := func(field, survivorValue, duplicateValue string) string {
+		if fields[field] == "duplicate" {
+			return duplicateValue
+		}
+		if strings.TrimSpace(survivorValue) == "" {
+			return duplicateValue
+		}
+		return survivorValue
+	}
+
+	merged := survivor
+	merged.FirstName = pick("firstName", survivor.FirstName, duplicate.FirstName)
+	merged.LastName = pick("lastName", survivor.LastName, duplicate.LastName)
+	merged.Phone1 = pick("phone1", survivor.Phone1, duplicate.Phone1)
+	merged.Email = pick("email", survivor.Email, duplicate.Email)
+
+	return merged
+}
+
+// phoneDigits keeps the last ten digits so that "+1 (555) 123-4567" and
+// "555.123.4567" compare equal.
+func phoneDigits(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+
+	if len(digits) < 7 {
+		return ""
+	}
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return digits
+}
+
+func normalizeName(emp Employee) string {
+	name := strings.ToLower(emp.FirstName + " " + emp.LastName)
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}), " ")
+}
+
+// jaroWinkler returns a similarity between 0 and 1 that favours strings
+// sharing a common prefix, which suits typos and truncated first names.
+func jaroWinkler(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	s1, s2 := []rune(a), []rune(b)
+	window := max(len(s1), len(s2))/2 - 1
+	window = max(window, 0)
+
+	matched1 := make([]bool, len(s1))
+	matched2 := make([]bool, len(s2))
+	matches := 0
+
+	for i := range s1 {
+		start := max(0, i-window)
+		end := min(len(s2), i+window+1)
+		for j := start; j < end; j++ {
+			if matched2[j] || s1[i] != s2[j] {
+				continue
+			}
+			matched1[i] = true
+			matched2[j] = true
+			matches++
+			break
+		}
+	}
+
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	k := 0
+	for i := range s1 {
+		if !matched1[i] {
+			continue
+		}
+		for !matched2[k] {
+			k++
+		}
+		if s1[i] != s2[k] {
+			transpositions++
+		}
+		k++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(s1)) + m/float64(len(s2)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for i := 0; i < min(4, len(s1), len(s2)); i++ {
+		if s1[i] != s2[i] {
+			break
+		}
+		prefix++
+	}
+
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+func round(num float64) int {
+	if num < 0 {
+		return int(num - 0.5)
+	}
+	return int(num + 0.5)
+}
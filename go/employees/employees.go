@@ -4,19 +4,60 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
-
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/customfields"
+	"github.com/benfortenberry/accredi-track/groups"
+	"github.com/benfortenberry/accredi-track/orgunits"
+	"github.com/benfortenberry/accredi-track/requirements"
 	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
 	"github.com/gin-gonic/gin"
 )
 
 type Employee struct {
 	ID           int    `json:"id"`
-	FirstName    string `json:"firstName"`
-	LastName     string `json:"lastName"`
-	Phone1       string `json:"phone1"`
-	Email        string `json:"email"`
-	Status       string `json:"status"`
-	LicenseCount int    `json:"licenseCount"`
+	FirstName    string `json:"firstName" validate:"required,max=100"`
+	LastName     string `json:"lastName" validate:"required,max=100"`
+	Phone1       string `json:"phone1" validate:"omitempty,phone"`
+	Email        string `json:"email" validate:"omitempty,email,max=255"`
+	JobTitle     string `json:"jobTitle" validate:"max=100"`
+	LocationID   *int   `json:"locationId" validate:"omitempty,gt=0"`
+	DepartmentID *int   `json:"departmentId" validate:"omitempty,gt=0"`
+	SupervisorID *int   `json:"supervisorId" validate:"omitempty,gt=0"`
+	// BirthDate is used by license types that expire in the birth month.
+	BirthDate    *string `json:"birthDate" validate:"omitempty,datetime=2006-01-02"`
+	Status       string  `json:"status"`
+	LicenseCount int     `json:"licenseCount"`
+	// The separation fields are set by POST /employees/:id/offboard and
+	// ignored here on write.
+	SeparationDate   *string `json:"separationDate"`
+	SeparationReason *string `json:"separationReason"`
+	Offboarded       *string `json:"offboarded"`
+	// CustomFields holds the tenant-defined attributes keyed by field key.
+	CustomFields map[string]interface{} `json:"customFields"`
+	// Tags are managed through PUT /employees/:id/tags and ignored here on
+	// write.
+	Tags []string `json:"tags"`
+}
+
+// Normalize trims names and converts the email and phone to their canonical
+// forms before validation.
+func (emp *Employee) Normalize() {
+	emp.FirstName = strings.TrimSpace(emp.FirstName)
+	emp.LastName = strings.TrimSpace(emp.LastName)
+	emp.JobTitle = strings.TrimSpace(emp.JobTitle)
+	emp.Email = validation.NormalizeEmail(emp.Email)
+	emp.Phone1 = validation.NormalizePhone(emp.Phone1)
+	if emp.BirthDate != nil {
+		birthDate := validation.NormalizeDate(*emp.BirthDate)
+		emp.BirthDate = &birthDate
+		if birthDate == "" {
+			emp.BirthDate = nil
+		}
+	}
 }
 
 func Get(db *sql.DB, c *gin.Context) {
@@ -27,6 +68,18 @@ func Get(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	employees, ok := list(db, c, userSubStr)
+	if !ok {
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, employees)
+}
+
+// list runs the employee list query with the filters in the query string
+// and attaches custom field values. It writes the error response itself.
+func list(db *sql.DB, c *gin.Context, userSubStr string) ([]Employee, bool) {
+
 	var employees []Employee
 	query := (`
 	SELECT 
@@ -35,7 +88,16 @@ func Get(db *sql.DB, c *gin.Context) {
     e.lastName,
     e.phone1,
     e.email,
+    e.jobTitle,
+    e.locationId,
+    e.departmentId,
+    e.supervisorId,
+    e.birthDate,
+    e.separationDate,
+    e.separationReason,
+    e.offboarded,
     CASE 
+        WHEN e.offboarded IS NOT NULL THEN 'Offboarded'
         WHEN EXISTS (
             SELECT 1 
             FROM employeeLicenses el 
@@ -43,6 +105,12 @@ func Get(db *sql.DB, c *gin.Context) {
               AND el.expDate < CURDATE() 
               AND el.deleted IS NULL
         ) THEN 'Expired'
+        WHEN EXISTS (
+            SELECT 1
+            FROM credentialPlaceholders p
+            WHERE p.employeeId = e.id
+              AND p.status = 'missing'
+        ) THEN 'Missing'
         ELSE 'Active'
     END AS status,
 	( SELECT COUNT(*) AS cnt
@@ -50,11 +118,77 @@ FROM employeeLicenses el where el.employeeId = e.id and el.deleted is null ) as
 FROM 
     employees e
 where e.deleted is null and createdBy = ? `)
-	rows, err := db.Query(query, userSubStr)
+
+	args := []interface{}{userSubStr}
+
+	// Offboarded employees are kept as history and only listed on request.
+	if c.Query("offboarded") == "true" {
+		query += " and e.offboarded is not null"
+	} else {
+		query += " and e.offboarded is null"
+	}
+
+	accessScope, accessArgs := access.Scope(c, "e.id")
+	query += accessScope
+	args = append(args, accessArgs...)
+
+	scope, scopeArgs, err := orgunits.Scope(db, c, "e.id")
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location or department"})
+		return nil, false
+	}
+	query += scope
+	args = append(args, scopeArgs...)
+
+	filter, filterArgs, err := customfields.Filter(db, c, userSubStr, "e.id")
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	query += filter
+	args = append(args, filterArgs...)
+
+	groupFilter, groupArgs, err := groups.Filter(db, c, "e.id")
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	query += groupFilter
+	args = append(args, groupArgs...)
+
+	values, err := customfields.Load(db, userSubStr, 0)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query custom field values"})
+		return nil, false
+	}
+
+	tags, err := groups.LoadTags(db, userSubStr, 0)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query employee tags"})
+		return nil, false
+	}
+
+	gaps, err := requirements.Find(db, userSubStr, accessScope, accessArgs)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query requirement gaps"})
+		return nil, false
+	}
+	missing := map[int]bool{}
+	for _, gap := range gaps {
+		missing[gap.EmployeeID] = true
+	}
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query employees"})
-		return
+		return nil, false
 	}
 	defer rows.Close()
 
@@ -63,11 +197,20 @@ where e.deleted is null and createdBy = ? `)
 		if err := rows.Scan(
 			&emp.ID, &emp.FirstName, &emp.LastName,
 
-			&emp.Phone1, &emp.Email, &emp.Status, &emp.LicenseCount,
+			&emp.Phone1, &emp.Email, &emp.JobTitle, &emp.LocationID, &emp.DepartmentID,
+			&emp.SupervisorID, &emp.BirthDate, &emp.SeparationDate, &emp.SeparationReason, &emp.Offboarded,
+			&emp.Status, &emp.LicenseCount,
 		); err != nil {
 			fmt.Println("Error: ", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan employee data"})
-			return
+			return nil, false
+		}
+		emp.CustomFields = withDefault(values[emp.ID])
+		emp.Tags = withoutNil(tags[emp.ID])
+
+		// Required licenses never added don't show up in the query.
+		if emp.Status == "Active" && missing[emp.ID] {
+			emp.Status = "Missing"
 		}
 
 		//encodedID := encoding.EncodeID(emp.ID)
@@ -80,10 +223,27 @@ where e.deleted is null and createdBy = ? `)
 	if err := rows.Err(); err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
-		return
+		return nil, false
 	}
 
-	c.IndentedJSON(http.StatusOK, employees)
+	return employees, true
+}
+
+// withoutNil keeps tags an array in responses.
+func withoutNil(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// withDefault keeps customFields an object in responses even when an
+// employee has no values yet.
+func withDefault(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return map[string]interface{}{}
+	}
+	return values
 }
 
 func GetSingle(db *sql.DB, c *gin.Context) {
@@ -97,9 +257,21 @@ func GetSingle(db *sql.DB, c *gin.Context) {
 	// Get the employee ID from the URL parameter
 	id := c.Param("id")
 
+	allowed, err := access.Allows(db, c, id)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
 	// Prepare the SQL query to retrieve the employee
 	query := `
-        SELECT id, firstName, lastName, phone1, email
+        SELECT id, firstName, lastName, phone1, email, jobTitle, locationId, departmentId, supervisorId,
+            birthDate, separationDate, separationReason, offboarded
         FROM employees
         WHERE id = ? AND deleted IS NULL and createdBy = ?
     `
@@ -108,12 +280,20 @@ func GetSingle(db *sql.DB, c *gin.Context) {
 	var emp Employee
 
 	// Execute the query
-	err := db.QueryRow(query, id, userSubStr).Scan(
+	err = db.QueryRow(query, id, userSubStr).Scan(
 		&emp.ID,
 		&emp.FirstName,
 		&emp.LastName,
 		&emp.Phone1,
 		&emp.Email,
+		&emp.JobTitle,
+		&emp.LocationID,
+		&emp.DepartmentID,
+		&emp.SupervisorID,
+		&emp.BirthDate,
+		&emp.SeparationDate,
+		&emp.SeparationReason,
+		&emp.Offboarded,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -127,6 +307,22 @@ func GetSingle(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	values, err := customfields.Load(db, userSubStr, emp.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee custom fields"})
+		return
+	}
+	emp.CustomFields = withDefault(values[emp.ID])
+
+	tags, err := groups.LoadTags(db, userSubStr, emp.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee tags"})
+		return
+	}
+	emp.Tags = withoutNil(tags[emp.ID])
+
 	// Respond with the employee data
 	c.JSON(http.StatusOK, emp)
 }
@@ -141,34 +337,43 @@ func Post(db *sql.DB, c *gin.Context) {
 	}
 
 	var emp Employee
-	if err := c.BindJSON(&emp); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if !validation.Bind(c, &emp) {
 		return
 	}
 
-	// Prepare the SQL statement for inserting an employee
-	query := `
-        INSERT INTO employees (
-            firstName, lastName, 
-            phone1, email, createdBy
-        ) VALUES (?, ?, ?, ?, ?)
-    `
+	if !checkPlacement(db, c, emp, 0, userSubStr) {
+		return
+	}
 
-	// Execute the query
-	result, err := db.Exec(query,
-		emp.FirstName, emp.LastName, emp.Phone1, emp.Email, userSubStr,
-	)
+	customValues, ok := checkCustomFields(db, c, emp, userSubStr)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert employee"})
 		return
 	}
+	defer tx.Rollback()
 
-	// Get the ID of the newly inserted employee
-	id, err := result.LastInsertId()
+	id, err := Insert(tx, emp, userSubStr)
 	if err != nil {
 		fmt.Println("Error: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted employee ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert employee"})
+		return
+	}
+
+	if err := customfields.Save(tx, id, customValues); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save employee custom fields"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert employee"})
 		return
 	}
 
@@ -178,41 +383,42 @@ func Post(db *sql.DB, c *gin.Context) {
 
 func Delete(db *sql.DB, c *gin.Context) {
 
-	_, ok := utils.GetUserSub(c)
+	userSubStr, ok := utils.GetUserSub(c)
 	if !ok {
 		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
 		return
 	}
 
 	// Get the employee ID from the URL parameter
-	id := c.Param("id")
+	employeeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
 
-	// Prepare the SQL statement for deleting an employee
-	query := `
-        UPDATE employees
-        SET deleted = current_timestamp()
-        WHERE id = ?;
-    `
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete employee"})
+		return
+	}
+	defer tx.Rollback()
 
-	// Execute the query
-	_, err := db.Exec(query, id)
+	found, err := SoftDelete(tx, employeeID, userSubStr)
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete employee"})
 		return
 	}
 
-	queryEmployeeLicenses := `
-        UPDATE employeeLicenses
-        SET deleted = current_timestamp()
-        WHERE employeeId = ?;
-    `
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
 
-	// Execute the query
-	_, err2 := db.Exec(queryEmployeeLicenses, id)
-	if err2 != nil {
+	if err := tx.Commit(); err != nil {
 		fmt.Println("Error: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete employee licenses"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete employee"})
 		return
 	}
 
@@ -222,7 +428,7 @@ func Delete(db *sql.DB, c *gin.Context) {
 
 func Put(db *sql.DB, c *gin.Context) {
 
-	_, ok := utils.GetUserSub(c)
+	userSubStr, ok := utils.GetUserSub(c)
 	if !ok {
 		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
 		return
@@ -230,35 +436,73 @@ func Put(db *sql.DB, c *gin.Context) {
 
 	// Get the employee ID from the URL parameter
 	id := c.Param("id")
+	employeeID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
 
 	// Bind the JSON payload to an Employee struct
 	var emp Employee
-	if err := c.BindJSON(&emp); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if !validation.Bind(c, &emp) {
 		return
 	}
 
-	// Prepare the SQL statement for updating an employee
-	query := `
-        UPDATE employees
-        SET firstName = ?, lastName = ?, phone1 = ?, email = ?
-        WHERE id = ?
-    `
+	var offboarded bool
+	err = db.QueryRow(`SELECT offboarded IS NOT NULL FROM employees WHERE id = ? and deleted IS NULL and createdBy = ?`, id, userSubStr).Scan(&offboarded)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+	if offboarded {
+		c.JSON(http.StatusConflict, gin.H{"error": "Employee has been offboarded"})
+		return
+	}
 
-	// Execute the query
-	_, err := db.Exec(query,
-		emp.FirstName, emp.LastName, emp.Phone1, emp.Email, id,
-	)
+	if !checkPlacement(db, c, emp, employeeID, userSubStr) {
+		return
+	}
+
+	customValues, ok := checkCustomFields(db, c, emp, userSubStr)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee"})
 		return
 	}
+	defer tx.Rollback()
+
+	if err := Update(tx, employeeID, emp, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee"})
+		return
+	}
+
+	if err := customfields.Save(tx, employeeID, customValues); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save employee custom fields"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee"})
+		return
+	}
 
 	// Query the updated employee data
 	var updatedEmployee Employee
 	getQuery := `
-		 SELECT id, firstName, lastName, phone1, email
+		 SELECT id, firstName, lastName, phone1, email, jobTitle, locationId, departmentId, supervisorId, birthDate
 		 FROM employees
 		 WHERE id = ?
 	 `
@@ -268,6 +512,11 @@ func Put(db *sql.DB, c *gin.Context) {
 		&updatedEmployee.LastName,
 		&updatedEmployee.Phone1,
 		&updatedEmployee.Email,
+		&updatedEmployee.JobTitle,
+		&updatedEmployee.LocationID,
+		&updatedEmployee.DepartmentID,
+		&updatedEmployee.SupervisorID,
+		&updatedEmployee.BirthDate,
 	)
 	if err != nil {
 		fmt.Println("Error: ", err)
@@ -275,7 +524,92 @@ func Put(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	values, err := customfields.Load(db, userSubStr, updatedEmployee.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee custom fields"})
+		return
+	}
+	updatedEmployee.CustomFields = withDefault(values[updatedEmployee.ID])
+
+	tags, err := groups.LoadTags(db, userSubStr, updatedEmployee.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee tags"})
+		return
+	}
+	updatedEmployee.Tags = withoutNil(tags[updatedEmployee.ID])
+
 	// Respond with the updated employee data
 	c.JSON(http.StatusOK, updatedEmployee)
 
 }
+
+// checkPlacement makes sure the location, department and supervisor an
+// employee is being assigned to belong to the tenant, and that the
+// supervisor doesn't report to the employee. id is 0 for a new employee. It
+// writes the 400 itself.
+func checkPlacement(db *sql.DB, c *gin.Context, emp Employee, id int64, userSub string) bool {
+	fields := validation.FieldErrors{}
+
+	for _, placement := range []struct {
+		field string
+		kind  orgunits.Kind
+		id    *int
+	}{
+		{"locationId", orgunits.Location, emp.LocationID},
+		{"departmentId", orgunits.Department, emp.DepartmentID},
+	} {
+		if placement.id == nil {
+			continue
+		}
+
+		exists, err := orgunits.Exists(db, placement.kind, *placement.id, userSub)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate employee placement"})
+			return false
+		}
+		if !exists {
+			fields[placement.field] = "does not exist"
+		}
+	}
+
+	if emp.SupervisorID != nil {
+		problem, err := checkSupervisor(db, id, int64(*emp.SupervisorID), userSub)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate employee placement"})
+			return false
+		}
+		if problem != "" {
+			fields["supervisorId"] = problem
+		}
+	}
+
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return false
+	}
+
+	return true
+}
+
+// checkCustomFields validates the submitted custom field values against the
+// tenant's definitions. It writes the 400 itself.
+func checkCustomFields(db *sql.DB, c *gin.Context, emp Employee, userSub string) (map[int]string, bool) {
+	defs, err := customfields.Definitions(db, userSub)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate employee custom fields"})
+		return nil, false
+	}
+
+	values, fields := customfields.Check(defs, emp.CustomFields)
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return nil, false
+	}
+
+	return values, true
+}
@@ -0,0 +1,69 @@
+package employees
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/benfortenberry/accredi-track/customfields"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Export writes the employee list as CSV, one column per custom field after
+// the standard ones. It accepts the same filters as Get.
+func Export(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	defs, err := customfields.Definitions(db, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query custom fields"})
+		return
+	}
+
+	employees, ok := list(db, c, userSubStr)
+	if !ok {
+		return
+	}
+
+	header := []string{"id", "firstName", "lastName", "phone1", "email", "jobTitle", "status", "licenseCount"}
+	for _, def := range defs {
+		header = append(header, def.Label)
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="employees.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(header)
+
+	for _, emp := range employees {
+		record := []string{
+			strconv.Itoa(emp.ID), emp.FirstName, emp.LastName, emp.Phone1, emp.Email,
+			emp.JobTitle, emp.Status, strconv.Itoa(emp.LicenseCount),
+		}
+		for _, def := range defs {
+			value, ok := emp.CustomFields[def.Key]
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, fmt.Sprint(value))
+		}
+		w.Write(record)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Println("Error: ", err)
+	}
+}
@@ -0,0 +1,144 @@
+package employees
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/events"
+	"github.com/benfortenberry/accredi-track/timeline"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// EventOffboarded is emitted when an employee is offboarded.
+const EventOffboarded = "employee.offboarded"
+
+// Separation is the body accepted by PostOffboard.
+type Separation struct {
+	SeparationDate string `json:"separationDate" validate:"required,datetime=2006-01-02"`
+	Reason         string `json:"reason" validate:"required,max=500"`
+}
+
+func (sep *Separation) Normalize() {
+	sep.SeparationDate = validation.NormalizeDate(sep.SeparationDate)
+	sep.Reason = strings.TrimSpace(sep.Reason)
+}
+
+// Offboard records an employee's departure. Unlike SoftDelete the employee
+// and their licenses stay on file as read-only history; they drop out of
+// lists and metrics, outstanding onboarding placeholders are waived and
+// portal submissions still waiting for review are rejected. It returns false
+// when there is no active employee with that ID. Run it in a transaction.
+func Offboard(db utils.DB, id int64, sep Separation, userSub string) (bool, error) {
+	result, err := db.Exec(`
+        UPDATE employees
+        SET separationDate = ?, separationReason = ?, offboarded = current_timestamp()
+        WHERE id = ? and deleted IS NULL and offboarded IS NULL and createdBy = ?
+    `, sep.SeparationDate, sep.Reason, id, userSub)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return false, err
+	}
+
+	_, err = db.Exec(`
+        UPDATE credentialPlaceholders
+        SET status = 'waived'
+        WHERE employeeId = ? and status = 'missing'
+    `, id)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = db.Exec(`
+        UPDATE pendingChanges
+        SET status = 'rejected', reviewNote = 'Employee offboarded', reviewed = current_timestamp()
+        WHERE employeeId = ? and status = 'pending' and createdBy = ?
+    `, id, userSub)
+	if err != nil {
+		return false, err
+	}
+
+	var firstName, lastName, email string
+	err = db.QueryRow(`
+        SELECT firstName, lastName, email FROM employees WHERE id = ?
+    `, id).Scan(&firstName, &lastName, &email)
+	if err != nil {
+		return false, err
+	}
+
+	err = timeline.Record(db, userSub, timeline.Entry{
+		EmployeeID: int(id),
+		Kind:       timeline.EmployeeOffboarded,
+		Detail:     gin.H{"separationDate": sep.SeparationDate, "separationReason": sep.Reason},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = events.Emit(db, userSub, EventOffboarded, gin.H{
+		"employeeId":       id,
+		"firstName":        firstName,
+		"lastName":         lastName,
+		"email":            email,
+		"separationDate":   sep.SeparationDate,
+		"separationReason": sep.Reason,
+	})
+	return err == nil, err
+}
+
+// PostOffboard records a separation date and reason for an employee and
+// takes them out of active use. See Offboard.
+func PostOffboard(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	employeeID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var sep Separation
+	if !validation.Bind(c, &sep) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to offboard employee"})
+		return
+	}
+	defer tx.Rollback()
+
+	found, err := Offboard(tx, employeeID, sep, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to offboard employee"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found or already offboarded"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to offboard employee"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Employee offboarded successfully"})
+}
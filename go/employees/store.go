@@ -0,0 +1,257 @@
+package employees
+
+import (
+	"database/sql"
+
+	"github.com/benfortenberry/accredi-track/onboarding"
+	"github.com/benfortenberry/accredi-track/timeline"
+	"github.com/benfortenberry/accredi-track/utils"
+)
+
+// Insert adds an employee for the tenant and returns its ID, creating the
+// onboarding placeholders their job title and department call for. Custom
+// fields and tags are saved separately.
+func Insert(db utils.DB, emp Employee, userSub string) (int64, error) {
+	// Prepare the SQL statement for inserting an employee
+	query := `
+        INSERT INTO employees (
+            firstName, lastName, 
+            phone1, email, jobTitle,
+            locationId, departmentId, supervisorId, birthDate, createdBy
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+	// Execute the query
+	result, err := db.Exec(query,
+		emp.FirstName, emp.LastName, emp.Phone1, emp.Email, emp.JobTitle,
+		emp.LocationID, emp.DepartmentID, emp.SupervisorID, emp.BirthDate, userSub,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = timeline.Record(db, userSub, timeline.Entry{EmployeeID: int(id), Kind: timeline.EmployeeCreated})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, onboarding.Apply(db, id, userSub)
+}
+
+// Update overwrites the profile fields of one of the tenant's employees,
+// records what changed on their timeline and re-applies onboarding templates
+// in case the job title or department changed.
+func Update(db utils.DB, id int64, emp Employee, userSub string) error {
+	var before Employee
+	err := db.QueryRow(`
+        SELECT firstName, lastName, phone1, email, jobTitle, locationId, departmentId, supervisorId, birthDate
+        FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSub).Scan(
+		&before.FirstName, &before.LastName, &before.Phone1, &before.Email,
+		&before.JobTitle, &before.LocationID, &before.DepartmentID, &before.SupervisorID,
+		&before.BirthDate,
+	)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Prepare the SQL statement for updating an employee
+	query := `
+        UPDATE employees
+        SET firstName = ?, lastName = ?, phone1 = ?, email = ?,
+            jobTitle = ?, locationId = ?, departmentId = ?, supervisorId = ?, birthDate = ?
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `
+
+	// Execute the query
+	_, err = db.Exec(query,
+		emp.FirstName, emp.LastName, emp.Phone1, emp.Email,
+		emp.JobTitle, emp.LocationID, emp.DepartmentID, emp.SupervisorID, emp.BirthDate, id, userSub,
+	)
+	if err != nil {
+		return err
+	}
+
+	if changed := changes(before, emp); len(changed) > 0 {
+		err := timeline.Record(db, userSub, timeline.Entry{
+			EmployeeID: int(id),
+			Kind:       timeline.EmployeeUpdated,
+			Detail:     changed,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return onboarding.Apply(db, id, userSub)
+}
+
+// Change is one profile field's old and new value in an employee.updated
+// timeline entry.
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// changes lists the profile fields that differ between before and after,
+// keyed by their JSON names.
+func changes(before, after Employee) map[string]Change {
+	changed := map[string]Change{}
+	text := func(field, from, to string) {
+		if from != to {
+			changed[field] = Change{from, to}
+		}
+	}
+	ref := func(field string, from, to *int) {
+		if from == nil && to == nil || from != nil && to != nil && *from == *to {
+			return
+		}
+		changed[field] = Change{from, to}
+	}
+
+	text("firstName", before.FirstName, after.FirstName)
+	text("lastName", before.LastName, after.LastName)
+	text("phone1", before.Phone1, after.Phone1)
+	text("email", before.Email, after.Email)
+	text("jobTitle", before.JobTitle, after.JobTitle)
+	ref("locationId", before.LocationID, after.LocationID)
+	ref("departmentId", before.DepartmentID, after.DepartmentID)
+	ref("supervisorId", before.SupervisorID, after.SupervisorID)
+	if before.BirthDate != nil || after.BirthDate != nil {
+		from, to := "", ""
+		if before.BirthDate != nil {
+			from = *before.BirthDate
+		}
+		if after.BirthDate != nil {
+			to = *after.BirthDate
+		}
+		text("birthDate", from, to)
+	}
+	return changed
+}
+
+// SoftDelete moves an employee and their licenses to the trash. It returns
+// false when the employee doesn't exist or is already deleted. Run it in a
+// transaction so both updates land together.
+func SoftDelete(db utils.DB, id int64, userSub string) (bool, error) {
+	// Prepare the SQL statement for deleting an employee
+	query := `
+        UPDATE employees
+        SET deleted = current_timestamp()
+        WHERE id = ? and deleted IS NULL and createdBy = ?;
+    `
+
+	// Execute the query
+	result, err := db.Exec(query, id, userSub)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return false, err
+	}
+
+	// Stamp the licenses with the employee's own deleted time so a restore
+	// can tell which ones went to the trash with it.
+	queryEmployeeLicenses := `
+        UPDATE employeeLicenses el
+        JOIN employees e on el.employeeId = e.id
+        SET el.deleted = e.deleted
+        WHERE el.employeeId = ? and el.deleted IS NULL;
+    `
+
+	// Execute the query
+	_, err = db.Exec(queryEmployeeLicenses, id)
+	return err == nil, err
+}
+
+// Restore brings an employee back from the trash along with the licenses
+// that were deleted in the same operation. It returns how many licenses came
+// back and false when there is no deleted employee with that ID. Run it in a
+// transaction.
+func Restore(db utils.DB, id int64, userSub string) (int64, bool, error) {
+	// Licenses have to be matched before the employee's deleted stamp is
+	// cleared.
+	result, err := db.Exec(`
+        UPDATE employeeLicenses el
+        JOIN employees e on el.employeeId = e.id
+        SET el.deleted = NULL
+        WHERE e.id = ? and e.createdBy = ? and e.deleted IS NOT NULL
+          and el.deleted = e.deleted
+    `, id, userSub)
+	if err != nil {
+		return 0, false, err
+	}
+
+	licensesRestored, err := result.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+
+	result, err = db.Exec(`
+        UPDATE employees
+        SET deleted = NULL
+        WHERE id = ? and createdBy = ? and deleted IS NOT NULL
+    `, id, userSub)
+	if err != nil {
+		return 0, false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return 0, false, err
+	}
+
+	return licensesRestored, true, nil
+}
+
+// checkSupervisor returns why supervisorID can't supervise employee id, or
+// an empty string if it can. Pass id 0 for an employee not yet created.
+func checkSupervisor(db *sql.DB, id int64, supervisorID int64, userSub string) (string, error) {
+	if supervisorID == id {
+		return "can't be the employee themselves", nil
+	}
+
+	var exists bool
+	err := db.QueryRow(`
+        SELECT COUNT(*) > 0 FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, supervisorID, userSub).Scan(&exists)
+	if err != nil || !exists {
+		return "does not exist", err
+	}
+
+	if id == 0 {
+		return "", nil
+	}
+
+	// Walk up from the proposed supervisor; meeting the employee on the way
+	// means the change would close a loop.
+	var loops bool
+	err = db.QueryRow(`
+        WITH RECURSIVE chain AS (
+            SELECT id, supervisorId FROM employees WHERE id = ? and createdBy = ?
+            UNION
+            SELECT e.id, e.supervisorId FROM employees e JOIN chain on e.id = chain.supervisorId
+        )
+        SELECT COUNT(*) > 0 FROM chain WHERE id = ?
+    `, supervisorID, userSub, id).Scan(&loops)
+	if err != nil {
+		return "", err
+	}
+	if loops {
+		return "reports to this employee", nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLimit caps how many events Get returns without ?limit.
+const defaultLimit = 100
+
+// Event is an entry in the tenant's outbox. Integrations poll Get with the
+// last ID they processed to pick up new ones in order.
+type Event struct {
+	ID      int             `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	Created string          `json:"created"`
+}
+
+// Emit records an event. Run it in the same transaction as the change it
+// describes so the two can't disagree.
+func Emit(db utils.DB, userSub string, eventType string, payload interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+        INSERT INTO events (type, payload, createdBy)
+        VALUES (?, ?, ?)
+    `, eventType, encoded, userSub)
+	return err
+}
+
+// Get lists events after ?after (an event ID, default 0), oldest first.
+// ?type narrows it to one event type.
+func Get(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	after, err := strconv.Atoi(c.DefaultQuery("after", "0"))
+	if err != nil || after < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after must be an event id"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit <= 0 || limit > defaultLimit {
+		limit = defaultLimit
+	}
+
+	query := `
+        SELECT id, type, payload, created
+        FROM events
+        WHERE createdBy = ? and id > ?`
+	args := []interface{}{userSubStr, after}
+
+	if eventType := c.Query("type"); eventType != "" {
+		query += " and type = ?"
+		args = append(args, eventType)
+	}
+
+	query += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query events"})
+		return
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var payload string
+		if err := rows.Scan(&event.ID, &event.Type, &payload, &event.Created); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan event data"})
+			return
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, events)
+}
@@ -0,0 +1,132 @@
+package expiration
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/validation"
+)
+
+// Rule kinds.
+const (
+	// Term expires a fixed number of months after issue.
+	Term = "term"
+	// BirthMonth expires at the end of the holder's birth month, Years
+	// after the year of issue.
+	BirthMonth = "birthMonth"
+	// Biennial expires on Month/Day of the next odd or even year.
+	Biennial = "biennial"
+	// Annual expires on the next Month/Day.
+	Annual = "annual"
+)
+
+// ErrNoBirthDate is returned when a birth month rule is applied to someone
+// without a birth date on file.
+var ErrNoBirthDate = errors.New("the employee's birthDate is needed to work out this expiration date")
+
+// Rule describes how a license type's expiration date follows from its
+// issue date. MinMonths keeps biennial and annual renewals from expiring
+// within a few months of issue; the date rolls over to the next cycle
+// instead.
+type Rule struct {
+	Kind      string `json:"kind" validate:"required,oneof=term birthMonth biennial annual"`
+	Months    int    `json:"months,omitempty" validate:"gte=0,lte=600"`
+	Years     int    `json:"years,omitempty" validate:"gte=0,lte=10"`
+	Parity    string `json:"parity,omitempty" validate:"omitempty,oneof=odd even"`
+	Month     int    `json:"month,omitempty" validate:"gte=0,lte=12"`
+	Day       int    `json:"day,omitempty" validate:"gte=0,lte=31"`
+	MinMonths int    `json:"minMonths,omitempty" validate:"gte=0,lte=24"`
+}
+
+// Check reports the fields each kind of rule needs. prefix is the json name
+// the rule sits under in the request.
+func (rule Rule) Check(prefix string) validation.FieldErrors {
+	fields := validation.FieldErrors{}
+	require := func(field string, value int) {
+		if value == 0 {
+			fields[prefix+"."+field] = "is required for " + rule.Kind + " rules"
+		}
+	}
+
+	switch rule.Kind {
+	case Term:
+		require("months", rule.Months)
+	case BirthMonth:
+		require("years", rule.Years)
+	case Biennial, Annual:
+		require("month", rule.Month)
+		require("day", rule.Day)
+		if rule.Kind == Biennial && rule.Parity == "" {
+			fields[prefix+".parity"] = "is required for biennial rules"
+		}
+	}
+
+	return fields
+}
+
+// NeedsBirthDate reports whether Compute needs the holder's birth date.
+func (rule Rule) NeedsBirthDate() bool {
+	return rule.Kind == BirthMonth
+}
+
+// Compute returns the expiration date the rule gives a license issued on
+// issued. birthDate is only used by birth month rules and may be nil
+// otherwise.
+func (rule Rule) Compute(issued time.Time, birthDate *time.Time) (time.Time, error) {
+	switch rule.Kind {
+	case Term:
+		return addMonths(issued, rule.Months), nil
+
+	case BirthMonth:
+		if birthDate == nil {
+			return time.Time{}, ErrNoBirthDate
+		}
+		return endOfMonth(issued.Year()+rule.Years, birthDate.Month()), nil
+
+	case Biennial, Annual:
+		earliest := addMonths(issued, rule.MinMonths)
+		for year := issued.Year(); year <= issued.Year()+rule.MinMonths/12+3; year++ {
+			if rule.Kind == Biennial && (year%2 == 1) != (rule.Parity == "odd") {
+				continue
+			}
+			candidate := date(year, time.Month(rule.Month), rule.Day)
+			if candidate.After(earliest) {
+				return candidate, nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown expiration rule %q", rule.Kind)
+}
+
+// Effective returns the rule that governs a license type: its own rule, or a
+// term of its default validity period, or nil when neither is set.
+func Effective(rule *Rule, validityMonths *int) *Rule {
+	if rule != nil {
+		return rule
+	}
+	if validityMonths != nil && *validityMonths > 0 {
+		return &Rule{Kind: Term, Months: *validityMonths}
+	}
+	return nil
+}
+
+// addMonths moves t by months, clamping to the end of a shorter month so
+// Jan 31 plus one month is Feb 28 rather than Mar 3.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	return date(first.Year(), first.Month(), t.Day())
+}
+
+// date builds a date, clamping day to the length of the month.
+func date(year int, month time.Month, day int) time.Time {
+	if last := endOfMonth(year, month).Day(); day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func endOfMonth(year int, month time.Month) time.Time {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,63 @@
+package expiration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+)
+
+// Lookup returns the rule governing licenses of one of the tenant's license
+// types issued on date, or nil when the version in force then has none,
+// along with that version's ID. It returns sql.ErrNoRows for an unknown
+// license.
+func Lookup(db utils.DB, licenseID int, date string, userSub string) (*Rule, int, error) {
+	var versionID int
+	var encoded sql.NullString
+	var validityMonths *int
+	err := db.QueryRow(`
+        SELECT v.id, v.expirationRule, v.validityMonths
+        FROM licenseVersions v
+        JOIN licenses l on v.licenseId = l.id
+        WHERE v.licenseId = ? and l.deleted IS NULL and l.createdBy = ?
+            and (v.effectiveFrom IS NULL or v.effectiveFrom <= ?)
+        ORDER BY v.effectiveFrom DESC, v.version DESC
+        LIMIT 1
+    `, licenseID, userSub, date).Scan(&versionID, &encoded, &validityMonths)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rule *Rule
+	if encoded.Valid {
+		rule = &Rule{}
+		if err := json.Unmarshal([]byte(encoded.String), rule); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return Effective(rule, validityMonths), versionID, nil
+}
+
+// BirthDate returns an employee's birth date, or nil when it isn't on file.
+func BirthDate(db utils.DB, employeeID int, userSub string) (*time.Time, error) {
+	var birthDate sql.NullString
+	err := db.QueryRow(`
+        SELECT birthDate FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, employeeID, userSub).Scan(&birthDate)
+	if err == sql.ErrNoRows || err == nil && !birthDate.Valid {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := validation.ParseDate(birthDate.String)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
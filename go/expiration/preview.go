@@ -0,0 +1,112 @@
+package expiration
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewRequest asks what expiration date a rule gives. The rule is either
+// a saved license type's (LicenseID), as in force on IssueDate, or one
+// being drafted (Rule). Birth month rules take the birth date from
+// BirthDate or from EmployeeID.
+type PreviewRequest struct {
+	LicenseID  *int   `json:"licenseId" validate:"omitempty,gt=0"`
+	Rule       *Rule  `json:"rule"`
+	IssueDate  string `json:"issueDate" validate:"required,datetime=2006-01-02"`
+	EmployeeID *int   `json:"employeeId" validate:"omitempty,gt=0"`
+	BirthDate  string `json:"birthDate" validate:"omitempty,datetime=2006-01-02"`
+}
+
+func (req *PreviewRequest) Normalize() {
+	req.IssueDate = validation.NormalizeDate(req.IssueDate)
+	req.BirthDate = validation.NormalizeDate(req.BirthDate)
+}
+
+func (req *PreviewRequest) Check() validation.FieldErrors {
+	if (req.LicenseID == nil) == (req.Rule == nil) {
+		return validation.FieldErrors{"licenseId": "give either licenseId or rule"}
+	}
+	if req.Rule != nil {
+		return req.Rule.Check("rule")
+	}
+	return nil
+}
+
+// PostPreview returns the expiration date a rule produces for an issue date.
+func PostPreview(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var req PreviewRequest
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	rule := req.Rule
+	if req.LicenseID != nil {
+		var err error
+		rule, _, err = Lookup(db, *req.LicenseID, req.IssueDate, userSubStr)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{"licenseId": "does not exist"}})
+			return
+		}
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license"})
+			return
+		}
+		if rule == nil {
+			c.JSON(http.StatusOK, gin.H{"issueDate": req.IssueDate, "expDate": nil, "rule": nil})
+			return
+		}
+	}
+
+	issued, _ := validation.ParseDate(req.IssueDate)
+
+	var birthDate *time.Time
+	if req.BirthDate != "" {
+		parsed, _ := validation.ParseDate(req.BirthDate)
+		birthDate = &parsed
+	} else if req.EmployeeID != nil && rule.NeedsBirthDate() {
+		allowed, err := access.Allows(db, c, *req.EmployeeID)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+			return
+		}
+
+		birthDate, err = BirthDate(db, *req.EmployeeID, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+			return
+		}
+	}
+
+	expires, err := rule.Compute(issued, birthDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"issueDate": req.IssueDate,
+		"expDate":   expires.Format(validation.DateLayout),
+		"rule":      rule,
+	})
+}
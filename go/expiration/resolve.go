@@ -0,0 +1,71 @@
+package expiration
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+)
+
+// Resolved is what to store on an employee license for its dates: the
+// expiration date, whether it overrides the rule, and the license type
+// version to pin it to.
+type Resolved struct {
+	ExpDate    string
+	Overridden bool
+	VersionID  int
+}
+
+// Resolve works out the expiration date to store from the expiration rule
+// of the license type version in force on issueDate. Without a rule expDate
+// is required as given. With one, a missing expDate is computed and a
+// different one is only kept when override is set. Problems with the input
+// come back as field errors.
+func Resolve(db utils.DB, employeeID int, licenseID int, issueDate string, expDate string, override bool, userSub string) (Resolved, validation.FieldErrors, error) {
+	invalid := func(field, message string) (Resolved, validation.FieldErrors, error) {
+		return Resolved{}, validation.FieldErrors{field: message}, nil
+	}
+
+	rule, versionID, err := Lookup(db, licenseID, issueDate, userSub)
+	if err == sql.ErrNoRows {
+		return invalid("licenseId", "does not exist")
+	}
+	if err != nil {
+		return Resolved{}, nil, err
+	}
+
+	if rule == nil {
+		if expDate == "" {
+			return invalid("expDate", "is required")
+		}
+		return Resolved{expDate, false, versionID}, nil, nil
+	}
+
+	var birthDate *time.Time
+	if rule.NeedsBirthDate() {
+		if birthDate, err = BirthDate(db, employeeID, userSub); err != nil {
+			return Resolved{}, nil, err
+		}
+	}
+
+	issued, _ := validation.ParseDate(issueDate)
+	expires, err := rule.Compute(issued, birthDate)
+	if err != nil {
+		if expDate != "" && override {
+			return Resolved{expDate, true, versionID}, nil, nil
+		}
+		return invalid("expDate", err.Error())
+	}
+
+	computed := expires.Format(validation.DateLayout)
+	switch {
+	case expDate == "" || expDate == computed:
+		return Resolved{computed, false, versionID}, nil, nil
+	case override:
+		return Resolved{expDate, true, versionID}, nil, nil
+	default:
+		return invalid("expDate", fmt.Sprintf("should be %s under this license type's expiration rule; set expDateOverride to keep a different date", computed))
+	}
+}
@@ -0,0 +1,328 @@
+package groups
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Group is a dynamic set of employees. Membership isn't stored; it is
+// worked out from the rules every time it is asked for.
+type Group struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	// Match is "all" when every rule has to hold and "any" when one is enough.
+	Match string `json:"match" validate:"required,oneof=all any"`
+	Rules []Rule `json:"rules" validate:"dive"`
+}
+
+type Member struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	JobTitle  string `json:"jobTitle"`
+}
+
+func (group *Group) Normalize() {
+	group.Name = strings.TrimSpace(group.Name)
+	group.Description = strings.TrimSpace(group.Description)
+	if group.Match == "" {
+		group.Match = "all"
+	}
+	for i := range group.Rules {
+		group.Rules[i].Value = strings.TrimSpace(group.Rules[i].Value)
+	}
+}
+
+func (group *Group) Check() validation.FieldErrors {
+	return checkRules(group.Rules)
+}
+
+func load(db *sql.DB, id string, userSub string) (Group, error) {
+	var group Group
+	var rules string
+	err := db.QueryRow(`
+        SELECT id, name, description, matchType, rules
+        FROM employeeGroups
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSub).Scan(&group.ID, &group.Name, &group.Description, &group.Match, &rules)
+	if err != nil {
+		return group, err
+	}
+	err = json.Unmarshal([]byte(rules), &group.Rules)
+	return group, err
+}
+
+// Condition returns the SQL condition, on employees aliased as e, that
+// selects the members of a group.
+func Condition(db *sql.DB, groupID string, userSub string) (string, []interface{}, error) {
+	group, err := load(db, groupID, userSub)
+	if err != nil {
+		return "", nil, err
+	}
+	return compile(db, userSub, group.Match, group.Rules)
+}
+
+// Filter reads the groupId and tag query parameters and returns a condition
+// limiting column, an employee id, to members of that group or holders of
+// that tag. It returns an empty condition when neither is set.
+func Filter(db *sql.DB, c *gin.Context, column string) (string, []interface{}, error) {
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return "", nil, fmt.Errorf("user not found")
+	}
+
+	var clause strings.Builder
+	var args []interface{}
+
+	if groupID := c.Query("groupId"); groupID != "" {
+		if _, err := strconv.Atoi(groupID); err != nil {
+			return "", nil, fmt.Errorf("invalid groupId")
+		}
+
+		condition, conditionArgs, err := Condition(db, groupID, userSubStr)
+		if err == sql.ErrNoRows {
+			return "", nil, fmt.Errorf("group not found")
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		fmt.Fprintf(&clause, " and %s in (select e.id from employees e where e.deleted IS NULL and e.createdBy = ? and (%s))", column, condition)
+		args = append(args, userSubStr)
+		args = append(args, conditionArgs...)
+	}
+
+	if tag := c.Query("tag"); tag != "" {
+		fmt.Fprintf(&clause, " and %s in (select et.employeeId from employeeTags et join tags t on et.tagId = t.id where t.name = ? and t.createdBy = ?)", column)
+		args = append(args, tag, userSubStr)
+	}
+
+	return clause.String(), args, nil
+}
+
+func Get(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, name, description, matchType, rules
+        FROM employeeGroups
+        WHERE deleted IS NULL and createdBy = ?
+        ORDER BY name
+    `, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query groups"})
+		return
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var group Group
+		var rules string
+		if err := rows.Scan(&group.ID, &group.Name, &group.Description, &group.Match, &rules); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan group data"})
+			return
+		}
+		if err := json.Unmarshal([]byte(rules), &group.Rules); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read group rules"})
+			return
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, groups)
+}
+
+func Post(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var group Group
+	if !validation.Bind(c, &group) {
+		return
+	}
+
+	rules, _ := json.Marshal(group.Rules)
+
+	result, err := db.Exec(`
+        INSERT INTO employeeGroups (
+            name, description, matchType, rules, createdBy
+        ) VALUES (?, ?, ?, ?, ?)
+    `, group.Name, group.Description, group.Match, rules, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert group"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted group ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group inserted successfully", "id": id})
+}
+
+func Put(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var group Group
+	if !validation.Bind(c, &group) {
+		return
+	}
+
+	if _, err := load(db, id, userSubStr); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		} else {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve group"})
+		}
+		return
+	}
+
+	rules, _ := json.Marshal(group.Rules)
+
+	_, err := db.Exec(`
+        UPDATE employeeGroups
+        SET name = ?, description = ?, matchType = ?, rules = ?
+        WHERE id = ? and createdBy = ?
+    `, group.Name, group.Description, group.Match, rules, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+
+	group.ID, _ = strconv.Atoi(id)
+	c.JSON(http.StatusOK, group)
+}
+
+func Delete(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	result, err := db.Exec(`
+        UPDATE employeeGroups
+        SET deleted = current_timestamp()
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
+}
+
+// GetMembers resolves a group's rules against the current employee data.
+func GetMembers(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	condition, args, err := Condition(db, c.Param("id"), userSubStr)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve group"})
+		return
+	}
+
+	query := `
+        SELECT e.id, e.firstName, e.lastName, e.email, e.jobTitle
+        FROM employees e
+        WHERE e.deleted IS NULL and e.offboarded IS NULL and e.createdBy = ? and (` + condition + `)
+        ORDER BY e.lastName, e.firstName`
+
+	rows, err := db.Query(query, append([]interface{}{userSubStr}, args...)...)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query group members"})
+		return
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(
+			&member.ID, &member.FirstName, &member.LastName, &member.Email, &member.JobTitle,
+		); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan group member data"})
+			return
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, members)
+}
@@ -0,0 +1,206 @@
+package groups
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/orgunits"
+	"github.com/benfortenberry/accredi-track/validation"
+)
+
+// Rule is one condition of a dynamic group. Which of the optional fields
+// apply depends on Field:
+//
+//   - firstName, lastName, email, jobTitle: Op eq, neq or contains against
+//     Value, or in against Values.
+//   - location, department: Op eq or neq against the node id in Value;
+//     nodes below it count as a match.
+//   - tag: Op eq (has the tag named in Value) or neq (doesn't).
+//   - customField: Op eq, neq or contains against Value for field Key.
+//   - license: Op any or none, for licenses of LicenseID (0 for any type)
+//     in Status held, active, expired or expiringSoon.
+type Rule struct {
+	Field     string   `json:"field" validate:"required,oneof=firstName lastName email jobTitle location department tag customField license"`
+	Op        string   `json:"op" validate:"required,oneof=eq neq contains in any none"`
+	Value     string   `json:"value,omitempty" validate:"max=255"`
+	Values    []string `json:"values,omitempty" validate:"dive,max=255"`
+	Key       string   `json:"key,omitempty"`
+	Status    string   `json:"status,omitempty" validate:"omitempty,oneof=held active expired expiringSoon"`
+	LicenseID int      `json:"licenseId,omitempty" validate:"gte=0"`
+}
+
+var allowedOps = map[string][]string{
+	"firstName":   {"eq", "neq", "contains", "in"},
+	"lastName":    {"eq", "neq", "contains", "in"},
+	"email":       {"eq", "neq", "contains", "in"},
+	"jobTitle":    {"eq", "neq", "contains", "in"},
+	"location":    {"eq", "neq"},
+	"department":  {"eq", "neq"},
+	"tag":         {"eq", "neq"},
+	"customField": {"eq", "neq", "contains"},
+	"license":     {"any", "none"},
+}
+
+// licenseStatusConditions are the employeeLicenses conditions for each
+// status a license rule can ask about.
+var licenseStatusConditions = map[string]string{
+	"held":         "1 = 1",
+	"active":       "el.expDate >= CURDATE()",
+	"expired":      "el.expDate < CURDATE()",
+	"expiringSoon": "el.expDate BETWEEN CURDATE() AND DATE_ADD(CURDATE(), INTERVAL 30 DAY)",
+}
+
+// checkRules reports rule combinations the struct tags can't express.
+func checkRules(rules []Rule) validation.FieldErrors {
+	fields := validation.FieldErrors{}
+
+	for i, rule := range rules {
+		name := fmt.Sprintf("rules[%d]", i)
+
+		if ops, ok := allowedOps[rule.Field]; ok && !slices.Contains(ops, rule.Op) {
+			fields[name+".op"] = "must be one of: " + strings.Join(ops, ", ")
+			continue
+		}
+
+		switch {
+		case rule.Op == "in" && len(rule.Values) == 0:
+			fields[name+".values"] = "is required"
+		case rule.Field == "customField" && rule.Key == "":
+			fields[name+".key"] = "is required"
+		case rule.Field == "location" || rule.Field == "department":
+			if _, err := strconv.Atoi(rule.Value); err != nil {
+				fields[name+".value"] = "must be a " + rule.Field + " id"
+			}
+		case rule.Field != "license" && rule.Op != "in" && rule.Value == "":
+			fields[name+".value"] = "is required"
+		}
+	}
+
+	return fields
+}
+
+// compile turns a group's rules into a SQL condition on the employees table
+// aliased as e.
+func compile(db *sql.DB, userSub string, match string, rules []Rule) (string, []interface{}, error) {
+	if len(rules) == 0 {
+		return "1 = 1", nil, nil
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	for _, rule := range rules {
+		condition, ruleArgs, err := compileRule(db, userSub, rule)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, "("+condition+")")
+		args = append(args, ruleArgs...)
+	}
+
+	joiner := " AND "
+	if match == "any" {
+		joiner = " OR "
+	}
+
+	return strings.Join(conditions, joiner), args, nil
+}
+
+func compileRule(db *sql.DB, userSub string, rule Rule) (string, []interface{}, error) {
+	switch rule.Field {
+	case "firstName", "lastName", "email", "jobTitle":
+		column := "e." + rule.Field
+		switch rule.Op {
+		case "neq":
+			return column + " <> ?", []interface{}{rule.Value}, nil
+		case "contains":
+			return column + " LIKE ?", []interface{}{"%" + rule.Value + "%"}, nil
+		case "in":
+			args := make([]interface{}, len(rule.Values))
+			for i, value := range rule.Values {
+				args[i] = value
+			}
+			return column + " IN (" + placeholders(len(args)) + ")", args, nil
+		default:
+			return column + " = ?", []interface{}{rule.Value}, nil
+		}
+
+	case "location", "department":
+		kind := orgunits.Kind(rule.Field)
+		nodeID, err := strconv.Atoi(rule.Value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %s id %q", rule.Field, rule.Value)
+		}
+
+		ids, err := orgunits.Descendants(db, kind, nodeID, userSub)
+		if err != nil {
+			return "", nil, err
+		}
+
+		column := "e." + orgunits.EmployeeColumn(kind)
+		if len(ids) == 0 {
+			if rule.Op == "neq" {
+				return "1 = 1", nil, nil
+			}
+			return "1 = 0", nil, nil
+		}
+
+		args := make([]interface{}, len(ids))
+		for i, id := range ids {
+			args[i] = id
+		}
+		if rule.Op == "neq" {
+			return column + " IS NULL OR " + column + " NOT IN (" + placeholders(len(ids)) + ")", args, nil
+		}
+		return column + " IN (" + placeholders(len(ids)) + ")", args, nil
+
+	case "tag":
+		condition := `EXISTS (SELECT 1 FROM employeeTags et JOIN tags t on et.tagId = t.id
+			WHERE et.employeeId = e.id and t.name = ? and t.createdBy = ?)`
+		if rule.Op == "neq" {
+			condition = "NOT " + condition
+		}
+		return condition, []interface{}{rule.Value, userSub}, nil
+
+	case "customField":
+		comparison, value := "v.value = ?", rule.Value
+		if rule.Op == "contains" {
+			comparison, value = "v.value LIKE ?", "%"+rule.Value+"%"
+		}
+		condition := `EXISTS (SELECT 1 FROM employeeCustomFieldValues v JOIN customFields f on v.fieldId = f.id
+			WHERE v.employeeId = e.id and f.fieldKey = ? and f.createdBy = ? and f.deleted IS NULL and ` + comparison + `)`
+		if rule.Op == "neq" {
+			condition = "NOT " + condition
+		}
+		return condition, []interface{}{rule.Key, userSub, value}, nil
+
+	case "license":
+		status := rule.Status
+		if status == "" {
+			status = "held"
+		}
+
+		condition := `EXISTS (SELECT 1 FROM employeeLicenses el
+			WHERE el.employeeId = e.id and el.deleted IS NULL and ` + licenseStatusConditions[status]
+		var args []interface{}
+		if rule.LicenseID != 0 {
+			condition += " and el.licenseId = ?"
+			args = append(args, rule.LicenseID)
+		}
+		condition += ")"
+
+		if rule.Op == "none" {
+			condition = "NOT " + condition
+		}
+		return condition, args, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown rule field %q", rule.Field)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
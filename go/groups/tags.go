@@ -0,0 +1,284 @@
+package groups
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+type Tag struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name" validate:"required,max=50"`
+	EmployeeCount int    `json:"employeeCount"`
+}
+
+func (tag *Tag) Normalize() {
+	tag.Name = strings.TrimSpace(tag.Name)
+}
+
+type EmployeeTags struct {
+	Tags []string `json:"tags" validate:"dive,required,max=50"`
+}
+
+func (req *EmployeeTags) Normalize() {
+	for i, name := range req.Tags {
+		req.Tags[i] = strings.TrimSpace(name)
+	}
+}
+
+func GetTags(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	rows, err := db.Query(`
+	SELECT
+		t.id,
+		t.name,
+		( SELECT COUNT(*) FROM employeeTags et
+		  JOIN employees e on et.employeeId = e.id
+		  WHERE et.tagId = t.id and e.deleted IS NULL ) as employeeCount
+	FROM tags t
+	WHERE t.createdBy = ?
+	ORDER BY t.name`, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query tags"})
+		return
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.EmployeeCount); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan tag data"})
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, tags)
+}
+
+func PostTag(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var tag Tag
+	if !validation.Bind(c, &tag) {
+		return
+	}
+
+	id, err := tagID(db, tag.Name, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag inserted successfully", "id": id})
+}
+
+// DeleteTag removes a tag from every employee. Tags carry no history of
+// their own, so this is a hard delete.
+func DeleteTag(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM tags WHERE id = ? and createdBy = ?`, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "tag not found"})
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM employeeTags WHERE tagId = ?`, id); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+// PutEmployeeTags replaces an employee's tags. Unknown tag names are created
+// on the fly so the UI can offer free-form tagging.
+func PutEmployeeTags(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var req EmployeeTags
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSubStr).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee tags"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM employeeTags WHERE employeeId = ?`, id); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee tags"})
+		return
+	}
+
+	for _, name := range req.Tags {
+		tagID, err := tagID(tx, name, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee tags"})
+			return
+		}
+
+		_, err = tx.Exec(`INSERT IGNORE INTO employeeTags (employeeId, tagId) VALUES (?, ?)`, id, tagID)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee tags"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Employee tags updated successfully", "tags": req.Tags})
+}
+
+type queryExecer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// tagID returns the id of the tenant's tag with this name, creating it if it
+// doesn't exist yet. Names match case-insensitively.
+func tagID(db queryExecer, name string, userSub string) (int64, error) {
+	var id int64
+	err := db.QueryRow(`SELECT id FROM tags WHERE name = ? and createdBy = ?`, name, userSub).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	result, err := db.Exec(`INSERT INTO tags (name, createdBy) VALUES (?, ?)`, name, userSub)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// LoadTags returns tag names keyed by employee ID. Pass employeeID 0 for
+// every employee of the tenant.
+func LoadTags(db *sql.DB, userSub string, employeeID int) (map[int][]string, error) {
+	query := `
+        SELECT et.employeeId, t.name
+        FROM employeeTags et
+        JOIN tags t on et.tagId = t.id
+        WHERE t.createdBy = ?
+    `
+	args := []interface{}{userSub}
+	if employeeID != 0 {
+		query += " and et.employeeId = ?"
+		args = append(args, employeeID)
+	}
+	query += " ORDER BY t.name"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := map[int][]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], name)
+	}
+
+	return tags, rows.Err()
+}
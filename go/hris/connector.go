@@ -0,0 +1,76 @@
+package hris
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Record is one person as reported by an HR system. ExternalID is the HR
+// system's own identifier and is what ties the record to employees.id
+// across runs. TerminationDate is optional; terminations without one are
+// dated the day of the sync.
+type Record struct {
+	ExternalID      string `json:"externalId"`
+	FirstName       string `json:"firstName"`
+	LastName        string `json:"lastName"`
+	Email           string `json:"email"`
+	Phone1          string `json:"phone1"`
+	JobTitle        string `json:"jobTitle"`
+	Terminated      bool   `json:"terminated"`
+	TerminationDate string `json:"terminationDate"`
+}
+
+// Connector pulls the current list of people from an HR system. Each call
+// returns the full population the connector can see; the sync works out
+// creates, updates and terminations from it.
+type Connector interface {
+	Fetch(ctx context.Context) ([]Record, error)
+}
+
+// Factory builds a connector from the settings stored on a connection. The
+// meaning of settings is up to each adapter.
+type Factory func(settings map[string]string) (Connector, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes an adapter available under kind. Vendor adapters call it
+// from an init function.
+func Register(kind string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[kind]; exists {
+		panic(fmt.Sprintf("hris: adapter %q registered twice", kind))
+	}
+	registry[kind] = factory
+}
+
+// New builds the connector for a connection of the given kind.
+func New(kind string, settings map[string]string) (Connector, error) {
+	registryMu.RLock()
+	factory, ok := registry[kind]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown connector kind %q", kind)
+	}
+	return factory(settings)
+}
+
+// Kinds lists the registered adapters.
+func Kinds() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	kinds := make([]string, 0, len(registry))
+	for kind := range registry {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
@@ -0,0 +1,119 @@
+package hris
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("file", newFileConnector)
+}
+
+// FileConnector reads a JSON or CSV export dropped on local disk. Paths are
+// resolved inside HRIS_FEED_DIR so a tenant can't point it at arbitrary
+// files on the server.
+type FileConnector struct {
+	Path string
+}
+
+func newFileConnector(settings map[string]string) (Connector, error) {
+	base := os.Getenv("HRIS_FEED_DIR")
+	if base == "" {
+		return nil, fmt.Errorf("HRIS_FEED_DIR is not configured")
+	}
+
+	name := settings["path"]
+	if name == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	path := filepath.Join(base, filepath.Clean("/"+name))
+	return &FileConnector{Path: path}, nil
+}
+
+func (f *FileConnector) Fetch(ctx context.Context) ([]Record, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(f.Path)) {
+	case ".json":
+		var records []Record
+		if err := json.NewDecoder(file).Decode(&records); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", filepath.Base(f.Path), err)
+		}
+		return records, nil
+	case ".csv":
+		return readCSV(file)
+	default:
+		return nil, fmt.Errorf("unsupported feed format %q, expected .json or .csv", filepath.Ext(f.Path))
+	}
+}
+
+// readCSV expects a header row using the Record json names. Column order
+// doesn't matter and unknown columns are ignored. The terminated column
+// accepts anything strconv.ParseBool does; blank means active.
+func readCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["externalId"]; !ok {
+		return nil, fmt.Errorf("csv feed is missing the externalId column")
+	}
+
+	var records []Record
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading csv line %d: %w", line, err)
+		}
+
+		value := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		record := Record{
+			ExternalID:      value("externalId"),
+			FirstName:       value("firstName"),
+			LastName:        value("lastName"),
+			Email:           value("email"),
+			Phone1:          value("phone1"),
+			JobTitle:        value("jobTitle"),
+			TerminationDate: value("terminationDate"),
+		}
+		if terminated := value("terminated"); terminated != "" {
+			record.Terminated, err = strconv.ParseBool(terminated)
+			if err != nil {
+				return nil, fmt.Errorf("csv line %d: invalid terminated value %q", line, terminated)
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
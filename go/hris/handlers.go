@@ -0,0 +1,324 @@
+package hris
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Connection is a tenant's link to an HR system. IntervalMinutes of 0 means
+// the connection only syncs when triggered through PostSync.
+type Connection struct {
+	ID              int               `json:"id"`
+	Name            string            `json:"name" validate:"required,max=100"`
+	Kind            string            `json:"kind" validate:"required"`
+	Settings        map[string]string `json:"settings"`
+	IntervalMinutes int               `json:"intervalMinutes" validate:"gte=0"`
+	Enabled         bool              `json:"enabled"`
+	LastRun         *string           `json:"lastRun"`
+	CreatedBy       string            `json:"-"`
+}
+
+func (conn *Connection) Normalize() {
+	conn.Name = strings.TrimSpace(conn.Name)
+	conn.Kind = strings.TrimSpace(conn.Kind)
+	if conn.Settings == nil {
+		conn.Settings = map[string]string{}
+	}
+}
+
+func (conn *Connection) Check() validation.FieldErrors {
+	fields := validation.FieldErrors{}
+	if conn.Kind != "" && !slices.Contains(Kinds(), conn.Kind) {
+		fields["kind"] = "must be one of: " + strings.Join(Kinds(), ", ")
+	}
+	return fields
+}
+
+func queryConnections(db *sql.DB, where string, args ...interface{}) ([]Connection, error) {
+	rows, err := db.Query(`
+        SELECT id, name, kind, settings, intervalMinutes, enabled, lastRun, createdBy
+        FROM hrisConnections
+    `+where+`
+        ORDER BY name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connections := []Connection{}
+	for rows.Next() {
+		var conn Connection
+		var settings string
+		if err := rows.Scan(
+			&conn.ID, &conn.Name, &conn.Kind, &settings, &conn.IntervalMinutes,
+			&conn.Enabled, &conn.LastRun, &conn.CreatedBy,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(settings), &conn.Settings); err != nil {
+			return nil, err
+		}
+		connections = append(connections, conn)
+	}
+
+	return connections, rows.Err()
+}
+
+func load(db *sql.DB, id string, userSub string) (Connection, error) {
+	connections, err := queryConnections(db, "WHERE id = ? and deleted IS NULL and createdBy = ?", id, userSub)
+	if err != nil {
+		return Connection{}, err
+	}
+	if len(connections) == 0 {
+		return Connection{}, sql.ErrNoRows
+	}
+	return connections[0], nil
+}
+
+func GetConnections(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	connections, err := queryConnections(db, "WHERE deleted IS NULL and createdBy = ?", userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query HRIS connections"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, connections)
+}
+
+func PostConnection(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var conn Connection
+	if !validation.Bind(c, &conn) {
+		return
+	}
+
+	if _, err := New(conn.Kind, conn.Settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, _ := json.Marshal(conn.Settings)
+
+	result, err := db.Exec(`
+        INSERT INTO hrisConnections (
+            name, kind, settings, intervalMinutes, enabled, createdBy
+        ) VALUES (?, ?, ?, ?, ?, ?)
+    `, conn.Name, conn.Kind, settings, conn.IntervalMinutes, conn.Enabled, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert HRIS connection"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted HRIS connection ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "HRIS connection inserted successfully", "id": id})
+}
+
+func PutConnection(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var conn Connection
+	if !validation.Bind(c, &conn) {
+		return
+	}
+
+	existing, err := load(db, id, userSubStr)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "HRIS connection not found"})
+		} else {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve HRIS connection"})
+		}
+		return
+	}
+
+	// The kind decides what the stored external IDs mean, so it is fixed.
+	if conn.Kind != existing.Kind {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind cannot be changed"})
+		return
+	}
+
+	if _, err := New(conn.Kind, conn.Settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, _ := json.Marshal(conn.Settings)
+
+	_, err = db.Exec(`
+        UPDATE hrisConnections
+        SET name = ?, settings = ?, intervalMinutes = ?, enabled = ?
+        WHERE id = ? and createdBy = ?
+    `, conn.Name, settings, conn.IntervalMinutes, conn.Enabled, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update HRIS connection"})
+		return
+	}
+
+	conn.ID = existing.ID
+	conn.LastRun = existing.LastRun
+	c.JSON(http.StatusOK, conn)
+}
+
+func DeleteConnection(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	result, err := db.Exec(`
+        UPDATE hrisConnections
+        SET deleted = current_timestamp()
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete HRIS connection"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "HRIS connection not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "HRIS connection deleted successfully"})
+}
+
+// PostSync runs a connection now and returns the run it recorded.
+func PostSync(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	conn, err := load(db, c.Param("id"), userSubStr)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "HRIS connection not found"})
+		} else {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve HRIS connection"})
+		}
+		return
+	}
+
+	run, err := Run(c.Request.Context(), db, conn)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// GetRuns lists a connection's sync runs, newest first.
+func GetRuns(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+	if _, err := strconv.Atoi(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid connection id"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, connectionId, status, started, finished, createdCount, updatedCount,
+            terminatedCount, unchangedCount, failedCount, errors
+        FROM hrisSyncRuns
+        WHERE connectionId = ? and createdBy = ?
+        ORDER BY started DESC, id DESC
+        LIMIT 50
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query sync runs"})
+		return
+	}
+	defer rows.Close()
+
+	runs := []SyncRun{}
+	for rows.Next() {
+		var run SyncRun
+		var errors string
+		if err := rows.Scan(
+			&run.ID, &run.ConnectionID, &run.Status, &run.Started, &run.Finished, &run.Created,
+			&run.Updated, &run.Terminated, &run.Unchanged, &run.Failed, &errors,
+		); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan sync run data"})
+			return
+		}
+		if err := json.Unmarshal([]byte(errors), &run.Errors); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read sync run errors"})
+			return
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, runs)
+}
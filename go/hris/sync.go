@@ -0,0 +1,365 @@
+package hris
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/employees"
+	"github.com/benfortenberry/accredi-track/validation"
+)
+
+// schedulerInterval is how often the scheduler looks for connections that
+// are due to run.
+const schedulerInterval = time.Minute
+
+type RecordError struct {
+	ExternalID string `json:"externalId"`
+	Error      string `json:"error"`
+}
+
+type SyncRun struct {
+	ID           int           `json:"id"`
+	ConnectionID int           `json:"connectionId"`
+	Status       string        `json:"status"`
+	Started      string        `json:"started"`
+	Finished     *string       `json:"finished"`
+	Created      int           `json:"created"`
+	Updated      int           `json:"updated"`
+	Terminated   int           `json:"terminated"`
+	Unchanged    int           `json:"unchanged"`
+	Failed       int           `json:"failed"`
+	Errors       []RecordError `json:"errors"`
+}
+
+type mappedEmployee struct {
+	employee   employees.Employee
+	deleted    bool
+	offboarded bool
+}
+
+var (
+	runningMu sync.Mutex
+	running   = map[int]bool{}
+)
+
+// source is the employeeExternalIds.source value for a connection. Keeping
+// it per connection lets two feeds reuse the same external IDs.
+func source(connectionID int) string {
+	return "hris:" + strconv.Itoa(connectionID)
+}
+
+// Run pulls the connection's feed and applies it to the tenant's employees.
+// Records are applied one at a time so a bad row only fails itself. The
+// outcome is stored in hrisSyncRuns and returned.
+func Run(ctx context.Context, db *sql.DB, conn Connection) (SyncRun, error) {
+	runningMu.Lock()
+	if running[conn.ID] {
+		runningMu.Unlock()
+		return SyncRun{}, fmt.Errorf("a sync for this connection is already running")
+	}
+	running[conn.ID] = true
+	runningMu.Unlock()
+
+	defer func() {
+		runningMu.Lock()
+		delete(running, conn.ID)
+		runningMu.Unlock()
+	}()
+
+	run := SyncRun{ConnectionID: conn.ID, Status: "running", Errors: []RecordError{}}
+
+	result, err := db.Exec(`
+        INSERT INTO hrisSyncRuns (connectionId, status, errors, createdBy)
+        VALUES (?, 'running', '[]', ?)
+    `, conn.ID, conn.CreatedBy)
+	if err != nil {
+		return run, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return run, err
+	}
+	run.ID = int(id)
+
+	records, err := fetch(ctx, conn)
+	if err != nil {
+		run.Errors = append(run.Errors, RecordError{Error: err.Error()})
+		return finish(db, conn, run)
+	}
+
+	mapped, err := loadMapped(db, conn)
+	if err != nil {
+		run.Errors = append(run.Errors, RecordError{Error: err.Error()})
+		return finish(db, conn, run)
+	}
+
+	seen := map[string]bool{}
+	for _, record := range records {
+		if record.ExternalID == "" {
+			run.Failed++
+			run.Errors = append(run.Errors, RecordError{Error: "record is missing externalId"})
+			continue
+		}
+		if seen[record.ExternalID] {
+			run.Failed++
+			run.Errors = append(run.Errors, RecordError{ExternalID: record.ExternalID, Error: "externalId appears more than once in the feed"})
+			continue
+		}
+		seen[record.ExternalID] = true
+
+		outcome, err := apply(db, conn, record, mapped)
+		if err != nil {
+			run.Failed++
+			run.Errors = append(run.Errors, RecordError{ExternalID: record.ExternalID, Error: err.Error()})
+			continue
+		}
+
+		switch outcome {
+		case "created":
+			run.Created++
+		case "updated":
+			run.Updated++
+		case "terminated":
+			run.Terminated++
+		default:
+			run.Unchanged++
+		}
+	}
+
+	return finish(db, conn, run)
+}
+
+func fetch(ctx context.Context, conn Connection) ([]Record, error) {
+	connector, err := New(conn.Kind, conn.Settings)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Fetch(ctx)
+}
+
+func loadMapped(db *sql.DB, conn Connection) (map[string]mappedEmployee, error) {
+	rows, err := db.Query(`
+        SELECT m.externalId, e.id, e.firstName, e.lastName, e.phone1, e.email,
+            e.jobTitle, e.locationId, e.departmentId, e.supervisorId, e.birthDate, e.deleted IS NOT NULL,
+            e.offboarded IS NOT NULL
+        FROM employeeExternalIds m
+        JOIN employees e on m.employeeId = e.id
+        WHERE m.source = ? and m.createdBy = ?
+    `, source(conn.ID), conn.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mapped := map[string]mappedEmployee{}
+	for rows.Next() {
+		var externalID string
+		var m mappedEmployee
+		if err := rows.Scan(
+			&externalID, &m.employee.ID, &m.employee.FirstName, &m.employee.LastName,
+			&m.employee.Phone1, &m.employee.Email, &m.employee.JobTitle,
+			&m.employee.LocationID, &m.employee.DepartmentID, &m.employee.SupervisorID, &m.employee.BirthDate, &m.deleted,
+			&m.offboarded,
+		); err != nil {
+			return nil, err
+		}
+		mapped[externalID] = m
+	}
+
+	return mapped, rows.Err()
+}
+
+// apply brings one employee in line with its feed record and reports what
+// it did. Blank values in the feed leave the stored value alone.
+func apply(db *sql.DB, conn Connection, record Record, mapped map[string]mappedEmployee) (string, error) {
+	existing, known := mapped[record.ExternalID]
+
+	if !known {
+		if record.Terminated {
+			return "unchanged", nil
+		}
+
+		emp := employees.Employee{
+			FirstName: record.FirstName,
+			LastName:  record.LastName,
+			Email:     record.Email,
+			Phone1:    record.Phone1,
+			JobTitle:  record.JobTitle,
+		}
+		if err := check(&emp); err != nil {
+			return "", err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return "", err
+		}
+		defer tx.Rollback()
+
+		id, err := employees.Insert(tx, emp, conn.CreatedBy)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = tx.Exec(`
+            INSERT INTO employeeExternalIds (employeeId, source, externalId, createdBy)
+            VALUES (?, ?, ?, ?)
+        `, id, source(conn.ID), record.ExternalID, conn.CreatedBy)
+		if err != nil {
+			return "", err
+		}
+
+		return "created", tx.Commit()
+	}
+
+	if existing.deleted {
+		if record.Terminated {
+			return "unchanged", nil
+		}
+		return "", fmt.Errorf("employee %d is in the trash; restore it to resume syncing", existing.employee.ID)
+	}
+
+	if existing.offboarded {
+		if record.Terminated {
+			return "unchanged", nil
+		}
+		return "", fmt.Errorf("employee %d has been offboarded", existing.employee.ID)
+	}
+
+	if record.Terminated {
+		return terminate(db, conn, record, existing.employee.ID)
+	}
+
+	emp := existing.employee
+	overwrite := func(target *string, value string) {
+		if value != "" {
+			*target = value
+		}
+	}
+	overwrite(&emp.FirstName, record.FirstName)
+	overwrite(&emp.LastName, record.LastName)
+	overwrite(&emp.Email, record.Email)
+	overwrite(&emp.Phone1, record.Phone1)
+	overwrite(&emp.JobTitle, record.JobTitle)
+
+	if err := check(&emp); err != nil {
+		return "", err
+	}
+
+	current := existing.employee
+	if emp.FirstName == current.FirstName && emp.LastName == current.LastName &&
+		emp.Email == current.Email && emp.Phone1 == current.Phone1 && emp.JobTitle == current.JobTitle {
+		return "unchanged", nil
+	}
+
+	// Like creates, the update, its timeline entry and onboarding changes
+	// land together or not at all.
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if err := employees.Update(tx, int64(emp.ID), emp, conn.CreatedBy); err != nil {
+		return "", err
+	}
+	return "updated", tx.Commit()
+}
+
+// check runs the same validation as the employee endpoints.
+func check(emp *employees.Employee) error {
+	fields := validation.Validate(emp)
+	if len(fields) == 0 {
+		return nil
+	}
+	encoded, _ := json.Marshal(fields)
+	return fmt.Errorf("invalid record: %s", encoded)
+}
+
+// terminate offboards an employee the HR system reports as gone, keeping
+// their records as history.
+func terminate(db *sql.DB, conn Connection, record Record, employeeID int) (string, error) {
+	sep := employees.Separation{
+		SeparationDate: time.Now().Format(validation.DateLayout),
+		Reason:         "Terminated in " + conn.Name,
+	}
+	if record.TerminationDate != "" {
+		if _, err := validation.ParseDate(record.TerminationDate); err != nil {
+			return "", fmt.Errorf("terminationDate must be a date in %s format", validation.DateLayout)
+		}
+		sep.SeparationDate = record.TerminationDate
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := employees.Offboard(tx, int64(employeeID), sep, conn.CreatedBy); err != nil {
+		return "", err
+	}
+	return "terminated", tx.Commit()
+}
+
+func finish(db *sql.DB, conn Connection, run SyncRun) (SyncRun, error) {
+	switch {
+	case run.Failed == 0 && len(run.Errors) == 0:
+		run.Status = "succeeded"
+	case run.Created+run.Updated+run.Terminated+run.Unchanged > 0:
+		run.Status = "partial"
+	default:
+		run.Status = "failed"
+	}
+
+	errors, _ := json.Marshal(run.Errors)
+
+	_, err := db.Exec(`
+        UPDATE hrisSyncRuns
+        SET status = ?, finished = current_timestamp(), createdCount = ?, updatedCount = ?,
+            terminatedCount = ?, unchangedCount = ?, failedCount = ?, errors = ?
+        WHERE id = ?
+    `, run.Status, run.Created, run.Updated, run.Terminated, run.Unchanged, run.Failed, errors, run.ID)
+	if err != nil {
+		return run, err
+	}
+
+	_, err = db.Exec(`UPDATE hrisConnections SET lastRun = current_timestamp() WHERE id = ?`, conn.ID)
+	return run, err
+}
+
+// StartScheduler runs every enabled connection whose interval has elapsed.
+// Connections with an interval of 0 only run when triggered by hand.
+func StartScheduler(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			due, err := dueConnections(db)
+			if err != nil {
+				log.Printf("Failed to load due HRIS connections: %v", err)
+				continue
+			}
+
+			for _, conn := range due {
+				if _, err := Run(context.Background(), db, conn); err != nil {
+					log.Printf("HRIS sync for connection %d failed: %v", conn.ID, err)
+				}
+			}
+		}
+	}()
+}
+
+func dueConnections(db *sql.DB) ([]Connection, error) {
+	return queryConnections(db, `
+        WHERE deleted IS NULL and enabled and intervalMinutes > 0
+          and (lastRun IS NULL or lastRun <= DATE_SUB(NOW(), INTERVAL intervalMinutes MINUTE))
+    `)
+}
@@ -0,0 +1,158 @@
+package jurisdictions
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// EmployeeJurisdictions is where an employee works.
+type EmployeeJurisdictions struct {
+	Jurisdictions []string `json:"jurisdictions" validate:"max=60,dive,required,max=100"`
+}
+
+func (req *EmployeeJurisdictions) Normalize() {
+	req.Jurisdictions = Normalize(req.Jurisdictions)
+}
+
+// Load returns the jurisdictions employees work in, keyed by employee ID.
+// scope is a condition on e.id.
+func Load(db *sql.DB, userSub string, scope string, scopeArgs []interface{}) (map[int][]string, error) {
+	rows, err := db.Query(`
+        SELECT ej.employeeId, ej.jurisdiction
+        FROM employeeJurisdictions ej
+        JOIN employees e on ej.employeeId = e.id
+        WHERE e.createdBy = ? and e.deleted IS NULL`+scope+`
+        ORDER BY ej.jurisdiction`,
+		append([]interface{}{userSub}, scopeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	works := map[int][]string{}
+	for rows.Next() {
+		var employeeID int
+		var jurisdiction string
+		if err := rows.Scan(&employeeID, &jurisdiction); err != nil {
+			return nil, err
+		}
+		works[employeeID] = append(works[employeeID], jurisdiction)
+	}
+
+	return works, rows.Err()
+}
+
+func allowEmployee(db *sql.DB, c *gin.Context, id string, userSub string) bool {
+	allowed, err := access.Allows(db, c, id)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+		return false
+	}
+
+	var count int
+	if allowed {
+		err = db.QueryRow(`
+            SELECT COUNT(*) FROM employees
+            WHERE id = ? and deleted IS NULL and createdBy = ?
+        `, id, userSub).Scan(&count)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+			return false
+		}
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return false
+	}
+	return true
+}
+
+// GetEmployeeJurisdictions lists where an employee works.
+func GetEmployeeJurisdictions(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+	if !allowEmployee(db, c, id, userSubStr) {
+		return
+	}
+
+	works, err := Load(db, userSubStr, " and e.id = ?", []interface{}{id})
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query employee jurisdictions"})
+		return
+	}
+
+	list := []string{}
+	for _, employeeJurisdictions := range works {
+		list = append(list, employeeJurisdictions...)
+	}
+
+	c.IndentedJSON(http.StatusOK, EmployeeJurisdictions{Jurisdictions: list})
+}
+
+// PutEmployeeJurisdictions replaces where an employee works. Requirements
+// with a jurisdiction apply to them from then on.
+func PutEmployeeJurisdictions(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var req EmployeeJurisdictions
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	if !allowEmployee(db, c, id, userSubStr) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee jurisdictions"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM employeeJurisdictions WHERE employeeId = ?`, id); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee jurisdictions"})
+		return
+	}
+
+	for _, jurisdiction := range req.Jurisdictions {
+		_, err := tx.Exec(`INSERT INTO employeeJurisdictions (employeeId, jurisdiction) VALUES (?, ?)`, id, jurisdiction)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee jurisdictions"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update employee jurisdictions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Employee jurisdictions updated successfully", "jurisdictions": req.Jurisdictions})
+}
@@ -0,0 +1,69 @@
+package jurisdictions
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Normalize trims and upper-cases jurisdictions and drops blanks and
+// duplicates, so "tx " and "TX" are the same state.
+func Normalize(list []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, jurisdiction := range list {
+		jurisdiction = strings.ToUpper(strings.TrimSpace(jurisdiction))
+		if jurisdiction == "" || seen[jurisdiction] {
+			continue
+		}
+		seen[jurisdiction] = true
+		normalized = append(normalized, jurisdiction)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// Contains reports whether list has jurisdiction, ignoring case.
+func Contains(list []string, jurisdiction string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, strings.TrimSpace(jurisdiction)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode turns a list into the value stored in a JSON column. An empty list
+// is stored as NULL.
+func Encode(list []string) (interface{}, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(list)
+	return string(encoded), err
+}
+
+// Decode reads a JSON column written by Encode.
+func Decode(value sql.NullString) ([]string, error) {
+	list := []string{}
+	if !value.Valid {
+		return list, nil
+	}
+	err := json.Unmarshal([]byte(value.String), &list)
+	return list, err
+}
+
+// Effective is where an employee license is valid: the jurisdictions
+// recorded on it, plus the compact's members for a multistate license. A
+// license with neither is valid in its type's own jurisdiction.
+func Effective(own []string, multistate bool, compact []string, home string) []string {
+	list := append([]string{}, own...)
+	if multistate {
+		list = append(list, compact...)
+	}
+	if len(list) == 0 && home != "" {
+		list = append(list, home)
+	}
+	return Normalize(list)
+}
@@ -0,0 +1,73 @@
+package jurisdictions
+
+import (
+	"database/sql"
+)
+
+// Record is an employee license with where it is valid.
+type Record struct {
+	EmployeeLicenseID int      `json:"employeeLicenseId"`
+	EmployeeID        int      `json:"employeeId"`
+	LicenseID         int      `json:"licenseId"`
+	LicenseName       string   `json:"licenseName"`
+	IssueDate         string   `json:"issueDate"`
+	ExpDate           string   `json:"expDate"`
+	Multistate        bool     `json:"multistate"`
+	Compact           string   `json:"compact"`
+	ValidIn           []string `json:"validIn"`
+}
+
+// ValidOn reports whether the license was in force on date, in
+// validation.DateLayout.
+func (r Record) ValidOn(date string) bool {
+	return r.IssueDate <= date && date <= r.ExpDate
+}
+
+// Covers reports whether the license is valid in jurisdiction.
+func (r Record) Covers(jurisdiction string) bool {
+	return Contains(r.ValidIn, jurisdiction)
+}
+
+// Records loads the live employee licenses scope selects, latest expiration
+// first. scope is a condition on el, e or l.
+func Records(db *sql.DB, userSub string, scope string, scopeArgs []interface{}) ([]Record, error) {
+	rows, err := db.Query(`
+        SELECT el.id, el.employeeId, el.licenseId, l.name, el.issueDate, el.expDate,
+            el.jurisdictions, el.multistate, COALESCE(l.compact, ''), l.compactJurisdictions, l.jurisdiction
+        FROM employeeLicenses el
+        JOIN employees e on el.employeeId = e.id and e.deleted IS NULL
+        JOIN licenses l on el.licenseId = l.id and l.deleted IS NULL
+        WHERE el.createdBy = ? and el.deleted IS NULL`+scope+`
+        ORDER BY el.expDate DESC, el.id DESC`,
+		append([]interface{}{userSub}, scopeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		var own, compact sql.NullString
+		var home string
+		if err := rows.Scan(
+			&r.EmployeeLicenseID, &r.EmployeeID, &r.LicenseID, &r.LicenseName, &r.IssueDate, &r.ExpDate,
+			&own, &r.Multistate, &r.Compact, &compact, &home,
+		); err != nil {
+			return nil, err
+		}
+
+		ownList, err := Decode(own)
+		if err != nil {
+			return nil, err
+		}
+		compactList, err := Decode(compact)
+		if err != nil {
+			return nil, err
+		}
+		r.ValidIn = Effective(ownList, r.Multistate, compactList, home)
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
@@ -0,0 +1,171 @@
+package licenses
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ExpiringWindowDays is how close to its expiration date a license counts
+// as expiring soon, everywhere statuses are worked out.
+const ExpiringWindowDays = 30
+
+// upcomingLimit caps how many upcoming expirations Detail lists.
+const upcomingLimit = 5
+
+// Statuses of a held license, besides StatusInvalid.
+const (
+	StatusActive   = "active"
+	StatusExpiring = "expiring"
+	StatusExpired  = "expired"
+)
+
+// Holder is an employee holding a license type, with the record that
+// expires last.
+type Holder struct {
+	EmployeeLicenseID int       `json:"employeeLicenseId"`
+	EmployeeID        int       `json:"employeeId"`
+	FirstName         string    `json:"firstName"`
+	LastName          string    `json:"lastName"`
+	IssueDate         string    `json:"issueDate"`
+	ExpDate           string    `json:"expDate"`
+	DaysUntilExpiry   int       `json:"daysUntilExpiry"`
+	LicenseVersion    *int      `json:"licenseVersion"`
+	Status            string    `json:"status"`
+	InvalidDueTo      []Blocker `json:"invalidDueTo"`
+}
+
+// Detail is a license type with who holds it.
+type Detail struct {
+	License
+	Holders             []Holder       `json:"holders"`
+	Counts              map[string]int `json:"counts"`
+	UpcomingExpirations []Holder       `json:"upcomingExpirations"`
+}
+
+// GetSingle returns a license type with its holders, counts by status and
+// the nearest upcoming expirations. Managers only see their reports among
+// the holders.
+func GetSingle(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var detail Detail
+	err := scanLicense(db.QueryRow(`
+        SELECT `+columns+`
+        FROM licenses l
+        WHERE l.id = ? and l.deleted IS NULL and l.createdBy = ?
+    `, id, userSubStr), &detail.License)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "license not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license"})
+		return
+	}
+
+	withPrereqs := []License{detail.License}
+	if err := withPrerequisites(db, withPrereqs, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license prerequisites"})
+		return
+	}
+	detail.License = withPrereqs[0]
+
+	scope, scopeArgs := access.Scope(c, "el.employeeId")
+
+	holders, err := queryHolders(db, userSubStr, detail.ID, scope, scopeArgs)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query license holders"})
+		return
+	}
+
+	detail.Holders = holders
+	detail.Counts = map[string]int{StatusActive: 0, StatusExpiring: 0, StatusExpired: 0, StatusInvalid: 0}
+	detail.UpcomingExpirations = []Holder{}
+	for _, holder := range holders {
+		detail.Counts[holder.Status]++
+		if holder.Status != StatusExpired && len(detail.UpcomingExpirations) < upcomingLimit {
+			detail.UpcomingExpirations = append(detail.UpcomingExpirations, holder)
+		}
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// queryHolders lists the active employees holding a license, one per
+// employee with their latest record, soonest expiration first. scope is a
+// condition on el.employeeId.
+func queryHolders(db *sql.DB, userSub string, licenseID int, scope string, scopeArgs []interface{}) ([]Holder, error) {
+	// Invalid needs all of the holders' licenses to follow blockers through
+	// their prerequisites, like employeeLicenses does.
+	invalid, err := Invalid(db, userSub, `
+        and el.employeeId IN (
+            SELECT holder.employeeId FROM employeeLicenses holder
+            WHERE holder.licenseId = ? and holder.deleted IS NULL
+        )`+scope, append([]interface{}{licenseID}, scopeArgs...))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+        SELECT el.id, el.employeeId, e.firstName, e.lastName, el.issueDate, el.expDate,
+            DATEDIFF(el.expDate, CURDATE()), v.version
+        FROM employeeLicenses el
+        JOIN employees e on el.employeeId = e.id and e.deleted IS NULL and e.offboarded IS NULL
+        LEFT JOIN licenseVersions v on el.licenseVersionId = v.id
+        WHERE el.createdBy = ? and el.deleted IS NULL and el.licenseId = ?`+scope+`
+        ORDER BY el.expDate DESC, el.id DESC`,
+		append([]interface{}{userSub, licenseID}, scopeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holders := []Holder{}
+	seen := map[int]bool{}
+	for rows.Next() {
+		var h Holder
+		if err := rows.Scan(&h.EmployeeLicenseID, &h.EmployeeID, &h.FirstName, &h.LastName, &h.IssueDate, &h.ExpDate, &h.DaysUntilExpiry, &h.LicenseVersion); err != nil {
+			return nil, err
+		}
+		if seen[h.EmployeeID] {
+			continue
+		}
+		seen[h.EmployeeID] = true
+
+		h.InvalidDueTo = []Blocker{}
+		switch blockers := invalid[h.EmployeeLicenseID]; {
+		case h.DaysUntilExpiry < 0:
+			h.Status = StatusExpired
+		case len(blockers) > 0:
+			h.Status = StatusInvalid
+			h.InvalidDueTo = blockers
+		case h.DaysUntilExpiry <= ExpiringWindowDays:
+			h.Status = StatusExpiring
+		default:
+			h.Status = StatusActive
+		}
+		holders = append(holders, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(holders, func(i, j int) bool { return holders[i].ExpDate < holders[j].ExpDate })
+	return holders, nil
+}
@@ -2,18 +2,210 @@ package licenses
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
-
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/ce"
+	"github.com/benfortenberry/accredi-track/expiration"
+	"github.com/benfortenberry/accredi-track/jurisdictions"
+	"github.com/benfortenberry/accredi-track/timeline"
 	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
 	"github.com/gin-gonic/gin"
 )
 
+// Categories a license type can be filed under.
+var Categories = []string{"license", "certification", "screening", "training"}
+
 type License struct {
-	ID        int    `json:"id"`
-	Name      string `json:"name"`
-	CreatedBy string `json:"createdBy"`
-	InUseBy   string `json:"inUseBy"`
+	ID               int    `json:"id"`
+	Name             string `json:"name" validate:"required,max=100"`
+	IssuingAuthority string `json:"issuingAuthority" validate:"max=200"`
+	Jurisdiction     string `json:"jurisdiction" validate:"max=100"`
+	Category         string `json:"category" validate:"oneof=license certification screening training"`
+	Description      string `json:"description" validate:"max=5000"`
+	RenewalURL       string `json:"renewalUrl" validate:"omitempty,http_url,max=500"`
+	// RenewalInstructions tells the holder how to renew when RenewalURL
+	// isn't enough.
+	RenewalInstructions string `json:"renewalInstructions" validate:"max=5000"`
+	// ValidityMonths is how long a newly issued license usually lasts.
+	ValidityMonths *int `json:"validityMonths" validate:"omitempty,gt=0,lte=600"`
+	// ReminderLeadDays is how far ahead of expiry reminders start.
+	ReminderLeadDays *int `json:"reminderLeadDays" validate:"omitempty,gte=0,lte=730"`
+	// ExpirationRule works out expDate for employee licenses of this type.
+	// Without one, ValidityMonths is used as a simple term.
+	ExpirationRule *expiration.Rule `json:"expirationRule"`
+	// CERequirement is the continuing education needed each renewal cycle.
+	CERequirement *ce.Requirement `json:"ceRequirement"`
+	Critical      bool            `json:"critical"`
+	// Prerequisites are the license types that have to be held for this
+	// one to be valid.
+	Prerequisites []int `json:"prerequisites" validate:"max=20,dive,gt=0"`
+	// Compact names the interstate compact the license type belongs to, if
+	// any. A multistate license of it is valid in every one of
+	// CompactJurisdictions.
+	Compact              string   `json:"compact" validate:"max=100"`
+	CompactJurisdictions []string `json:"compactJurisdictions" validate:"max=100,dive,required,max=100"`
+	// Version is the number of the type's latest version. Put starts a new
+	// one when the rules for issuing licenses change, in force from
+	// EffectiveFrom, today by default. It must be later than the date the
+	// current version took effect.
+	Version       int    `json:"version"`
+	EffectiveFrom string `json:"effectiveFrom,omitempty" validate:"omitempty,datetime=2006-01-02"`
+	// CatalogKey and CatalogVersion link a type imported from the built-in
+	// catalog to its entry. They are only set by the import.
+	CatalogKey     *string `json:"catalogKey"`
+	CatalogVersion *int    `json:"catalogVersion"`
+	CreatedBy      string  `json:"createdBy"`
+	InUseBy        string  `json:"inUseBy"`
+}
+
+func (lic *License) Normalize() {
+	lic.Name = strings.TrimSpace(lic.Name)
+	lic.IssuingAuthority = strings.TrimSpace(lic.IssuingAuthority)
+	lic.Jurisdiction = strings.TrimSpace(lic.Jurisdiction)
+	lic.Compact = strings.TrimSpace(lic.Compact)
+	lic.CompactJurisdictions = jurisdictions.Normalize(lic.CompactJurisdictions)
+	lic.Category = strings.ToLower(strings.TrimSpace(lic.Category))
+	if lic.Category == "" {
+		lic.Category = "license"
+	}
+	lic.Description = strings.TrimSpace(lic.Description)
+	lic.RenewalURL = strings.TrimSpace(lic.RenewalURL)
+	lic.RenewalInstructions = strings.TrimSpace(lic.RenewalInstructions)
+	lic.EffectiveFrom = validation.NormalizeDate(lic.EffectiveFrom)
+}
+
+func (lic *License) Check() validation.FieldErrors {
+	fields := validation.FieldErrors{}
+	if lic.Compact == "" && len(lic.CompactJurisdictions) > 0 {
+		fields["compact"] = "is required with compactJurisdictions"
+	}
+	if lic.Compact != "" && len(lic.CompactJurisdictions) == 0 {
+		fields["compactJurisdictions"] = "is required with compact"
+	}
+	if lic.ExpirationRule != nil {
+		for field, message := range lic.ExpirationRule.Check("expirationRule") {
+			fields[field] = message
+		}
+	}
+	if lic.CERequirement != nil {
+		for field, message := range lic.CERequirement.Check("ceRequirement") {
+			fields[field] = message
+		}
+	}
+	return fields
+}
+
+// columns are the license fields shared by every query here, in the order
+// scanLicense reads them.
+const columns = `l.id, l.name, l.issuingAuthority, l.jurisdiction, l.category,
+    COALESCE(l.description, ''), l.renewalUrl, COALESCE(l.renewalInstructions, ''),
+    l.validityMonths, l.reminderLeadDays, l.expirationRule, l.ceRequirement, l.critical,
+    l.catalogKey, l.catalogVersion, COALESCE(l.compact, ''), l.compactJurisdictions,
+    ( SELECT COALESCE(MAX(v.version), 0) FROM licenseVersions v WHERE v.licenseId = l.id )`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLicense(row scanner, lic *License, extra ...interface{}) error {
+	var rule, requirement, compact sql.NullString
+	err := row.Scan(append([]interface{}{
+		&lic.ID, &lic.Name, &lic.IssuingAuthority, &lic.Jurisdiction, &lic.Category,
+		&lic.Description, &lic.RenewalURL, &lic.RenewalInstructions,
+		&lic.ValidityMonths, &lic.ReminderLeadDays, &rule, &requirement, &lic.Critical,
+		&lic.CatalogKey, &lic.CatalogVersion, &lic.Compact, &compact, &lic.Version,
+	}, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	if lic.CompactJurisdictions, err = jurisdictions.Decode(compact); err != nil {
+		return err
+	}
+
+	if rule.Valid {
+		lic.ExpirationRule = &expiration.Rule{}
+		if err := json.Unmarshal([]byte(rule.String), lic.ExpirationRule); err != nil {
+			return err
+		}
+	}
+	if requirement.Valid {
+		lic.CERequirement = &ce.Requirement{}
+		if err := json.Unmarshal([]byte(requirement.String), lic.CERequirement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nullable stores an empty string as NULL.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// encodeRule turns a rule into the value stored in licenses.expirationRule.
+func encodeRule(rule *expiration.Rule) (interface{}, error) {
+	if rule == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(rule)
+	return string(encoded), err
+}
+
+// encodeCE turns a CE requirement into the value stored in
+// licenses.ceRequirement.
+func encodeCE(requirement *ce.Requirement) (interface{}, error) {
+	if requirement == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(requirement)
+	return string(encoded), err
+}
+
+// filter narrows the license list by ?category, ?jurisdiction,
+// ?issuingAuthority, ?compact and ?critical.
+func filter(c *gin.Context) (string, []interface{}, error) {
+	var clause strings.Builder
+	var args []interface{}
+
+	if category := c.Query("category"); category != "" {
+		valid := false
+		for _, known := range Categories {
+			valid = valid || category == known
+		}
+		if !valid {
+			return "", nil, fmt.Errorf("category must be one of: %s", strings.Join(Categories, ", "))
+		}
+		clause.WriteString(" and l.category = ?")
+		args = append(args, category)
+	}
+
+	for _, field := range []string{"jurisdiction", "issuingAuthority", "compact"} {
+		if value := strings.TrimSpace(c.Query(field)); value != "" {
+			fmt.Fprintf(&clause, " and l.%s = ?", field)
+			args = append(args, value)
+		}
+	}
+
+	if critical := c.Query("critical"); critical != "" {
+		value, err := strconv.ParseBool(critical)
+		if err != nil {
+			return "", nil, fmt.Errorf("critical must be true or false")
+		}
+		clause.WriteString(" and l.critical = ?")
+		args = append(args, value)
+	}
+
+	return clause.String(), args, nil
 }
 
 func Get(db *sql.DB, c *gin.Context) {
@@ -26,11 +218,17 @@ func Get(db *sql.DB, c *gin.Context) {
 
 	var licenses []License
 
-	query := `SELECT id, name,
+	where, args, err := filter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `SELECT ` + columns + `,
  ( SELECT IFNULL(JSON_ARRAYAGG(employeeId) ,"")
 FROM employeeLicenses el where el.licenseId = l.id and el.deleted is null ) as inUseBy
-FROM licenses l where deleted IS NULL and createdBy =?`
-	rows, err := db.Query(query, userSubStr)
+FROM licenses l where deleted IS NULL and createdBy =?` + where
+	rows, err := db.Query(query, append([]interface{}{userSubStr}, args...)...)
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query licenses"})
@@ -40,9 +238,7 @@ FROM licenses l where deleted IS NULL and createdBy =?`
 
 	for rows.Next() {
 		var lic License
-		if err := rows.Scan(
-			&lic.ID, &lic.Name, &lic.InUseBy,
-		); err != nil {
+		if err := scanLicense(rows, &lic, &lic.InUseBy); err != nil {
 			fmt.Println("Error: ", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan license data"})
 			return
@@ -56,6 +252,12 @@ FROM licenses l where deleted IS NULL and createdBy =?`
 		return
 	}
 
+	if err := withPrerequisites(db, licenses, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query license prerequisites"})
+		return
+	}
+
 	c.IndentedJSON(http.StatusOK, licenses)
 }
 
@@ -68,33 +270,39 @@ func Post(db *sql.DB, c *gin.Context) {
 	}
 
 	var lic License
-	if err := c.BindJSON(&lic); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if !validation.Bind(c, &lic) {
 		return
 	}
+	lic.CatalogKey, lic.CatalogVersion = nil, nil
 
-	// Prepare the SQL statement for inserting
-	query := `
-        INSERT INTO licenses(
-            name, createdBy
-        ) VALUES (?, ?)
-    `
+	if !checkPrerequisites(db, c, 0, lic.Prerequisites, userSubStr) {
+		return
+	}
 
-	// Execute the query
-	result, err := db.Exec(query,
-		lic.Name, userSubStr,
-	)
+	tx, err := db.Begin()
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert license"})
 		return
 	}
+	defer tx.Rollback()
 
-	// Get the ID of the newly inserted
-	id, err := result.LastInsertId()
+	id, err := Insert(tx, lic, userSubStr)
 	if err != nil {
 		fmt.Println("Error: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted license ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert license"})
+		return
+	}
+
+	if err := savePrerequisites(tx, id, lic.Prerequisites); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save license prerequisites"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert license"})
 		return
 	}
 
@@ -102,52 +310,220 @@ func Post(db *sql.DB, c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "License inserted successfully", "id": id})
 }
 
+// Insert saves a new license type for the tenant, with its rules as the
+// first version, and returns its ID.
+func Insert(db utils.DB, lic License, userSub string) (int64, error) {
+	rule, err := encodeRule(lic.ExpirationRule)
+	if err != nil {
+		return 0, err
+	}
+	requirement, err := encodeCE(lic.CERequirement)
+	if err != nil {
+		return 0, err
+	}
+	compact, err := jurisdictions.Encode(lic.CompactJurisdictions)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := db.Exec(`
+        INSERT INTO licenses(
+            name, issuingAuthority, jurisdiction, category, description,
+            renewalUrl, renewalInstructions, validityMonths, reminderLeadDays,
+            expirationRule, ceRequirement, critical, catalogKey, catalogVersion,
+            compact, compactJurisdictions, createdBy
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `,
+		lic.Name, lic.IssuingAuthority, lic.Jurisdiction, lic.Category, lic.Description,
+		lic.RenewalURL, lic.RenewalInstructions, lic.ValidityMonths, lic.ReminderLeadDays,
+		rule, requirement, lic.Critical, lic.CatalogKey, lic.CatalogVersion,
+		nullable(lic.Compact), compact, userSub,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, saveVersion(db, id, lic, nil, userSub)
+}
+
+// Delete soft-deletes a license type. One employees still hold is only
+// deleted with ?cascade=true, which deletes their licenses of it too, or
+// ?reassignTo=<id>, which merges it into another type first.
 func Delete(db *sql.DB, c *gin.Context) {
 
-	_, ok := utils.GetUserSub(c)
+	userSubStr, ok := utils.GetUserSub(c)
 	if !ok {
 		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
 		return
 	}
 
 	// Get the ID from the URL parameter
-	id := c.Param("id")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
 
-	// Prepare the SQL statement for deleting
-	query := `
-        UPDATE licenses
-        SET deleted = current_timestamp()
-        WHERE id = ?
-    `
+	cascade := c.Query("cascade") == "true"
+	reassignTo := c.Query("reassignTo")
+	if cascade && reassignTo != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cascade and reassignTo can't be combined"})
+		return
+	}
 
-	// Execute the query
-	result, err := db.Exec(query, id)
+	tx, err := db.Begin()
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete license"})
 		return
 	}
+	defer tx.Rollback()
 
-	// Check if any rows were affected
-	rowsAffected, err := result.RowsAffected()
+	lic, err := lockLicense(tx, id, userSubStr)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "license not found"})
+		return
+	}
 	if err != nil {
 		fmt.Println("Error: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete license"})
 		return
 	}
 
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "license not found"})
+	if reassignTo != "" {
+		survivorID, err := strconv.Atoi(reassignTo)
+		if err != nil || survivorID == id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassignTo must be the id of another license"})
+			return
+		}
+
+		survivor, err := lockLicense(tx, survivorID, userSubStr)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("License %d not found", survivorID)})
+			return
+		}
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license"})
+			return
+		}
+
+		moved, err := merge(tx, survivor, lic, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reassign employee licenses"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete license"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "License deleted successfully", "reassignedTo": survivor.ID, "employeeLicensesMoved": moved})
+		return
+	}
+
+	rows, err := tx.Query(`
+        SELECT id, employeeId FROM employeeLicenses
+        WHERE licenseId = ? and deleted IS NULL and createdBy = ?
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query employee licenses"})
+		return
+	}
+
+	var held []timeline.Entry
+	inUseBy := []int{}
+	seen := map[int]bool{}
+	for rows.Next() {
+		var employeeLicenseID, employeeID int
+		if err := rows.Scan(&employeeLicenseID, &employeeID); err != nil {
+			rows.Close()
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan employee license data"})
+			return
+		}
+		held = append(held, timeline.Entry{
+			EmployeeID:        employeeID,
+			EmployeeLicenseID: &employeeLicenseID,
+			Kind:              timeline.LicenseRemoved,
+			Detail:            gin.H{"reason": "License type deleted"},
+		})
+		if !seen[employeeID] {
+			seen[employeeID] = true
+			inUseBy = append(inUseBy, employeeID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over employee license rows"})
+		return
+	}
+
+	if len(held) > 0 && !cascade {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":                "License is in use; pass cascade=true to delete the employee licenses too or reassignTo to move them to another license",
+			"inUseBy":              inUseBy,
+			"employeeLicenseCount": len(held),
+		})
+		return
+	}
+
+	if len(held) > 0 {
+		_, err = tx.Exec(`
+            UPDATE employeeLicenses
+            SET deleted = current_timestamp()
+            WHERE licenseId = ? and deleted IS NULL and createdBy = ?
+        `, id, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete employee licenses"})
+			return
+		}
+
+		for _, entry := range held {
+			if err := timeline.Record(tx, userSubStr, entry); err != nil {
+				fmt.Println("Error: ", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record employee license activity"})
+				return
+			}
+		}
+	}
+
+	// Prepare the SQL statement for deleting
+	_, err = tx.Exec(`
+        UPDATE licenses
+        SET deleted = current_timestamp()
+        WHERE id = ?
+    `, id)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete license"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete license"})
 		return
 	}
 
 	// Respond with a success message
-	c.JSON(http.StatusOK, gin.H{"message": "License deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "License deleted successfully", "employeeLicensesDeleted": len(held)})
 }
 
 func Put(db *sql.DB, c *gin.Context) {
 
-	_, ok := utils.GetUserSub(c)
+	userSubStr, ok := utils.GetUserSub(c)
 	if !ok {
 		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
 		return
@@ -155,23 +531,80 @@ func Put(db *sql.DB, c *gin.Context) {
 
 	// Get the ID from the URL parameter
 	id := c.Param("id")
+	licenseID, err := strconv.Atoi(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
 
 	var lic License
-	if err := c.BindJSON(&lic); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+	if !validation.Bind(c, &lic) {
+		return
+	}
+
+	var previous License
+	err = scanLicense(db.QueryRow(`
+        SELECT `+columns+`
+        FROM licenses l
+        WHERE l.id = ? and l.deleted IS NULL and l.createdBy = ?
+    `, id, userSubStr), &previous)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "license not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license"})
+		return
+	}
+
+	if !checkPrerequisites(db, c, licenseID, lic.Prerequisites, userSubStr) {
 		return
 	}
 
 	// Prepare the SQL statement for updating
+	rule, err := encodeRule(lic.ExpirationRule)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update license"})
+		return
+	}
+	requirement, err := encodeCE(lic.CERequirement)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update license"})
+		return
+	}
+	compact, err := jurisdictions.Encode(lic.CompactJurisdictions)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update license"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update license"})
+		return
+	}
+	defer tx.Rollback()
+
 	query := `
         UPDATE licenses
-        SET name = ?
-        WHERE id = ?
+        SET name = ?, issuingAuthority = ?, jurisdiction = ?, category = ?,
+            description = ?, renewalUrl = ?, renewalInstructions = ?,
+            validityMonths = ?, reminderLeadDays = ?, expirationRule = ?, ceRequirement = ?, critical = ?,
+            compact = ?, compactJurisdictions = ?
+        WHERE id = ? and createdBy = ?
     `
 
 	// Execute the query
-	_, err := db.Exec(query,
-		lic.Name, id,
+	_, err = tx.Exec(query,
+		lic.Name, lic.IssuingAuthority, lic.Jurisdiction, lic.Category,
+		lic.Description, lic.RenewalURL, lic.RenewalInstructions,
+		lic.ValidityMonths, lic.ReminderLeadDays, rule, requirement, lic.Critical,
+		nullable(lic.Compact), compact, id, userSubStr,
 	)
 	if err != nil {
 		fmt.Println("Error: ", err)
@@ -179,6 +612,45 @@ func Put(db *sql.DB, c *gin.Context) {
 		return
 	}
 
+	if err := savePrerequisites(tx, int64(licenseID), lic.Prerequisites); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save license prerequisites"})
+		return
+	}
+
+	// Licenses already issued keep the rules they were issued under.
+	if !sameRules(previous, lic) {
+		effectiveFrom := lic.EffectiveFrom
+		if effectiveFrom == "" {
+			effectiveFrom = time.Now().Format(validation.DateLayout)
+		}
+		// Versions can't be backdated: licenses issued since the latest one
+		// took effect were already resolved against it.
+		latest, err := latestEffectiveFrom(tx, int64(licenseID))
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save license version"})
+			return
+		}
+		if latest.Valid && effectiveFrom <= latest.String {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{
+				"effectiveFrom": fmt.Sprintf("must be after %s, when the current version took effect", latest.String),
+			}})
+			return
+		}
+		if err := saveVersion(tx, int64(licenseID), lic, effectiveFrom, userSubStr); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save license version"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update license"})
+		return
+	}
+
 	// Check if any rows were affected
 	// rowsAffected, err := result.RowsAffected()
 	// if err != nil {
@@ -194,20 +666,29 @@ func Put(db *sql.DB, c *gin.Context) {
 
 	var updatedLicense License
 	getQuery := `
-		 SELECT id, name
-		 FROM licenses
-		 WHERE id = ?
+		 SELECT ` + columns + `
+		 FROM licenses l
+		 WHERE l.id = ? and l.createdBy = ?
 	 `
-	err = db.QueryRow(getQuery, id).Scan(
-		&updatedLicense.ID,
-		&updatedLicense.Name,
-	)
+	err = scanLicense(db.QueryRow(getQuery, id, userSubStr), &updatedLicense)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "license not found"})
+		return
+	}
 	if err != nil {
 		fmt.Println("Error: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated license"})
 		return
 	}
 
+	updated := []License{updatedLicense}
+	if err := withPrerequisites(db, updated, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license prerequisites"})
+		return
+	}
+	updatedLicense = updated[0]
+
 	// Respond with the updated data
 	c.JSON(http.StatusOK, updatedLicense)
 
@@ -0,0 +1,211 @@
+package licenses
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+type MergeRequest struct {
+	SurvivorID   int   `json:"survivorId" validate:"required,gt=0"`
+	DuplicateIDs []int `json:"duplicateIds" validate:"required,min=1,max=50,dive,gt=0"`
+}
+
+func (req *MergeRequest) Check() validation.FieldErrors {
+	fields := validation.FieldErrors{}
+	seen := map[int]bool{}
+	for i, id := range req.DuplicateIDs {
+		field := fmt.Sprintf("duplicateIds[%d]", i)
+		switch {
+		case id == req.SurvivorID:
+			fields[field] = "must be a different license type than survivorId"
+		case seen[id]:
+			fields[field] = "is listed more than once"
+		}
+		seen[id] = true
+	}
+	return fields
+}
+
+// lockLicense loads a live license type of the tenant and locks it for the
+// rest of the transaction.
+func lockLicense(tx *sql.Tx, id int, userSub string) (License, error) {
+	var lic License
+	err := scanLicense(tx.QueryRow(`
+        SELECT `+columns+`
+        FROM licenses l
+        WHERE l.id = ? and l.deleted IS NULL and l.createdBy = ?
+        FOR UPDATE
+    `, id, userSub), &lic)
+	return lic, err
+}
+
+// merge repoints everything that refers to the duplicate license type at
+// the survivor, soft-deletes the duplicate and records the merge. Where the
+// survivor already has a template item, placeholder or prerequisite the
+// duplicate's is dropped. Moved employee licenses stay pinned to the
+// duplicate's version they were issued under. It returns how many employee
+// licenses moved.
+func merge(tx *sql.Tx, survivor License, duplicate License, userSub string) (int64, error) {
+	result, err := tx.Exec(`
+        UPDATE employeeLicenses SET licenseId = ?
+        WHERE licenseId = ? and createdBy = ?
+    `, survivor.ID, duplicate.ID, userSub)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE IGNORE onboardingTemplateItems SET licenseId = ? WHERE licenseId = ?`, []interface{}{survivor.ID, duplicate.ID}},
+		{`DELETE FROM onboardingTemplateItems WHERE licenseId = ?`, []interface{}{duplicate.ID}},
+		{`UPDATE IGNORE credentialPlaceholders SET licenseId = ? WHERE licenseId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSub}},
+		{`DELETE FROM credentialPlaceholders WHERE licenseId = ? and createdBy = ?`, []interface{}{duplicate.ID, userSub}},
+		{`UPDATE credentialRequirements SET licenseId = ? WHERE licenseId = ? and createdBy = ?`, []interface{}{survivor.ID, duplicate.ID, userSub}},
+		{`UPDATE IGNORE licensePrerequisites SET licenseId = ? WHERE licenseId = ?`, []interface{}{survivor.ID, duplicate.ID}},
+		{`UPDATE IGNORE licensePrerequisites SET prerequisiteId = ? WHERE prerequisiteId = ?`, []interface{}{survivor.ID, duplicate.ID}},
+		{`DELETE FROM licensePrerequisites WHERE licenseId = ? or prerequisiteId = ? or licenseId = prerequisiteId`, []interface{}{duplicate.ID, duplicate.ID}},
+		{`UPDATE licenses SET deleted = current_timestamp() WHERE id = ?`, []interface{}{duplicate.ID}},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return 0, err
+		}
+	}
+
+	duplicateBefore, err := json.Marshal(duplicate)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`
+        INSERT INTO licenseMerges (survivorId, duplicateId, duplicateBefore, employeeLicensesMoved, createdBy)
+        VALUES (?, ?, ?, ?, ?)
+    `, survivor.ID, duplicate.ID, duplicateBefore, moved, userSub)
+	if err != nil {
+		return 0, err
+	}
+
+	return moved, nil
+}
+
+// mergeCycle reports whether folding duplicates into survivor would turn
+// prerequisites into a cycle, such as a survivor requiring X when X
+// requires one of the duplicates.
+func mergeCycle(graph map[int][]int, survivor int, duplicates []int) bool {
+	folded := map[int]bool{}
+	for _, id := range duplicates {
+		folded[id] = true
+	}
+	relabel := func(id int) int {
+		if folded[id] {
+			return survivor
+		}
+		return id
+	}
+
+	merged := map[int][]int{}
+	for id, prerequisites := range graph {
+		for _, prerequisiteID := range prerequisites {
+			// merge drops the edges between the survivor and its duplicates.
+			if from, to := relabel(id), relabel(prerequisiteID); from != to {
+				merged[from] = append(merged[from], to)
+			}
+		}
+	}
+
+	for _, prerequisiteID := range merged[survivor] {
+		if reaches(merged, prerequisiteID, survivor) {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge folds duplicate license types, such as "CPR" and "CPR Cert", into
+// one survivor in a single transaction.
+func Merge(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var req MergeRequest
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start merge"})
+		return
+	}
+	defer tx.Rollback()
+
+	var survivor License
+	duplicates := make([]License, len(req.DuplicateIDs))
+	for i, id := range append([]int{req.SurvivorID}, req.DuplicateIDs...) {
+		lic, err := lockLicense(tx, id, userSubStr)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("License %d not found", id)})
+			return
+		}
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license"})
+			return
+		}
+		if i == 0 {
+			survivor = lic
+		} else {
+			duplicates[i-1] = lic
+		}
+	}
+
+	graph, err := prerequisiteGraph(tx, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate prerequisites"})
+		return
+	}
+	if mergeCycle(graph, survivor.ID, req.DuplicateIDs) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Merging these license types would make the survivor require itself through its prerequisites"})
+		return
+	}
+
+	var moved int64
+	for _, duplicate := range duplicates {
+		count, err := merge(tx, survivor, duplicate, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge licenses"})
+			return
+		}
+		moved += count
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge licenses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "Licenses merged successfully",
+		"survivorId":            survivor.ID,
+		"employeeLicensesMoved": moved,
+	})
+}
@@ -0,0 +1,164 @@
+package licenses
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/benfortenberry/accredi-track/prerequisites"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// StatusInvalid is the derived status of an employee license whose
+// prerequisites aren't held.
+const StatusInvalid = "invalidDueToPrerequisite"
+
+// Blocker is the root cause of an invalid employee license. It and its
+// statuses live in prerequisites so notifications can use them without an
+// import cycle.
+type Blocker = prerequisites.Blocker
+
+const (
+	BlockerMissing = prerequisites.BlockerMissing
+	BlockerExpired = prerequisites.BlockerExpired
+)
+
+// Invalid works out which employee licenses are invalid because a
+// prerequisite is missing or expired. See prerequisites.Invalid.
+var Invalid = prerequisites.Invalid
+
+// prerequisiteGraph maps each of the tenant's license types to the types it
+// requires.
+func prerequisiteGraph(db utils.DB, userSub string) (map[int][]int, error) {
+	rows, err := db.Query(`
+        SELECT lp.licenseId, lp.prerequisiteId
+        FROM licensePrerequisites lp
+        JOIN licenses l on lp.licenseId = l.id
+        JOIN licenses p on lp.prerequisiteId = p.id and p.deleted IS NULL
+        WHERE l.createdBy = ? and l.deleted IS NULL
+        ORDER BY lp.licenseId, lp.prerequisiteId
+    `, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	graph := map[int][]int{}
+	for rows.Next() {
+		var licenseID, prerequisiteID int
+		if err := rows.Scan(&licenseID, &prerequisiteID); err != nil {
+			return nil, err
+		}
+		graph[licenseID] = append(graph[licenseID], prerequisiteID)
+	}
+	return graph, rows.Err()
+}
+
+// withPrerequisites fills in the prerequisites of each license.
+func withPrerequisites(db utils.DB, licenses []License, userSub string) error {
+	graph, err := prerequisiteGraph(db, userSub)
+	if err != nil {
+		return err
+	}
+	for i := range licenses {
+		licenses[i].Prerequisites = graph[licenses[i].ID]
+		if licenses[i].Prerequisites == nil {
+			licenses[i].Prerequisites = []int{}
+		}
+	}
+	return nil
+}
+
+// checkPrerequisites makes sure the prerequisites exist for the tenant and
+// don't make a license type depend on itself, directly or through others.
+// id is 0 for a new license type. It writes the 400 itself.
+func checkPrerequisites(db *sql.DB, c *gin.Context, id int, prerequisites []int, userSub string) bool {
+	if len(prerequisites) == 0 {
+		return true
+	}
+
+	graph, err := prerequisiteGraph(db, userSub)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate prerequisites"})
+		return false
+	}
+
+	fields := validation.FieldErrors{}
+	seen := map[int]bool{}
+	for i, prerequisiteID := range prerequisites {
+		field := fmt.Sprintf("prerequisites[%d]", i)
+		if seen[prerequisiteID] {
+			fields[field] = "is listed more than once"
+			continue
+		}
+		seen[prerequisiteID] = true
+
+		if prerequisiteID == id {
+			fields[field] = "a license type can't require itself"
+			continue
+		}
+
+		var count int
+		err := db.QueryRow(`
+            SELECT COUNT(*) FROM licenses
+            WHERE id = ? and deleted IS NULL and createdBy = ?
+        `, prerequisiteID, userSub).Scan(&count)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate prerequisites"})
+			return false
+		}
+		if count == 0 {
+			fields[field] = "does not exist"
+			continue
+		}
+
+		if id != 0 && reaches(graph, prerequisiteID, id) {
+			fields[field] = "already requires this license type"
+		}
+	}
+
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return false
+	}
+	return true
+}
+
+// reaches reports whether from requires to, directly or through other
+// license types.
+func reaches(graph map[int][]int, from int, to int) bool {
+	visited := map[int]bool{}
+	stack := []int{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == to {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, graph[id]...)
+	}
+	return false
+}
+
+// savePrerequisites replaces the prerequisites of a license type.
+func savePrerequisites(tx *sql.Tx, id int64, prerequisites []int) error {
+	if _, err := tx.Exec(`DELETE FROM licensePrerequisites WHERE licenseId = ?`, id); err != nil {
+		return err
+	}
+	for _, prerequisiteID := range prerequisites {
+		if _, err := tx.Exec(`
+            INSERT INTO licensePrerequisites (licenseId, prerequisiteId) VALUES (?, ?)
+        `, id, prerequisiteID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
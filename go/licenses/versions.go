@@ -0,0 +1,160 @@
+package licenses
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/benfortenberry/accredi-track/ce"
+	"github.com/benfortenberry/accredi-track/expiration"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Version is an effective-dated set of the rules a license type sets for
+// its licenses. Employee licenses are pinned to the version in force on
+// their issue date. EffectiveFrom is nil for the first version.
+type Version struct {
+	ID               int              `json:"id"`
+	LicenseID        int              `json:"licenseId"`
+	Version          int              `json:"version"`
+	EffectiveFrom    *string          `json:"effectiveFrom"`
+	ValidityMonths   *int             `json:"validityMonths"`
+	ReminderLeadDays *int             `json:"reminderLeadDays"`
+	ExpirationRule   *expiration.Rule `json:"expirationRule"`
+	CERequirement    *ce.Requirement  `json:"ceRequirement"`
+	Created          string           `json:"created"`
+	// EmployeeLicenses counts the employee licenses issued under it.
+	EmployeeLicenses int `json:"employeeLicenses"`
+}
+
+// sameRules reports whether two definitions of a license type set the same
+// rules, so saving one over the other doesn't need a new version.
+func sameRules(a License, b License) bool {
+	rules := func(lic License) string {
+		encoded, _ := json.Marshal([]interface{}{lic.ValidityMonths, lic.ReminderLeadDays, lic.ExpirationRule, lic.CERequirement})
+		return string(encoded)
+	}
+	return rules(a) == rules(b)
+}
+
+// latestEffectiveFrom returns when the license type's current version took
+// effect, locking its versions until the transaction ends.
+func latestEffectiveFrom(db utils.DB, licenseID int64) (sql.NullString, error) {
+	var effectiveFrom sql.NullString
+	err := db.QueryRow(`
+        SELECT effectiveFrom FROM licenseVersions
+        WHERE licenseId = ?
+        ORDER BY version DESC LIMIT 1
+        FOR UPDATE
+    `, licenseID).Scan(&effectiveFrom)
+	if err == sql.ErrNoRows {
+		return effectiveFrom, nil
+	}
+	return effectiveFrom, err
+}
+
+// saveVersion records lic's rules as the license type's next version, in
+// force from effectiveFrom on; nil means always.
+func saveVersion(db utils.DB, licenseID int64, lic License, effectiveFrom interface{}, userSub string) error {
+	rule, err := encodeRule(lic.ExpirationRule)
+	if err != nil {
+		return err
+	}
+	requirement, err := encodeCE(lic.CERequirement)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+        INSERT INTO licenseVersions (
+            licenseId, version, effectiveFrom, validityMonths, reminderLeadDays,
+            expirationRule, ceRequirement, createdBy
+        )
+        SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ?, ?, ?, ?, ?
+        FROM licenseVersions WHERE licenseId = ?
+    `, licenseID, effectiveFrom, lic.ValidityMonths, lic.ReminderLeadDays, rule, requirement, userSub, licenseID)
+	return err
+}
+
+// GetVersions lists the versions of a license type, newest first, with how
+// many employee licenses were issued under each.
+func GetVersions(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM licenses WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, id, userSubStr).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "license not found"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT v.id, v.licenseId, v.version, v.effectiveFrom, v.validityMonths, v.reminderLeadDays,
+            v.expirationRule, v.ceRequirement, v.created,
+            ( SELECT COUNT(*) FROM employeeLicenses el
+              WHERE el.licenseVersionId = v.id and el.deleted IS NULL ) as employeeLicenses
+        FROM licenseVersions v
+        WHERE v.licenseId = ? and v.createdBy = ?
+        ORDER BY v.version DESC
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query license versions"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []Version{}
+	for rows.Next() {
+		var v Version
+		var rule, requirement sql.NullString
+		if err := rows.Scan(
+			&v.ID, &v.LicenseID, &v.Version, &v.EffectiveFrom, &v.ValidityMonths, &v.ReminderLeadDays,
+			&rule, &requirement, &v.Created, &v.EmployeeLicenses,
+		); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan license version data"})
+			return
+		}
+
+		if rule.Valid {
+			v.ExpirationRule = &expiration.Rule{}
+			err = json.Unmarshal([]byte(rule.String), v.ExpirationRule)
+		}
+		if err == nil && requirement.Valid {
+			v.CERequirement = &ce.Requirement{}
+			err = json.Unmarshal([]byte(requirement.String), v.CERequirement)
+		}
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan license version data"})
+			return
+		}
+
+		versions = append(versions, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over license version rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, versions)
+}
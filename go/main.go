@@ -7,13 +7,32 @@ import (
 	"os"
 	"time"
 
+	access "github.com/benfortenberry/accredi-track/access"
+	catalog "github.com/benfortenberry/accredi-track/catalog"
+	ce "github.com/benfortenberry/accredi-track/ce"
+	compliance "github.com/benfortenberry/accredi-track/compliance"
+	customfields "github.com/benfortenberry/accredi-track/customfields"
 	dashboard "github.com/benfortenberry/accredi-track/dashboard"
 	employeeLicesnses "github.com/benfortenberry/accredi-track/employeeLicenses"
 	employees "github.com/benfortenberry/accredi-track/employees"
+	events "github.com/benfortenberry/accredi-track/events"
+	expiration "github.com/benfortenberry/accredi-track/expiration"
+	groups "github.com/benfortenberry/accredi-track/groups"
+	hris "github.com/benfortenberry/accredi-track/hris"
+	jurisdictions "github.com/benfortenberry/accredi-track/jurisdictions"
 
 	// encoding "github.com/benfortenberry/accredi-track/encoding"
 	licenses "github.com/benfortenberry/accredi-track/licenses"
 	middleware "github.com/benfortenberry/accredi-track/middleware"
+	notes "github.com/benfortenberry/accredi-track/notes"
+	notifications "github.com/benfortenberry/accredi-track/notifications"
+	onboarding "github.com/benfortenberry/accredi-track/onboarding"
+	orgunits "github.com/benfortenberry/accredi-track/orgunits"
+	portal "github.com/benfortenberry/accredi-track/portal"
+	requirements "github.com/benfortenberry/accredi-track/requirements"
+	scim "github.com/benfortenberry/accredi-track/scim"
+	timeline "github.com/benfortenberry/accredi-track/timeline"
+	trash "github.com/benfortenberry/accredi-track/trash"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-sql-driver/mysql"
@@ -65,6 +84,10 @@ func main() {
 	// hd.MinLength = 8      // Minimum length of the generated hash
 	// h, _ := hashids.NewWithData(hd)
 
+	trash.StartPurgeJob(db)
+	hris.StartScheduler(db)
+	ce.StartAlertJob(db)
+
 	router := gin.Default()
 
 	router.Use(cors.New(cors.Config{
@@ -77,75 +100,492 @@ func main() {
 	}))
 
 	// employee routes
-	router.GET("/employees", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/employees", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		employees.Get(db, c)
 	})
 
-	router.GET("/employee/:id", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/employee/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		employees.GetSingle(db, c)
 	})
 
-	router.POST("/employees", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/employee/:id/timeline", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		timeline.Get(db, c)
+	})
+
+	router.GET("/employee/:id/compliance", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		compliance.GetEmployee(db, c)
+	})
+
+	// Notes
+	router.GET("/employees/:id/notes", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		notes.Get(db, c)
+	})
+
+	router.POST("/employees/:id/notes", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		notes.Post(db, c)
+	})
+
+	router.PUT("/notes/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		notes.Put(db, c)
+	})
+
+	router.DELETE("/notes/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		notes.Delete(db, c)
+	})
+
+	router.GET("/notes/:id/history", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		notes.GetHistory(db, c)
+	})
+
+	router.POST("/employees", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
 		employees.Post(db, c)
 	})
-	router.DELETE("/employees/:id", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/employees/export", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		employees.Export(db, c)
+	})
+
+	router.GET("/employees/duplicates", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		employees.GetDuplicates(db, c)
+	})
+
+	router.POST("/employees/merge", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		employees.Merge(db, c)
+	})
+
+	router.DELETE("/employees/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
 		employees.Delete(db, c)
 	})
-	router.PUT("/employees/:id", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.PUT("/employees/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
 		employees.Put(db, c)
 	})
 
+	router.POST("/employees/:id/offboard", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		employees.PostOffboard(db, c)
+	})
+
 	// license routes
-	router.GET("/licenses", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/licenses", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		licenses.Get(db, c)
 	})
 
-	router.POST("/licenses", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/licenses/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		licenses.GetSingle(db, c)
+	})
+
+	router.GET("/licenses/:id/versions", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		licenses.GetVersions(db, c)
+	})
+
+	router.POST("/licenses", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
 		licenses.Post(db, c)
 	})
 
-	router.PUT("/licenses/:id", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.PUT("/licenses/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
 		licenses.Put(db, c)
 	})
 
-	router.DELETE("/licenses/:id", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.DELETE("/licenses/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
 		licenses.Delete(db, c)
 	})
 
+	router.POST("/licenses/merge", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		licenses.Merge(db, c)
+	})
+
+	router.GET("/license-catalog", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		catalog.Get(db, c)
+	})
+
+	router.POST("/license-catalog/import", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		catalog.PostImport(db, c)
+	})
+
+	router.POST("/licenses/expiration-preview", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		expiration.PostPreview(db, c)
+	})
+
+	// continuing education routes
+	router.GET("/employees/:id/ce-activities", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		ce.GetActivities(db, c)
+	})
+
+	router.POST("/employees/:id/ce-activities", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		ce.PostActivity(db, c)
+	})
+
+	router.PUT("/ce-activities/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		ce.PutActivity(db, c)
+	})
+
+	router.DELETE("/ce-activities/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		ce.DeleteActivity(db, c)
+	})
+
+	router.GET("/employees/:id/ce-progress", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		ce.GetEmployeeProgress(db, c)
+	})
+
+	router.GET("/ce-progress", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		ce.GetProgress(db, c)
+	})
+
 	// employee license routes
-	router.GET("/employee-licenses/:id", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/employee-licenses/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		employeeLicesnses.Get(db, c)
 	})
 
-	router.POST("/employee-licenses", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.POST("/employee-licenses", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		employeeLicesnses.Post(db, c)
 	})
 
-	router.PUT("/employee-licenses/:id", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.PUT("/employee-licenses/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		employeeLicesnses.Put(db, c)
 	})
 
-	router.DELETE("/employee-licenses/:id", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.DELETE("/employee-licenses/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		employeeLicesnses.Delete(db, c)
 	})
 
+	router.PUT("/employees/:id/tags", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		groups.PutEmployeeTags(db, c)
+	})
+
+	router.GET("/employees/:id/jurisdictions", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		jurisdictions.GetEmployeeJurisdictions(db, c)
+	})
+
+	router.PUT("/employees/:id/jurisdictions", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		jurisdictions.PutEmployeeJurisdictions(db, c)
+	})
+
+	router.GET("/employees/:id/authorization", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		employeeLicesnses.GetAuthorization(db, c)
+	})
+
+	// onboarding routes
+	router.GET("/onboarding-templates", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		onboarding.GetTemplates(db, c)
+	})
+
+	router.POST("/onboarding-templates", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		onboarding.PostTemplate(db, c)
+	})
+
+	router.PUT("/onboarding-templates/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		onboarding.PutTemplate(db, c)
+	})
+
+	router.DELETE("/onboarding-templates/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		onboarding.DeleteTemplate(db, c)
+	})
+
+	// required credential routes
+	router.GET("/requirements", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		requirements.Get(db, c)
+	})
+
+	router.POST("/requirements", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		requirements.Post(db, c)
+	})
+
+	router.PUT("/requirements/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		requirements.Put(db, c)
+	})
+
+	router.DELETE("/requirements/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		requirements.Delete(db, c)
+	})
+
+	router.GET("/requirements/gaps", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		requirements.GetGaps(db, c)
+	})
+
+	router.GET("/employees/:id/placeholders", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		onboarding.GetPlaceholders(db, c)
+	})
+
+	router.POST("/placeholders/:id/waive", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		onboarding.WaivePlaceholder(db, c)
+	})
+
+	// tag routes
+	router.GET("/tags", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		groups.GetTags(db, c)
+	})
+
+	router.POST("/tags", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		groups.PostTag(db, c)
+	})
+
+	router.DELETE("/tags/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		groups.DeleteTag(db, c)
+	})
+
+	// group routes
+	router.GET("/groups", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		groups.Get(db, c)
+	})
+
+	router.GET("/groups/:id/members", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		groups.GetMembers(db, c)
+	})
+
+	router.POST("/groups", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		groups.Post(db, c)
+	})
+
+	router.PUT("/groups/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		groups.Put(db, c)
+	})
+
+	router.DELETE("/groups/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		groups.Delete(db, c)
+	})
+
+	// custom field routes
+	router.GET("/custom-fields", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		customfields.Get(db, c)
+	})
+
+	router.POST("/custom-fields", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		customfields.Post(db, c)
+	})
+
+	router.PUT("/custom-fields/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		customfields.Put(db, c)
+	})
+
+	router.DELETE("/custom-fields/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		customfields.Delete(db, c)
+	})
+
+	// location routes
+	router.GET("/locations", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		orgunits.Get(db, c, orgunits.Location)
+	})
+
+	router.POST("/locations", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		orgunits.Post(db, c, orgunits.Location)
+	})
+
+	router.PUT("/locations/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		orgunits.Put(db, c, orgunits.Location)
+	})
+
+	router.DELETE("/locations/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		orgunits.Delete(db, c, orgunits.Location)
+	})
+
+	// department routes
+	router.GET("/departments", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		orgunits.Get(db, c, orgunits.Department)
+	})
+
+	router.POST("/departments", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		orgunits.Post(db, c, orgunits.Department)
+	})
+
+	router.PUT("/departments/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		orgunits.Put(db, c, orgunits.Department)
+	})
+
+	router.DELETE("/departments/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		orgunits.Delete(db, c, orgunits.Department)
+	})
+
+	// trash routes
+	router.GET("/trash/employees", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		trash.GetEmployees(db, c)
+	})
+
+	router.POST("/trash/employees/:id/restore", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		trash.RestoreEmployee(db, c)
+	})
+
+	router.GET("/trash/licenses", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		trash.GetLicenses(db, c)
+	})
+
+	router.POST("/trash/licenses/:id/restore", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		trash.RestoreLicense(db, c)
+	})
+
+	router.GET("/trash/employee-licenses", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		trash.GetEmployeeLicenses(db, c)
+	})
+
+	router.POST("/trash/employee-licenses/:id/restore", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		trash.RestoreEmployeeLicense(db, c)
+	})
+
+	// HRIS sync routes
+	router.GET("/hris/connections", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		hris.GetConnections(db, c)
+	})
+
+	router.POST("/hris/connections", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		hris.PostConnection(db, c)
+	})
+
+	router.PUT("/hris/connections/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		hris.PutConnection(db, c)
+	})
+
+	router.DELETE("/hris/connections/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		hris.DeleteConnection(db, c)
+	})
+
+	router.POST("/hris/connections/:id/sync", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		hris.PostSync(db, c)
+	})
+
+	router.GET("/hris/connections/:id/runs", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		hris.GetRuns(db, c)
+	})
+
+	// SCIM provisioning routes; /scim/v2 authenticates with SCIM tokens
+	router.GET("/scim/tokens", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		scim.GetTokens(db, c)
+	})
+
+	router.POST("/scim/tokens", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		scim.PostToken(db, c)
+	})
+
+	router.DELETE("/scim/tokens/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		scim.DeleteToken(db, c)
+	})
+
+	router.GET("/scim/v2/ServiceProviderConfig", scim.Auth(db), func(c *gin.Context) {
+		scim.GetServiceProviderConfig(c)
+	})
+
+	router.GET("/scim/v2/Users", scim.Auth(db), func(c *gin.Context) {
+		scim.ListUsers(db, c)
+	})
+
+	router.GET("/scim/v2/Users/:id", scim.Auth(db), func(c *gin.Context) {
+		scim.GetUser(db, c)
+	})
+
+	router.POST("/scim/v2/Users", scim.Auth(db), func(c *gin.Context) {
+		scim.PostUser(db, c)
+	})
+
+	router.PUT("/scim/v2/Users/:id", scim.Auth(db), func(c *gin.Context) {
+		scim.PutUser(db, c)
+	})
+
+	router.PATCH("/scim/v2/Users/:id", scim.Auth(db), func(c *gin.Context) {
+		scim.PatchUser(db, c)
+	})
+
+	router.DELETE("/scim/v2/Users/:id", scim.Auth(db), func(c *gin.Context) {
+		scim.DeleteUser(db, c)
+	})
+
+	// access routes
+	router.GET("/me", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		access.GetMe(c)
+	})
+
+	router.GET("/users", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		access.GetUsers(db, c)
+	})
+
+	router.POST("/users", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		access.PostUser(db, c)
+	})
+
+	router.PUT("/users/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		access.PutUser(db, c)
+	})
+
+	router.DELETE("/users/:id", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		access.DeleteUser(db, c)
+	})
+
+	// invitations are answered by the invited login itself, before it
+	// belongs to the inviting tenant
+	router.GET("/invitations", middleware.AuthMiddleware(), func(c *gin.Context) {
+		access.GetInvitations(db, c)
+	})
+
+	router.POST("/invitations/:id/accept", middleware.AuthMiddleware(), func(c *gin.Context) {
+		access.AcceptInvitation(db, c)
+	})
+
+	router.POST("/invitations/:id/decline", middleware.AuthMiddleware(), func(c *gin.Context) {
+		access.DeclineInvitation(db, c)
+	})
+
+	// employee portal routes; /portal authenticates with magic-link sessions
+	router.POST("/portal/login", func(c *gin.Context) {
+		portal.PostLogin(db, c)
+	})
+
+	router.POST("/portal/session", func(c *gin.Context) {
+		portal.PostSession(db, c)
+	})
+
+	router.GET("/portal/me", portal.Auth(db), func(c *gin.Context) {
+		portal.GetMe(db, c)
+	})
+
+	router.GET("/portal/licenses", portal.Auth(db), func(c *gin.Context) {
+		portal.GetLicenses(db, c)
+	})
+
+	router.POST("/portal/licenses/:id/renewals", portal.Auth(db), func(c *gin.Context) {
+		portal.PostRenewal(db, c)
+	})
+
+	router.POST("/portal/documents", portal.Auth(db), func(c *gin.Context) {
+		portal.PostDocument(db, c)
+	})
+
+	router.GET("/portal/submissions", portal.Auth(db), func(c *gin.Context) {
+		portal.GetSubmissions(db, c)
+	})
+
+	// pending change review routes
+	router.GET("/pending-changes", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		portal.GetPendingChanges(db, c)
+	})
+
+	router.POST("/pending-changes/:id/approve", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		portal.ApproveChange(db, c)
+	})
+
+	router.POST("/pending-changes/:id/reject", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		portal.RejectChange(db, c)
+	})
+
+	router.GET("/documents/:id", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		portal.GetDocument(db, c)
+	})
+
 	// dashboard routes
-	router.GET("/metrics", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/metrics", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		dashboard.Get(db, c)
 	})
 
-	router.GET("/metrics/license-chart-data", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/metrics/license-chart-data", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		dashboard.GetLicenseChartData(db, c)
 	})
 
-	router.GET("/metrics/license-chart-data-expired", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/metrics/license-chart-data-expired", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		dashboard.GetExpiredLicenseChartData(db, c)
 	})
 
-	router.GET("/metrics/license-chart-data-expiring-soon", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/metrics/license-chart-data-expiring-soon", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
 		dashboard.GetExpiringsByMonth(db, c)
 	})
 
+	router.GET("/metrics/rollup", middleware.AuthMiddleware(), access.Middleware(db), func(c *gin.Context) {
+		dashboard.GetRollup(db, c)
+	})
+
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -154,6 +594,15 @@ func main() {
 	})
 
 	// Email Notifications
+	router.GET("/notifications", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		notifications.Get(db, c)
+	})
+
+	// Outbox for downstream integrations
+	router.GET("/events", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
+		events.Get(db, c)
+	})
+
 	router.GET("/send-mail", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"status": "healthy",
@@ -161,7 +610,7 @@ func main() {
 	})
 
 	//Stripe
-	router.GET("/create-checkout-session", middleware.AuthMiddleware(), func(c *gin.Context) {
+	router.GET("/create-checkout-session", middleware.AuthMiddleware(), access.AdminOnly(db), func(c *gin.Context) {
 		payment.createCheckoutSession()
 	})
 
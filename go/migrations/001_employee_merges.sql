@@ -0,0 +1,13 @@
+-- Audit trail for employees.Merge: one row per duplicate folded into a survivor.
+CREATE TABLE employeeMerges (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    survivorId INT NOT NULL,
+    duplicateId INT NOT NULL,
+    survivorBefore JSON NOT NULL,
+    duplicateBefore JSON NOT NULL,
+    licensesMoved INT NOT NULL DEFAULT 0,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY employeeMerges_survivorId (survivorId),
+    KEY employeeMerges_createdBy (createdBy)
+);
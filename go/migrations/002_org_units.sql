@@ -0,0 +1,20 @@
+-- Location and department trees. Both kinds share the table; parentId points
+-- at a node of the same kind.
+CREATE TABLE orgUnits (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    kind ENUM('location', 'department') NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    parentId INT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY orgUnits_parentId (parentId),
+    KEY orgUnits_createdBy_kind (createdBy, kind)
+);
+
+ALTER TABLE employees
+    ADD COLUMN jobTitle VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN locationId INT NULL,
+    ADD COLUMN departmentId INT NULL,
+    ADD KEY employees_locationId (locationId),
+    ADD KEY employees_departmentId (departmentId);
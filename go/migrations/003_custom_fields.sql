@@ -0,0 +1,22 @@
+-- Tenant-defined employee attributes and their per-employee values. Values
+-- are stored as text and converted according to customFields.type.
+CREATE TABLE customFields (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    fieldKey VARCHAR(50) NOT NULL,
+    label VARCHAR(100) NOT NULL,
+    type ENUM('text', 'number', 'date', 'select', 'boolean') NOT NULL,
+    options JSON NULL,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY customFields_createdBy (createdBy)
+);
+
+CREATE TABLE employeeCustomFieldValues (
+    employeeId INT NOT NULL,
+    fieldId INT NOT NULL,
+    value VARCHAR(500) NOT NULL,
+    PRIMARY KEY (employeeId, fieldId),
+    KEY employeeCustomFieldValues_fieldId_value (fieldId, value)
+);
@@ -0,0 +1,39 @@
+-- Free-form employee tags.
+CREATE TABLE tags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY tags_createdBy_name (createdBy, name)
+);
+
+CREATE TABLE employeeTags (
+    employeeId INT NOT NULL,
+    tagId INT NOT NULL,
+    PRIMARY KEY (employeeId, tagId),
+    KEY employeeTags_tagId (tagId)
+);
+
+-- Rule-based groups; membership is resolved at query time from rules.
+CREATE TABLE employeeGroups (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    matchType ENUM('all', 'any') NOT NULL DEFAULT 'all',
+    rules JSON NOT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY employeeGroups_createdBy (createdBy)
+);
+
+-- Tie notifications to the employee and license they are about so they can
+-- be filtered by group.
+ALTER TABLE notifications
+    ADD COLUMN employeeId INT NULL,
+    ADD COLUMN employeeLicenseId INT NULL,
+    ADD COLUMN kind VARCHAR(50) NOT NULL DEFAULT 'reminder',
+    ADD COLUMN recipient VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN message VARCHAR(1000) NOT NULL DEFAULT '',
+    ADD COLUMN created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD KEY notifications_employeeId (employeeId);
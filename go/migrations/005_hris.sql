@@ -0,0 +1,42 @@
+-- Connections to HR systems that master employee data.
+CREATE TABLE hrisConnections (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    kind VARCHAR(50) NOT NULL,
+    settings JSON NOT NULL,
+    intervalMinutes INT NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    lastRun TIMESTAMP NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY hrisConnections_createdBy (createdBy)
+);
+
+-- Maps an external system's identifier to employees.id. source is
+-- "hris:<connectionId>" for HRIS feeds.
+CREATE TABLE employeeExternalIds (
+    employeeId INT NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    externalId VARCHAR(255) NOT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY employeeExternalIds_source (createdBy, source, externalId),
+    KEY employeeExternalIds_employeeId (employeeId)
+);
+
+CREATE TABLE hrisSyncRuns (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    connectionId INT NOT NULL,
+    status ENUM('running', 'succeeded', 'partial', 'failed') NOT NULL,
+    started TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished TIMESTAMP NULL,
+    createdCount INT NOT NULL DEFAULT 0,
+    updatedCount INT NOT NULL DEFAULT 0,
+    terminatedCount INT NOT NULL DEFAULT 0,
+    unchangedCount INT NOT NULL DEFAULT 0,
+    failedCount INT NOT NULL DEFAULT 0,
+    errors JSON NOT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    KEY hrisSyncRuns_connectionId (connectionId, started)
+);
@@ -0,0 +1,23 @@
+-- Bearer tokens identity providers use for SCIM provisioning. Only the
+-- SHA-256 of the token is kept.
+CREATE TABLE scimTokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    tokenHash CHAR(64) NOT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lastUsed TIMESTAMP NULL,
+    revoked TIMESTAMP NULL,
+    UNIQUE KEY scimTokens_tokenHash (tokenHash),
+    KEY scimTokens_createdBy (createdBy)
+);
+
+-- SCIM identity of employees provisioned by an identity provider.
+CREATE TABLE scimUsers (
+    employeeId INT PRIMARY KEY,
+    userName VARCHAR(255) NOT NULL,
+    externalId VARCHAR(255) NOT NULL DEFAULT '',
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY scimUsers_userName (createdBy, userName)
+);
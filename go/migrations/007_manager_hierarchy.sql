@@ -0,0 +1,18 @@
+-- Reporting lines between employees.
+ALTER TABLE employees
+    ADD COLUMN supervisorId INT NULL,
+    ADD KEY employees_supervisorId (supervisorId);
+
+-- Logins linked to another account's tenant. A login without a row here is
+-- the admin of its own tenant.
+CREATE TABLE tenantUsers (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant VARCHAR(255) NOT NULL,
+    userSub VARCHAR(255) NOT NULL,
+    role ENUM('admin', 'manager') NOT NULL,
+    employeeId INT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY tenantUsers_userSub (userSub),
+    KEY tenantUsers_tenant (tenant)
+);
@@ -0,0 +1,42 @@
+-- Login links that have been exchanged for a session; each works once.
+CREATE TABLE portalLinkUses (
+    nonce CHAR(32) PRIMARY KEY,
+    employeeId INT NOT NULL,
+    used TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Employee submissions from the portal waiting for HR review.
+CREATE TABLE pendingChanges (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    employeeId INT NOT NULL,
+    employeeLicenseId INT NULL,
+    kind ENUM('renewal', 'document') NOT NULL,
+    payload JSON NOT NULL,
+    note VARCHAR(1000) NOT NULL DEFAULT '',
+    status ENUM('pending', 'approved', 'rejected') NOT NULL DEFAULT 'pending',
+    reviewNote VARCHAR(1000) NOT NULL DEFAULT '',
+    reviewedBy VARCHAR(255) NULL,
+    reviewed TIMESTAMP NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY pendingChanges_createdBy_status (createdBy, status),
+    KEY pendingChanges_employeeLicenseId (employeeLicenseId)
+);
+
+-- Uploaded files; the bytes live under DOCUMENTS_DIR at storagePath.
+CREATE TABLE documents (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    employeeId INT NOT NULL,
+    employeeLicenseId INT NULL,
+    pendingChangeId INT NULL,
+    fileName VARCHAR(255) NOT NULL,
+    contentType VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    storagePath VARCHAR(255) NOT NULL,
+    status ENUM('pending', 'approved', 'rejected') NOT NULL DEFAULT 'pending',
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY documents_employeeId (employeeId),
+    KEY documents_pendingChangeId (pendingChangeId)
+);
@@ -0,0 +1,33 @@
+-- Licenses new hires need, matched by job title and/or department.
+CREATE TABLE onboardingTemplates (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    jobTitle VARCHAR(100) NULL,
+    departmentId INT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY onboardingTemplates_createdBy (createdBy)
+);
+
+CREATE TABLE onboardingTemplateItems (
+    templateId INT NOT NULL,
+    licenseId INT NOT NULL,
+    dueInDays INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (templateId, licenseId)
+);
+
+-- Licenses an employee is expected to hold but hasn't got on file yet.
+CREATE TABLE credentialPlaceholders (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    employeeId INT NOT NULL,
+    licenseId INT NOT NULL,
+    templateId INT NULL,
+    dueDate DATE NOT NULL,
+    status ENUM('missing', 'fulfilled', 'waived') NOT NULL DEFAULT 'missing',
+    employeeLicenseId INT NULL,
+    fulfilled TIMESTAMP NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY credentialPlaceholders_employee_license (employeeId, licenseId)
+);
@@ -0,0 +1,16 @@
+-- Departed employees stay on file with their credentials as read-only
+-- history instead of going to the trash.
+ALTER TABLE employees
+    ADD COLUMN separationDate DATE NULL,
+    ADD COLUMN separationReason VARCHAR(500) NULL,
+    ADD COLUMN offboarded TIMESTAMP NULL;
+
+-- Outbox of things that happened, polled by downstream integrations.
+CREATE TABLE events (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    type VARCHAR(100) NOT NULL,
+    payload JSON NOT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY events_createdBy_id (createdBy, id)
+);
@@ -0,0 +1,12 @@
+-- Changes made to an employee's file, for the employee timeline. Expirations,
+-- reminders, documents and merges come from their own tables.
+CREATE TABLE employeeActivity (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    employeeId INT NOT NULL,
+    employeeLicenseId INT NULL,
+    kind VARCHAR(50) NOT NULL,
+    detail JSON NOT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY employeeActivity_employeeId (employeeId, created)
+);
@@ -0,0 +1,34 @@
+-- Free-form notes on an employee or one of their licenses. Replies point at
+-- the note that started the thread.
+CREATE TABLE notes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    employeeId INT NOT NULL,
+    employeeLicenseId INT NULL,
+    parentId INT NULL,
+    body TEXT NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated TIMESTAMP NULL,
+    deleted TIMESTAMP NULL,
+    KEY notes_employeeId (employeeId),
+    KEY notes_parentId (parentId)
+);
+
+-- The body a note had before each edit or delete.
+CREATE TABLE noteRevisions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    noteId INT NOT NULL,
+    body TEXT NOT NULL,
+    action ENUM('edited', 'deleted') NOT NULL,
+    changedBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY noteRevisions_noteId (noteId)
+);
+
+-- Tenant users mentioned in a note.
+CREATE TABLE noteMentions (
+    noteId INT NOT NULL,
+    userSub VARCHAR(255) NOT NULL,
+    PRIMARY KEY (noteId, userSub)
+);
@@ -0,0 +1,11 @@
+-- Who issues a license type and how it renews.
+ALTER TABLE licenses
+    ADD COLUMN issuingAuthority VARCHAR(200) NOT NULL DEFAULT '',
+    ADD COLUMN jurisdiction VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN category ENUM('license', 'certification', 'screening', 'training') NOT NULL DEFAULT 'license',
+    ADD COLUMN description TEXT NULL,
+    ADD COLUMN renewalUrl VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN renewalInstructions TEXT NULL,
+    ADD COLUMN validityMonths INT NULL,
+    ADD COLUMN reminderLeadDays INT NULL,
+    ADD COLUMN critical BOOLEAN NOT NULL DEFAULT FALSE;
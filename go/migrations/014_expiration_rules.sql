@@ -0,0 +1,13 @@
+-- How a license type's expiration date follows from the issue date. See
+-- expiration.Rule.
+ALTER TABLE licenses
+    ADD COLUMN expirationRule JSON NULL;
+
+-- Needed by birth month rules.
+ALTER TABLE employees
+    ADD COLUMN birthDate DATE NULL;
+
+-- Set when an employee license keeps an expDate other than the one its
+-- license type's rule gives.
+ALTER TABLE employeeLicenses
+    ADD COLUMN expDateOverridden BOOLEAN NOT NULL DEFAULT FALSE;
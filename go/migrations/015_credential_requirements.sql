@@ -0,0 +1,15 @@
+-- Licenses employees must hold, matched by job title, department and/or tag.
+-- Unlike onboarding templates these are checked continuously, not only when
+-- an employee is hired or re-classified.
+CREATE TABLE credentialRequirements (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    licenseId INT NOT NULL,
+    jobTitle VARCHAR(100) NULL,
+    departmentId INT NULL,
+    tagId INT NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY credentialRequirements_createdBy (createdBy),
+    KEY credentialRequirements_licenseId (licenseId)
+);
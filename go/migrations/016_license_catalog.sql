@@ -0,0 +1,6 @@
+-- Link license types imported from the built-in catalog back to the entry
+-- and catalog version they came from.
+ALTER TABLE licenses
+    ADD COLUMN catalogKey VARCHAR(100) NULL,
+    ADD COLUMN catalogVersion INT NULL,
+    ADD KEY licenses_createdBy_catalogKey (createdBy, catalogKey);
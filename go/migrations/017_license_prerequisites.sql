@@ -0,0 +1,8 @@
+-- License types that are only valid while another one is held, e.g. ACLS
+-- needs a current BLS.
+CREATE TABLE licensePrerequisites (
+    licenseId INT NOT NULL,
+    prerequisiteId INT NOT NULL,
+    PRIMARY KEY (licenseId, prerequisiteId),
+    KEY licensePrerequisites_prerequisiteId (prerequisiteId)
+);
@@ -0,0 +1,18 @@
+-- Continuing education employees complete towards renewing their licenses.
+CREATE TABLE ceActivities (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    employeeId INT NOT NULL,
+    title VARCHAR(200) NOT NULL,
+    provider VARCHAR(200) NOT NULL DEFAULT '',
+    completedDate DATE NOT NULL,
+    hours DECIMAL(6,2) NOT NULL,
+    category VARCHAR(100) NOT NULL DEFAULT '',
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted TIMESTAMP NULL,
+    KEY ceActivities_employeeId_completedDate (employeeId, completedDate)
+);
+
+-- Hours of CE a license type needs each renewal cycle.
+ALTER TABLE licenses
+    ADD COLUMN ceRequirement JSON NULL;
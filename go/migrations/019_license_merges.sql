@@ -0,0 +1,13 @@
+-- Audit trail for licenses.Merge and reassigning deletes: one row per
+-- duplicate license type folded into a survivor.
+CREATE TABLE licenseMerges (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    survivorId INT NOT NULL,
+    duplicateId INT NOT NULL,
+    duplicateBefore JSON NOT NULL,
+    employeeLicensesMoved INT NOT NULL DEFAULT 0,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY licenseMerges_survivorId (survivorId),
+    KEY licenseMerges_createdBy (createdBy)
+);
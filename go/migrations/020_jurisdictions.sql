@@ -0,0 +1,24 @@
+-- Where licenses are valid and where employees work.
+--
+-- A license type in an interstate compact lists the member jurisdictions a
+-- multistate license of it is valid in. An employee license records the
+-- jurisdictions it is valid in itself, and whether it is a multistate one;
+-- with neither it is valid in the license type's own jurisdiction.
+ALTER TABLE licenses
+    ADD COLUMN compact VARCHAR(100) NULL,
+    ADD COLUMN compactJurisdictions JSON NULL;
+
+ALTER TABLE employeeLicenses
+    ADD COLUMN jurisdictions JSON NULL,
+    ADD COLUMN multistate BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE employeeJurisdictions (
+    employeeId INT NOT NULL,
+    jurisdiction VARCHAR(100) NOT NULL,
+    PRIMARY KEY (employeeId, jurisdiction)
+);
+
+-- Requirements with a jurisdiction apply to employees working there and are
+-- only met by a license valid there.
+ALTER TABLE credentialRequirements
+    ADD COLUMN jurisdiction VARCHAR(100) NULL;
@@ -0,0 +1,29 @@
+-- Effective-dated versions of the rules a license type sets for its
+-- licenses. Changing them adds a version instead of rewriting history; an
+-- employee license is pinned to the version in force on its issue date.
+-- effectiveFrom is NULL for a type's first version, which has always been
+-- in force.
+CREATE TABLE licenseVersions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    licenseId INT NOT NULL,
+    version INT NOT NULL,
+    effectiveFrom DATE NULL,
+    validityMonths INT NULL,
+    reminderLeadDays INT NULL,
+    expirationRule JSON NULL,
+    ceRequirement JSON NULL,
+    createdBy VARCHAR(255) NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY licenseVersions_licenseId_version (licenseId, version)
+);
+
+INSERT INTO licenseVersions (licenseId, version, effectiveFrom, validityMonths, reminderLeadDays, expirationRule, ceRequirement, createdBy)
+SELECT id, 1, NULL, validityMonths, reminderLeadDays, expirationRule, ceRequirement, createdBy
+FROM licenses;
+
+ALTER TABLE employeeLicenses
+    ADD COLUMN licenseVersionId INT NULL;
+
+UPDATE employeeLicenses el
+JOIN licenseVersions v on v.licenseId = el.licenseId and v.version = 1
+SET el.licenseVersionId = v.id;
@@ -0,0 +1,5 @@
+-- Linking a login to a tenant is an invitation until that login accepts
+-- it; until then it keeps acting as its own account. Links made before
+-- this have to be accepted again.
+ALTER TABLE tenantUsers
+    ADD COLUMN accepted TIMESTAMP NULL;
@@ -0,0 +1,103 @@
+package notes
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/benfortenberry/accredi-track/mailer"
+	"github.com/benfortenberry/accredi-track/notifications"
+)
+
+// mentionable returns the logins that can be mentioned in the tenant's
+// notes, with the email of the employee each is linked to, if any. The
+// tenant's own login is always included.
+func mentionable(db *sql.DB, tenant string) (map[string]string, error) {
+	rows, err := db.Query(`
+        SELECT tu.userSub, COALESCE(e.email, '')
+        FROM tenantUsers tu
+        LEFT JOIN employees e on tu.employeeId = e.id and e.deleted IS NULL
+        WHERE tu.tenant = ? and tu.deleted IS NULL and tu.accepted IS NOT NULL
+    `, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := map[string]string{tenant: ""}
+	for rows.Next() {
+		var userSub, email string
+		if err := rows.Scan(&userSub, &email); err != nil {
+			return nil, err
+		}
+		users[userSub] = email
+	}
+	return users, rows.Err()
+}
+
+// mention is a notification waiting to be emailed once the note is saved.
+type mention struct {
+	email   string
+	message string
+}
+
+// recordMentions stores the mentions of a note and a notification for each
+// newly mentioned user other than the author. It returns the emails to send
+// after the transaction commits.
+func recordMentions(tx *sql.Tx, tenant string, note Note, mentioned []string, previous []string, users map[string]string, employeeName string) ([]mention, error) {
+	if _, err := tx.Exec(`DELETE FROM noteMentions WHERE noteId = ?`, note.ID); err != nil {
+		return nil, err
+	}
+
+	already := map[string]bool{}
+	for _, userSub := range previous {
+		already[userSub] = true
+	}
+
+	var emails []mention
+	for _, userSub := range mentioned {
+		if _, err := tx.Exec(`INSERT INTO noteMentions (noteId, userSub) VALUES (?, ?)`, note.ID, userSub); err != nil {
+			return nil, err
+		}
+		if already[userSub] || userSub == note.Author {
+			continue
+		}
+
+		message := fmt.Sprintf("%s mentioned you in a note on %s: %s", note.Author, employeeName, snippet(note.Body))
+		err := notifications.Record(tx, tenant, notifications.Notification{
+			EmployeeID:        &note.EmployeeID,
+			EmployeeLicenseID: note.EmployeeLicenseID,
+			Kind:              "mention",
+			Recipient:         userSub,
+			Message:           message,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if email := users[userSub]; email != "" {
+			emails = append(emails, mention{email: email, message: message})
+		}
+	}
+
+	return emails, nil
+}
+
+// send emails mentioned users. Failures are logged; the note is already
+// saved and the notification recorded.
+func send(emails []mention) {
+	for _, m := range emails {
+		if err := mailer.Send(m.email, "You were mentioned in a note", m.message); err != nil {
+			log.Println("Error: ", err)
+		}
+	}
+}
+
+// snippet shortens a note body for notifications.
+func snippet(body string) string {
+	runes := []rune(body)
+	if len(runes) <= 200 {
+		return body
+	}
+	return string(runes[:200]) + "…"
+}
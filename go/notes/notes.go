@@ -0,0 +1,609 @@
+package notes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Note is a comment on an employee, or on one of their licenses when
+// EmployeeLicenseID is set. Top-level notes carry their replies; a deleted
+// note is only listed, with its body blanked, while it still has replies.
+type Note struct {
+	ID                int      `json:"id"`
+	EmployeeID        int      `json:"employeeId"`
+	EmployeeLicenseID *int     `json:"employeeLicenseId"`
+	ParentID          *int     `json:"parentId"`
+	Body              string   `json:"body"`
+	Author            string   `json:"author"`
+	Mentions          []string `json:"mentions"`
+	Created           string   `json:"created"`
+	Updated           *string  `json:"updated"`
+	Deleted           *string  `json:"deleted"`
+	Replies           []Note   `json:"replies,omitempty"`
+}
+
+// NoteInput is the body accepted by Post. Replies are attached to the thread
+// of ParentID and take its license.
+type NoteInput struct {
+	Body              string   `json:"body" validate:"required,max=5000"`
+	EmployeeLicenseID *int     `json:"employeeLicenseId" validate:"omitempty,gt=0"`
+	ParentID          *int     `json:"parentId" validate:"omitempty,gt=0"`
+	Mentions          []string `json:"mentions" validate:"max=20,dive,required,max=255"`
+}
+
+// NoteUpdate is the body accepted by Put.
+type NoteUpdate struct {
+	Body     string   `json:"body" validate:"required,max=5000"`
+	Mentions []string `json:"mentions" validate:"max=20,dive,required,max=255"`
+}
+
+// Revision is the body a note had before an edit or delete.
+type Revision struct {
+	ID        int    `json:"id"`
+	Body      string `json:"body"`
+	Action    string `json:"action"`
+	ChangedBy string `json:"changedBy"`
+	Created   string `json:"created"`
+}
+
+func (note *NoteInput) Normalize() {
+	note.Body = strings.TrimSpace(note.Body)
+	note.Mentions = normalizeMentions(note.Mentions)
+}
+
+func (note *NoteUpdate) Normalize() {
+	note.Body = strings.TrimSpace(note.Body)
+	note.Mentions = normalizeMentions(note.Mentions)
+}
+
+func normalizeMentions(mentions []string) []string {
+	seen := map[string]bool{}
+	cleaned := []string{}
+	for _, userSub := range mentions {
+		userSub = strings.TrimSpace(userSub)
+		if userSub == "" || seen[userSub] {
+			continue
+		}
+		seen[userSub] = true
+		cleaned = append(cleaned, userSub)
+	}
+	return cleaned
+}
+
+// Get lists the notes on an employee as threads, oldest first. With
+// ?employeeLicenseId only the threads on that license are returned.
+func Get(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	employeeID, _, ok := loadEmployee(db, c, userSubStr)
+	if !ok {
+		return
+	}
+
+	query := `
+        SELECT id, employeeId, employeeLicenseId, parentId, body, author, created, updated, deleted
+        FROM notes
+        WHERE employeeId = ? and createdBy = ?`
+	args := []interface{}{employeeID, userSubStr}
+
+	if employeeLicenseID := c.Query("employeeLicenseId"); employeeLicenseID != "" {
+		query += " and employeeLicenseId = ?"
+		args = append(args, employeeLicenseID)
+	}
+
+	notes, err := queryNotes(db, query+" ORDER BY id", args...)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query notes"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, threads(notes))
+}
+
+// Post adds a note to an employee and notifies the users it mentions.
+func Post(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var input NoteInput
+	if !validation.Bind(c, &input) {
+		return
+	}
+
+	employeeID, employeeName, ok := loadEmployee(db, c, userSubStr)
+	if !ok {
+		return
+	}
+
+	note := Note{
+		EmployeeID:        employeeID,
+		EmployeeLicenseID: input.EmployeeLicenseID,
+		Body:              input.Body,
+		Author:            c.GetString("callerSub"),
+	}
+
+	fields := validation.FieldErrors{}
+
+	if input.ParentID != nil {
+		var parentID int
+		var employeeLicenseID *int
+		err := db.QueryRow(`
+            SELECT COALESCE(parentId, id), employeeLicenseId FROM notes
+            WHERE id = ? and employeeId = ? and deleted IS NULL and createdBy = ?
+        `, *input.ParentID, employeeID, userSubStr).Scan(&parentID, &employeeLicenseID)
+		if err == sql.ErrNoRows {
+			fields["parentId"] = "does not exist"
+		} else if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate note"})
+			return
+		} else {
+			note.ParentID = &parentID
+			note.EmployeeLicenseID = employeeLicenseID
+		}
+	} else if input.EmployeeLicenseID != nil {
+		var count int
+		err := db.QueryRow(`
+            SELECT COUNT(*) FROM employeeLicenses
+            WHERE id = ? and employeeId = ? and deleted IS NULL and createdBy = ?
+        `, *input.EmployeeLicenseID, employeeID, userSubStr).Scan(&count)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate note"})
+			return
+		}
+		if count == 0 {
+			fields["employeeLicenseId"] = "does not exist"
+		}
+	}
+
+	users, ok := checkMentions(db, c, input.Mentions, userSubStr, fields)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert note"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT INTO notes (employeeId, employeeLicenseId, parentId, body, author, createdBy)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, note.EmployeeID, note.EmployeeLicenseID, note.ParentID, note.Body, note.Author, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert note"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted note ID"})
+		return
+	}
+	note.ID = int(id)
+
+	emails, err := recordMentions(tx, userSubStr, note, input.Mentions, nil, users, employeeName)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record note mentions"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert note"})
+		return
+	}
+
+	send(emails)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note inserted successfully", "id": id})
+}
+
+// Put edits a note, keeping the old body in its history. Only the author
+// can edit a note.
+func Put(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var input NoteUpdate
+	if !validation.Bind(c, &input) {
+		return
+	}
+
+	note, ok := loadNote(db, c, userSubStr)
+	if !ok {
+		return
+	}
+
+	if note.Author != c.GetString("callerSub") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can edit a note"})
+		return
+	}
+
+	users, ok := checkMentions(db, c, input.Mentions, userSubStr, validation.FieldErrors{})
+	if !ok {
+		return
+	}
+
+	var employeeName string
+	err := db.QueryRow(`SELECT CONCAT(firstName, ' ', lastName) FROM employees WHERE id = ?`, note.EmployeeID).Scan(&employeeName)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := revise(tx, note, "edited", c.GetString("callerSub")); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
+		return
+	}
+
+	_, err = tx.Exec(`
+        UPDATE notes SET body = ?, updated = current_timestamp()
+        WHERE id = ?
+    `, input.Body, note.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
+		return
+	}
+
+	previous := note.Mentions
+	note.Body = input.Body
+	emails, err := recordMentions(tx, userSubStr, note, input.Mentions, previous, users, employeeName)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record note mentions"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
+		return
+	}
+
+	send(emails)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note updated successfully"})
+}
+
+// Delete removes a note, keeping its body in its history. Authors can delete
+// their own notes and admins anyone's.
+func Delete(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	note, ok := loadNote(db, c, userSubStr)
+	if !ok {
+		return
+	}
+
+	if note.Author != c.GetString("callerSub") && access.IsManager(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author or an admin can delete a note"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete note"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := revise(tx, note, "deleted", c.GetString("callerSub")); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete note"})
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE notes SET deleted = current_timestamp() WHERE id = ?`, note.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete note"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete note"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Note deleted successfully"})
+}
+
+// GetHistory returns the earlier bodies of a note, newest first. It works
+// for deleted notes too.
+func GetHistory(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var employeeID int
+	err := db.QueryRow(`SELECT employeeId FROM notes WHERE id = ? and createdBy = ?`, c.Param("id"), userSubStr).Scan(&employeeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve note"})
+		return
+	}
+
+	if !allow(db, c, employeeID) {
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, body, action, changedBy, created
+        FROM noteRevisions
+        WHERE noteId = ?
+        ORDER BY id DESC
+    `, c.Param("id"))
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query note history"})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		var revision Revision
+		if err := rows.Scan(&revision.ID, &revision.Body, &revision.Action, &revision.ChangedBy, &revision.Created); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan note history"})
+			return
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, revisions)
+}
+
+// loadEmployee resolves the employee in the path, returning its ID and
+// name. It writes the error response itself.
+func loadEmployee(db *sql.DB, c *gin.Context, userSub string) (int, string, bool) {
+	employeeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return 0, "", false
+	}
+
+	if !allow(db, c, employeeID) {
+		return 0, "", false
+	}
+
+	var name string
+	err = db.QueryRow(`
+        SELECT CONCAT(firstName, ' ', lastName) FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, employeeID, userSub).Scan(&name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return 0, "", false
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return 0, "", false
+	}
+
+	return employeeID, name, true
+}
+
+// loadNote returns the live note in the path with its mentions. It writes
+// the error response itself.
+func loadNote(db *sql.DB, c *gin.Context, userSub string) (Note, bool) {
+	notes, err := queryNotes(db, `
+        SELECT id, employeeId, employeeLicenseId, parentId, body, author, created, updated, deleted
+        FROM notes
+        WHERE id = ? and deleted IS NULL and createdBy = ?`, c.Param("id"), userSub)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve note"})
+		return Note{}, false
+	}
+	if len(notes) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		return Note{}, false
+	}
+
+	if !allow(db, c, notes[0].EmployeeID) {
+		return Note{}, false
+	}
+
+	return notes[0], true
+}
+
+// allow checks that a manager is looking at one of their reports, reporting
+// anyone else as not found. It writes the error response itself.
+func allow(db *sql.DB, c *gin.Context, employeeID int) bool {
+	allowed, err := access.Allows(db, c, employeeID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return false
+	}
+	return true
+}
+
+// checkMentions makes sure every mentioned user belongs to the tenant and
+// returns the tenant's users. It writes the 400 response, including any
+// fields already collected, itself.
+func checkMentions(db *sql.DB, c *gin.Context, mentions []string, userSub string, fields validation.FieldErrors) (map[string]string, bool) {
+	users, err := mentionable(db, userSub)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate note"})
+		return nil, false
+	}
+
+	for _, mentioned := range mentions {
+		if _, ok := users[mentioned]; !ok {
+			fields["mentions"] = fmt.Sprintf("%s is not a user of this account", mentioned)
+			break
+		}
+	}
+
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return nil, false
+	}
+
+	return users, true
+}
+
+// revise saves the current body of a note to its history.
+func revise(tx *sql.Tx, note Note, action string, changedBy string) error {
+	_, err := tx.Exec(`
+        INSERT INTO noteRevisions (noteId, body, action, changedBy)
+        VALUES (?, ?, ?, ?)
+    `, note.ID, note.Body, action, changedBy)
+	return err
+}
+
+// queryNotes runs a notes query and attaches each note's mentions.
+func queryNotes(db *sql.DB, query string, args ...interface{}) ([]Note, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []Note{}
+	index := map[int]int{}
+	for rows.Next() {
+		var note Note
+		if err := rows.Scan(
+			&note.ID, &note.EmployeeID, &note.EmployeeLicenseID, &note.ParentID,
+			&note.Body, &note.Author, &note.Created, &note.Updated, &note.Deleted,
+		); err != nil {
+			return nil, err
+		}
+		note.Mentions = []string{}
+		index[note.ID] = len(notes)
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(notes) == 0 {
+		return notes, nil
+	}
+
+	ids := make([]interface{}, 0, len(notes))
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+
+	mentionRows, err := db.Query(`
+        SELECT noteId, userSub FROM noteMentions
+        WHERE noteId IN (?`+strings.Repeat(", ?", len(ids)-1)+`)
+        ORDER BY userSub`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer mentionRows.Close()
+
+	for mentionRows.Next() {
+		var noteID int
+		var userSub string
+		if err := mentionRows.Scan(&noteID, &userSub); err != nil {
+			return nil, err
+		}
+		note := &notes[index[noteID]]
+		note.Mentions = append(note.Mentions, userSub)
+	}
+
+	return notes, mentionRows.Err()
+}
+
+// threads nests replies under the note that started their thread. Deleted
+// notes are dropped unless replies still hang from them, in which case they
+// stay as blank placeholders.
+func threads(notes []Note) []Note {
+	replies := map[int][]Note{}
+	for _, note := range notes {
+		if note.ParentID != nil && note.Deleted == nil {
+			replies[*note.ParentID] = append(replies[*note.ParentID], note)
+		}
+	}
+
+	roots := []Note{}
+	for _, note := range notes {
+		if note.ParentID != nil {
+			continue
+		}
+		note.Replies = replies[note.ID]
+		if note.Deleted != nil {
+			if len(note.Replies) == 0 {
+				continue
+			}
+			note.Body = ""
+			note.Mentions = []string{}
+		}
+		roots = append(roots, note)
+	}
+
+	return roots
+}
@@ -0,0 +1,141 @@
+package notifications
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/groups"
+	"github.com/benfortenberry/accredi-track/prerequisites"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLimit caps how many notifications Get returns without ?limit.
+const defaultLimit = 100
+
+type Notification struct {
+	ID                int    `json:"id"`
+	EmployeeID        *int   `json:"employeeId"`
+	EmployeeLicenseID *int   `json:"employeeLicenseId"`
+	Kind              string `json:"kind"`
+	Recipient         string `json:"recipient"`
+	Message           string `json:"message"`
+	Created           string `json:"created"`
+	// InvalidDueTo is the root cause when the employee license a reminder
+	// is about is invalid because a prerequisite is missing or expired.
+	InvalidDueTo []prerequisites.Blocker `json:"invalidDueTo,omitempty"`
+}
+
+// Record stores a notification for the tenant.
+func Record(db utils.DB, userSub string, n Notification) error {
+	_, err := db.Exec(`
+        INSERT INTO notifications (
+            userSub, employeeId, employeeLicenseId, kind, recipient, message
+        ) VALUES (?, ?, ?, ?, ?, ?)
+    `, userSub, n.EmployeeID, n.EmployeeLicenseID, n.Kind, n.Recipient, n.Message)
+	return err
+}
+
+// Get lists the tenant's notifications, newest first. It can be narrowed
+// with employeeId, groupId or tag.
+func Get(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	query := `
+        SELECT id, employeeId, employeeLicenseId, kind, recipient, message, created
+        FROM notifications
+        WHERE userSub = ?`
+	args := []interface{}{userSubStr}
+
+	if employeeID := c.Query("employeeId"); employeeID != "" {
+		query += " and employeeId = ?"
+		args = append(args, employeeID)
+	}
+
+	filter, filterArgs, err := groups.Filter(db, c, "employeeId")
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query += filter
+	args = append(args, filterArgs...)
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	query += " ORDER BY created DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query notifications"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(
+			&n.ID, &n.EmployeeID, &n.EmployeeLicenseID, &n.Kind, &n.Recipient, &n.Message, &n.Created,
+		); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan notification data"})
+			return
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	if err := withBlockers(db, userSubStr, notifications); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check license prerequisites"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, notifications)
+}
+
+// withBlockers fills in InvalidDueTo on notifications about employee
+// licenses a missing or expired prerequisite makes invalid, so reminders
+// name the credential to renew first.
+func withBlockers(db utils.DB, userSub string, notifications []Notification) error {
+	var placeholders []string
+	var ids []interface{}
+	for _, n := range notifications {
+		if n.EmployeeLicenseID != nil {
+			placeholders = append(placeholders, "?")
+			ids = append(ids, *n.EmployeeLicenseID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	invalid, err := prerequisites.Invalid(db, userSub, " and el.id IN ("+strings.Join(placeholders, ", ")+")", ids)
+	if err != nil {
+		return err
+	}
+	for i, n := range notifications {
+		if n.EmployeeLicenseID != nil {
+			notifications[i].InvalidDueTo = invalid[*n.EmployeeLicenseID]
+		}
+	}
+	return nil
+}
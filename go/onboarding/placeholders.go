@@ -0,0 +1,286 @@
+package onboarding
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Placeholder is a license an employee is expected to hold but hasn't been
+// recorded yet. It stays missing until a matching employee license is
+// added or HR waives it.
+type Placeholder struct {
+	ID                int     `json:"id"`
+	EmployeeID        int     `json:"employeeId"`
+	LicenseID         int     `json:"licenseId"`
+	LicenseName       string  `json:"licenseName"`
+	TemplateID        *int    `json:"templateId"`
+	DueDate           string  `json:"dueDate"`
+	Status            string  `json:"status"`
+	Overdue           bool    `json:"overdue"`
+	EmployeeLicenseID *int    `json:"employeeLicenseId"`
+	Fulfilled         *string `json:"fulfilled"`
+}
+
+// Requirement is a license the onboarding templates expect an employee to
+// hold, from the template with the earliest due date.
+type Requirement struct {
+	TemplateID int
+	DueInDays  int
+}
+
+// Apply brings an employee's missing placeholders in line with the
+// templates matching their current job title and department. New
+// requirements get a placeholder unless the employee already holds that
+// license or had a placeholder for it fulfilled or waived; missing
+// placeholders no template asks for anymore are dropped. Call it after the
+// employee is written, in the same transaction. Offboarded employees are
+// left alone.
+func Apply(db utils.DB, employeeID int64, userSub string) error {
+	var jobTitle string
+	var departmentID sql.NullInt64
+	err := db.QueryRow(`
+        SELECT jobTitle, departmentId FROM employees
+        WHERE id = ? and deleted IS NULL and offboarded IS NULL and createdBy = ?
+    `, employeeID, userSub).Scan(&jobTitle, &departmentID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	required, err := templateRequirements(db, jobTitle, departmentID, userSub)
+	if err != nil {
+		return err
+	}
+
+	existing := map[int]string{}
+	rows, err := db.Query(`
+        SELECT licenseId, status FROM credentialPlaceholders
+        WHERE employeeId = ? and createdBy = ?
+    `, employeeID, userSub)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var licenseID int
+		var status string
+		if err := rows.Scan(&licenseID, &status); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[licenseID] = status
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for licenseID, status := range existing {
+		if _, ok := required[licenseID]; !ok && status == "missing" {
+			_, err := db.Exec(`
+                DELETE FROM credentialPlaceholders
+                WHERE employeeId = ? and licenseId = ? and status = 'missing' and createdBy = ?
+            `, employeeID, licenseID, userSub)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for licenseID, req := range required {
+		if _, ok := existing[licenseID]; ok {
+			continue
+		}
+
+		_, err := db.Exec(`
+            INSERT INTO credentialPlaceholders (
+                employeeId, licenseId, templateId, dueDate, createdBy
+            )
+            SELECT ?, ?, ?, DATE_ADD(CURDATE(), INTERVAL ? DAY), ?
+            FROM DUAL
+            WHERE NOT EXISTS (
+                SELECT 1 FROM employeeLicenses
+                WHERE employeeId = ? and licenseId = ? and deleted IS NULL
+            )
+        `, employeeID, licenseID, req.TemplateID, req.DueInDays, userSub, employeeID, licenseID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Requirements returns the licenses the onboarding templates currently
+// expect of an employee, keyed by license ID.
+func Requirements(db utils.DB, employeeID int64, userSub string) (map[int]Requirement, error) {
+	var jobTitle string
+	var departmentID sql.NullInt64
+	err := db.QueryRow(`
+        SELECT jobTitle, departmentId FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, employeeID, userSub).Scan(&jobTitle, &departmentID)
+	if err == sql.ErrNoRows {
+		return map[int]Requirement{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return templateRequirements(db, jobTitle, departmentID, userSub)
+}
+
+// templateRequirements matches the tenant's templates against a job title
+// and department.
+func templateRequirements(db utils.DB, jobTitle string, departmentID sql.NullInt64, userSub string) (map[int]Requirement, error) {
+	// Templates on a department also cover everything below it, so match
+	// against the employee's department and all of its ancestors.
+	rows, err := db.Query(`
+        WITH RECURSIVE ancestors AS (
+            SELECT id, parentId FROM orgUnits WHERE id = ? and deleted IS NULL
+            UNION
+            SELECT o.id, o.parentId FROM orgUnits o JOIN ancestors a on o.id = a.parentId
+            WHERE o.deleted IS NULL
+        )
+        SELECT t.id, i.licenseId, i.dueInDays
+        FROM onboardingTemplates t
+        JOIN onboardingTemplateItems i on i.templateId = t.id
+        JOIN licenses l on i.licenseId = l.id and l.deleted IS NULL
+        WHERE t.createdBy = ? and t.deleted IS NULL
+          and (t.jobTitle IS NULL or t.jobTitle = ?)
+          and (t.departmentId IS NULL or t.departmentId IN (SELECT id FROM ancestors))
+        ORDER BY i.dueInDays, t.id
+    `, departmentID, userSub, jobTitle)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The earliest due date wins when several templates want a license.
+	required := map[int]Requirement{}
+	for rows.Next() {
+		var templateID, licenseID, dueInDays int
+		if err := rows.Scan(&templateID, &licenseID, &dueInDays); err != nil {
+			return nil, err
+		}
+		if _, seen := required[licenseID]; !seen {
+			required[licenseID] = Requirement{templateID, dueInDays}
+		}
+	}
+
+	return required, rows.Err()
+}
+
+// Fulfill marks the missing placeholder an employee license satisfies, if
+// any, as met by it.
+func Fulfill(db utils.DB, employeeLicenseID int64, userSub string) error {
+	_, err := db.Exec(`
+        UPDATE credentialPlaceholders p
+        JOIN employeeLicenses el on el.employeeId = p.employeeId and el.licenseId = p.licenseId
+        SET p.status = 'fulfilled', p.employeeLicenseId = el.id, p.fulfilled = current_timestamp()
+        WHERE el.id = ? and el.deleted IS NULL and p.status = 'missing' and p.createdBy = ?
+    `, employeeLicenseID, userSub)
+	return err
+}
+
+// GetPlaceholders lists an employee's onboarding placeholders.
+func GetPlaceholders(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	allowed, err := access.Allows(db, c, id)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT p.id, p.employeeId, p.licenseId, l.name, p.templateId, p.dueDate, p.status,
+            p.status = 'missing' and p.dueDate < CURDATE(), p.employeeLicenseId, p.fulfilled
+        FROM credentialPlaceholders p
+        JOIN licenses l on p.licenseId = l.id
+        WHERE p.employeeId = ? and p.createdBy = ?
+        ORDER BY p.dueDate, l.name
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query placeholders"})
+		return
+	}
+	defer rows.Close()
+
+	placeholders := []Placeholder{}
+	for rows.Next() {
+		var p Placeholder
+		if err := rows.Scan(
+			&p.ID, &p.EmployeeID, &p.LicenseID, &p.LicenseName, &p.TemplateID, &p.DueDate, &p.Status,
+			&p.Overdue, &p.EmployeeLicenseID, &p.Fulfilled,
+		); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan placeholder data"})
+			return
+		}
+		placeholders = append(placeholders, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, placeholders)
+}
+
+// WaivePlaceholder closes a missing placeholder without a license, for
+// when HR decides the requirement doesn't apply to this person.
+func WaivePlaceholder(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE credentialPlaceholders
+        SET status = 'waived', fulfilled = current_timestamp()
+        WHERE id = ? and status = 'missing' and createdBy = ?
+    `, c.Param("id"), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to waive placeholder"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "missing placeholder not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Placeholder waived successfully"})
+}
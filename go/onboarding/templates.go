@@ -0,0 +1,339 @@
+package onboarding
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/orgunits"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Template lists the licenses new hires need. It applies to employees with
+// the given job title, in the given department or below it, or both when
+// both are set.
+type Template struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name" validate:"required,max=100"`
+	JobTitle     string `json:"jobTitle" validate:"max=100"`
+	DepartmentID *int   `json:"departmentId" validate:"omitempty,gt=0"`
+	Items        []Item `json:"items" validate:"required,min=1,dive"`
+}
+
+// Item is one required license type, due DueInDays after the employee
+// starts matching the template.
+type Item struct {
+	LicenseID int `json:"licenseId" validate:"required,gt=0"`
+	DueInDays int `json:"dueInDays" validate:"gte=0,lte=3650"`
+}
+
+func (t *Template) Normalize() {
+	t.Name = strings.TrimSpace(t.Name)
+	t.JobTitle = strings.TrimSpace(t.JobTitle)
+}
+
+func (t *Template) Check() validation.FieldErrors {
+	fields := validation.FieldErrors{}
+	if t.JobTitle == "" && t.DepartmentID == nil {
+		fields["jobTitle"] = "jobTitle or departmentId is required"
+	}
+
+	seen := map[int]bool{}
+	for i, item := range t.Items {
+		if seen[item.LicenseID] {
+			fields[fmt.Sprintf("items[%d].licenseId", i)] = "is listed more than once"
+		}
+		seen[item.LicenseID] = true
+	}
+	return fields
+}
+
+// nullable stores an empty job title as NULL, meaning any title.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func queryTemplates(db *sql.DB, userSub string, id string) ([]Template, error) {
+	query := `
+        SELECT t.id, t.name, COALESCE(t.jobTitle, ''), t.departmentId, i.licenseId, i.dueInDays
+        FROM onboardingTemplates t
+        LEFT JOIN onboardingTemplateItems i on i.templateId = t.id
+        WHERE t.createdBy = ? and t.deleted IS NULL`
+	args := []interface{}{userSub}
+	if id != "" {
+		query += " and t.id = ?"
+		args = append(args, id)
+	}
+	query += " ORDER BY t.name, t.id, i.dueInDays"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []Template{}
+	for rows.Next() {
+		var t Template
+		var licenseID, dueInDays sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.Name, &t.JobTitle, &t.DepartmentID, &licenseID, &dueInDays); err != nil {
+			return nil, err
+		}
+
+		if n := len(templates); n == 0 || templates[n-1].ID != t.ID {
+			t.Items = []Item{}
+			templates = append(templates, t)
+		}
+		if licenseID.Valid {
+			last := &templates[len(templates)-1]
+			last.Items = append(last.Items, Item{LicenseID: int(licenseID.Int64), DueInDays: int(dueInDays.Int64)})
+		}
+	}
+
+	return templates, rows.Err()
+}
+
+// checkReferences makes sure the department and license types exist for the
+// tenant. It writes the 400 itself.
+func checkReferences(db *sql.DB, c *gin.Context, t Template, userSub string) bool {
+	fields := validation.FieldErrors{}
+
+	if t.DepartmentID != nil {
+		exists, err := orgunits.Exists(db, orgunits.Department, *t.DepartmentID, userSub)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate template"})
+			return false
+		}
+		if !exists {
+			fields["departmentId"] = "does not exist"
+		}
+	}
+
+	for i, item := range t.Items {
+		var count int
+		err := db.QueryRow(`
+            SELECT COUNT(*) FROM licenses
+            WHERE id = ? and deleted IS NULL and createdBy = ?
+        `, item.LicenseID, userSub).Scan(&count)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate template"})
+			return false
+		}
+		if count == 0 {
+			fields[fmt.Sprintf("items[%d].licenseId", i)] = "does not exist"
+		}
+	}
+
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return false
+	}
+	return true
+}
+
+func saveItems(tx *sql.Tx, templateID int64, items []Item) error {
+	if _, err := tx.Exec(`DELETE FROM onboardingTemplateItems WHERE templateId = ?`, templateID); err != nil {
+		return err
+	}
+	for _, item := range items {
+		_, err := tx.Exec(`
+            INSERT INTO onboardingTemplateItems (templateId, licenseId, dueInDays)
+            VALUES (?, ?, ?)
+        `, templateID, item.LicenseID, item.DueInDays)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetTemplates(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	templates, err := queryTemplates(db, userSubStr, "")
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query onboarding templates"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, templates)
+}
+
+// PostTemplate creates a template. It only affects employees created or
+// re-classified from now on.
+func PostTemplate(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var t Template
+	if !validation.Bind(c, &t) {
+		return
+	}
+
+	if !checkReferences(db, c, t, userSubStr) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert onboarding template"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+        INSERT INTO onboardingTemplates (name, jobTitle, departmentId, createdBy)
+        VALUES (?, ?, ?, ?)
+    `, t.Name, nullable(t.JobTitle), t.DepartmentID, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert onboarding template"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted onboarding template ID"})
+		return
+	}
+
+	if err := saveItems(tx, id, t.Items); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save onboarding template items"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert onboarding template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Onboarding template inserted successfully", "id": id})
+}
+
+func PutTemplate(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var t Template
+	if !validation.Bind(c, &t) {
+		return
+	}
+
+	existing, err := queryTemplates(db, userSubStr, c.Param("id"))
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve onboarding template"})
+		return
+	}
+	if len(existing) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "onboarding template not found"})
+		return
+	}
+
+	if !checkReferences(db, c, t, userSubStr) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding template"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+        UPDATE onboardingTemplates
+        SET name = ?, jobTitle = ?, departmentId = ?
+        WHERE id = ? and createdBy = ?
+    `, t.Name, nullable(t.JobTitle), t.DepartmentID, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding template"})
+		return
+	}
+
+	if err := saveItems(tx, id, t.Items); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save onboarding template items"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding template"})
+		return
+	}
+
+	t.ID = int(id)
+	c.JSON(http.StatusOK, t)
+}
+
+// DeleteTemplate stops a template from applying. Missing placeholders it
+// created stay until the employee is next saved.
+func DeleteTemplate(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE onboardingTemplates
+        SET deleted = current_timestamp()
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, c.Param("id"), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete onboarding template"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "onboarding template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Onboarding template deleted successfully"})
+}
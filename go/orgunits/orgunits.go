@@ -0,0 +1,368 @@
+package orgunits
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Kind separates the two trees a tenant manages. Both live in the orgUnits
+// table and an employee sits at one node of each.
+type Kind string
+
+const (
+	Location   Kind = "location"
+	Department Kind = "department"
+)
+
+type OrgUnit struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name" validate:"required,max=100"`
+	ParentID      *int   `json:"parentId" validate:"omitempty,gt=0"`
+	EmployeeCount int    `json:"employeeCount"`
+}
+
+func (unit *OrgUnit) Normalize() {
+	unit.Name = strings.TrimSpace(unit.Name)
+}
+
+// List returns every node of a tree ordered by name. Parents aren't
+// guaranteed to come before their children, so callers should index by ID.
+func List(db *sql.DB, kind Kind, userSub string) ([]OrgUnit, error) {
+	column := EmployeeColumn(kind)
+
+	query := fmt.Sprintf(`
+	SELECT
+		o.id,
+		o.name,
+		o.parentId,
+		( SELECT COUNT(*) FROM employees e
+		  WHERE e.%s = o.id and e.deleted IS NULL and e.offboarded IS NULL ) as employeeCount
+	FROM orgUnits o
+	WHERE o.kind = ? and o.deleted IS NULL and o.createdBy = ?
+	ORDER BY o.name`, column)
+
+	rows, err := db.Query(query, kind, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := []OrgUnit{}
+	for rows.Next() {
+		var unit OrgUnit
+		if err := rows.Scan(&unit.ID, &unit.Name, &unit.ParentID, &unit.EmployeeCount); err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+
+	return units, rows.Err()
+}
+
+// Exists reports whether id is a live node of the given tree for the tenant.
+func Exists(db *sql.DB, kind Kind, id int, userSub string) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM orgUnits
+        WHERE id = ? and kind = ? and deleted IS NULL and createdBy = ?
+    `, id, kind, userSub).Scan(&count)
+	return count > 0, err
+}
+
+// Descendants returns id and every node below it.
+func Descendants(db *sql.DB, kind Kind, id int, userSub string) ([]int, error) {
+	rows, err := db.Query(`
+	WITH RECURSIVE tree AS (
+		SELECT id FROM orgUnits
+		WHERE id = ? and kind = ? and deleted IS NULL and createdBy = ?
+		UNION ALL
+		SELECT o.id FROM orgUnits o
+		JOIN tree t on o.parentId = t.id
+		WHERE o.deleted IS NULL
+	)
+	SELECT id FROM tree`, id, kind, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var nodeID int
+		if err := rows.Scan(&nodeID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, nodeID)
+	}
+
+	return ids, rows.Err()
+}
+
+// Scope reads the locationId and departmentId query parameters and returns a
+// condition limiting column, an employee id, to employees placed at that
+// node or anywhere below it. It returns an empty condition when neither
+// parameter is set.
+func Scope(db *sql.DB, c *gin.Context, column string) (string, []interface{}, error) {
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return "", nil, fmt.Errorf("user not found")
+	}
+
+	var clause strings.Builder
+	var args []interface{}
+
+	for _, kind := range []Kind{Location, Department} {
+		param := c.Query(EmployeeColumn(kind))
+		if param == "" {
+			continue
+		}
+
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %s", EmployeeColumn(kind))
+		}
+
+		ids, err := Descendants(db, kind, id, userSubStr)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if len(ids) == 0 {
+			clause.WriteString(" and 1 = 0")
+			continue
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+		fmt.Fprintf(&clause, " and %s in (select id from employees where %s in (%s))",
+			column, EmployeeColumn(kind), placeholders)
+		for _, nodeID := range ids {
+			args = append(args, nodeID)
+		}
+	}
+
+	return clause.String(), args, nil
+}
+
+// EmployeeColumn is the employees column that places an employee in a tree.
+func EmployeeColumn(kind Kind) string {
+	if kind == Department {
+		return "departmentId"
+	}
+	return "locationId"
+}
+
+func Get(db *sql.DB, c *gin.Context, kind Kind) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	units, err := List(db, kind, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to query %ss", kind)})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, units)
+}
+
+func Post(db *sql.DB, c *gin.Context, kind Kind) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var unit OrgUnit
+	if !validation.Bind(c, &unit) {
+		return
+	}
+
+	if unit.ParentID != nil {
+		exists, err := Exists(db, kind, *unit.ParentID, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to insert %s", kind)})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": gin.H{"parentId": "does not exist"}})
+			return
+		}
+	}
+
+	result, err := db.Exec(`
+        INSERT INTO orgUnits (
+            kind, name, parentId, createdBy
+        ) VALUES (?, ?, ?, ?)
+    `, kind, unit.Name, unit.ParentID, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to insert %s", kind)})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to retrieve inserted %s ID", kind)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%s inserted successfully", title(kind)), "id": id})
+}
+
+func Put(db *sql.DB, c *gin.Context, kind Kind) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var unit OrgUnit
+	if !validation.Bind(c, &unit) {
+		return
+	}
+
+	if unit.ParentID != nil {
+		// A node can't be moved underneath itself or one of its own children.
+		subtree, err := Descendants(db, kind, id, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update %s", kind)})
+			return
+		}
+		for _, nodeID := range subtree {
+			if nodeID == *unit.ParentID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": gin.H{"parentId": "can't be the node itself or one of its descendants"}})
+				return
+			}
+		}
+
+		exists, err := Exists(db, kind, *unit.ParentID, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update %s", kind)})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": gin.H{"parentId": "does not exist"}})
+			return
+		}
+	}
+
+	result, err := db.Exec(`
+        UPDATE orgUnits
+        SET name = ?, parentId = ?
+        WHERE id = ? and kind = ? and deleted IS NULL and createdBy = ?
+    `, unit.Name, unit.ParentID, id, kind, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update %s", kind)})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		exists, err := Exists(db, kind, id, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update %s", kind)})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s not found", kind)})
+			return
+		}
+	}
+
+	unit.ID = id
+	c.JSON(http.StatusOK, unit)
+}
+
+// Delete refuses to remove a node that still has children or employees, so
+// nobody silently drops out of the rollups.
+func Delete(db *sql.DB, c *gin.Context, kind Kind) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var children, employees int
+	err := db.QueryRow(fmt.Sprintf(`
+	SELECT
+		( SELECT COUNT(*) FROM orgUnits WHERE parentId = ? and kind = ? and deleted IS NULL and createdBy = ? ),
+		( SELECT COUNT(*) FROM employees WHERE %s = ? and deleted IS NULL and createdBy = ? )`, EmployeeColumn(kind)),
+		id, kind, userSubStr, id, userSubStr).Scan(&children, &employees)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete %s", kind)})
+		return
+	}
+
+	if children > 0 || employees > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     fmt.Sprintf("%s still has child nodes or employees assigned", title(kind)),
+			"children":  children,
+			"employees": employees,
+		})
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE orgUnits
+        SET deleted = current_timestamp()
+        WHERE id = ? and kind = ? and deleted IS NULL and createdBy = ?
+    `, id, kind, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete %s", kind)})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s not found", kind)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%s deleted successfully", title(kind))})
+}
+
+func title(kind Kind) string {
+	return strings.ToUpper(string(kind[:1])) + string(kind[1:])
+}
@@ -0,0 +1,205 @@
+package portal
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/mailer"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+type LoginRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (req *LoginRequest) Normalize() {
+	req.Email = validation.NormalizeEmail(req.Email)
+}
+
+type SessionRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// PostLogin emails a login link to every active employee with the given
+// address. The response is the same whether or not anyone matched, so the
+// endpoint can't be used to find out who works where.
+func PostLogin(db *sql.DB, c *gin.Context) {
+
+	var req LoginRequest
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	portalURL := os.Getenv("PORTAL_URL")
+	if _, err := secret(); err != nil || portalURL == "" {
+		fmt.Println("Error: portal is not configured: ", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The employee portal is not configured"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, firstName, createdBy
+        FROM employees
+        WHERE email = ? and deleted IS NULL and offboarded IS NULL
+    `, req.Email)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+	defer rows.Close()
+
+	type match struct {
+		id        int
+		firstName string
+		tenant    string
+	}
+	var matches []match
+	for rows.Next() {
+		var m match
+		if err := rows.Scan(&m.id, &m.firstName, &m.tenant); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+			return
+		}
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send login link"})
+		return
+	}
+
+	for _, m := range matches {
+		n, err := nonce()
+		if err != nil {
+			fmt.Println("Error: ", err)
+			continue
+		}
+
+		token, err := sign(claims{
+			EmployeeID: m.id,
+			Tenant:     m.tenant,
+			Purpose:    purposeLink,
+			Expires:    time.Now().Add(linkTTL).Unix(),
+			Nonce:      n,
+		})
+		if err != nil {
+			fmt.Println("Error: ", err)
+			continue
+		}
+
+		link := strings.TrimSuffix(portalURL, "/") + "/login?token=" + url.QueryEscape(token)
+		body := fmt.Sprintf("Hi %s,\n\nUse this link to sign in to your credentials portal. It works once and expires in %d minutes.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			m.firstName, int(linkTTL.Minutes()), link)
+
+		if err := mailer.Send(req.Email, "Your AccrediTrack sign-in link", body); err != nil {
+			fmt.Println("Error: ", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If that email is on file, a sign-in link is on its way"})
+}
+
+// PostSession trades a login link for a session token. Each link works
+// once.
+func PostSession(db *sql.DB, c *gin.Context) {
+
+	var req SessionRequest
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	link, err := verify(req.Token, purposeLink)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This sign-in link is invalid or has expired"})
+		return
+	}
+
+	if !active(db, c, link) {
+		return
+	}
+
+	_, err = db.Exec(`INSERT INTO portalLinkUses (nonce, employeeId) VALUES (?, ?)`, link.Nonce, link.EmployeeID)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This sign-in link has already been used"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+
+	expires := time.Now().Add(sessionTTL)
+	token, err := sign(claims{
+		EmployeeID: link.EmployeeID,
+		Tenant:     link.Tenant,
+		Purpose:    purposeSession,
+		Expires:    expires.Unix(),
+	})
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires": expires.UTC().Format(time.RFC3339)})
+}
+
+// Auth authenticates portal requests by session token. It sets userSub to
+// the employee's tenant and portalEmployeeId to the employee.
+func Auth(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is missing"})
+			c.Abort()
+			return
+		}
+
+		session, err := verify(token, purposeSession)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+			c.Abort()
+			return
+		}
+
+		if !active(db, c, session) {
+			c.Abort()
+			return
+		}
+
+		c.Set("userSub", session.Tenant)
+		c.Set("portalEmployeeId", session.EmployeeID)
+		c.Next()
+	}
+}
+
+// active makes sure the employee a token names still exists. Deleting an
+// employee ends their portal access straight away. It writes the error
+// response itself.
+func active(db *sql.DB, c *gin.Context, token claims) bool {
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM employees
+        WHERE id = ? and deleted IS NULL and offboarded IS NULL and createdBy = ?
+    `, token.EmployeeID, token.Tenant).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This account is no longer active"})
+		return false
+	}
+	return true
+}
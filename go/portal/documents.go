@@ -0,0 +1,109 @@
+package portal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// maxDocumentSize caps uploads; a phone photo of a card is well under it.
+const maxDocumentSize = 10 << 20
+
+// documentTypes are the accepted uploads, by sniffed content type, with the
+// extension they are stored under.
+var documentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+var errUnsupportedType = fmt.Errorf("only PDF, JPEG and PNG files are accepted")
+
+type Document struct {
+	ID                int    `json:"id"`
+	EmployeeID        int    `json:"employeeId"`
+	EmployeeLicenseID *int   `json:"employeeLicenseId"`
+	PendingChangeID   *int   `json:"pendingChangeId"`
+	FileName          string `json:"fileName"`
+	ContentType       string `json:"contentType"`
+	Size              int64  `json:"size"`
+	Status            string `json:"status"`
+	Created           string `json:"created"`
+}
+
+func documentsDir() (string, error) {
+	dir := os.Getenv("DOCUMENTS_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("DOCUMENTS_DIR is not configured")
+	}
+	return dir, nil
+}
+
+// store writes an upload under DOCUMENTS_DIR and returns its path relative
+// to it and the sniffed content type. Files are grouped per tenant and
+// named by nonce; the original name is only kept in the database.
+func store(tenant string, header *multipart.FileHeader) (string, string, error) {
+	dir, err := documentsDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", "", err
+	}
+	contentType := http.DetectContentType(sniff[:n])
+	ext, ok := documentTypes[contentType]
+	if !ok {
+		return "", "", errUnsupportedType
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(tenant))
+	tenantDir := hex.EncodeToString(sum[:8])
+	if err := os.MkdirAll(filepath.Join(dir, tenantDir), 0o750); err != nil {
+		return "", "", err
+	}
+
+	name, err := nonce()
+	if err != nil {
+		return "", "", err
+	}
+	relative := filepath.Join(tenantDir, name+ext)
+
+	out, err := os.OpenFile(filepath.Join(dir, relative), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := io.Copy(out, io.LimitReader(file, maxDocumentSize)); err != nil {
+		out.Close()
+		return "", "", err
+	}
+	return relative, contentType, out.Close()
+}
+
+// RemoveDocument deletes a stored file given its path relative to
+// DOCUMENTS_DIR. Failures are only logged.
+func RemoveDocument(relative string) {
+	dir, err := documentsDir()
+	if err != nil {
+		return
+	}
+	if err := os.Remove(filepath.Join(dir, relative)); err != nil {
+		fmt.Println("Error: ", err)
+	}
+}
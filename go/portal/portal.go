@@ -0,0 +1,385 @@
+package portal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/licenses"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+type Profile struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	JobTitle  string `json:"jobTitle"`
+}
+
+type License struct {
+	ID              int    `json:"id"`
+	LicenseID       int    `json:"licenseId"`
+	LicenseName     string `json:"licenseName"`
+	IssueDate       string `json:"issueDate"`
+	ExpDate         string `json:"expDate"`
+	PendingChangeID *int   `json:"pendingChangeId"`
+	// InvalidDueTo lists the prerequisites that have to be renewed or
+	// obtained before this license counts again.
+	InvalidDueTo []licenses.Blocker `json:"invalidDueTo"`
+}
+
+// Renewal is an employee's report of a renewed license. It only takes
+// effect once HR approves it.
+type Renewal struct {
+	IssueDate string `json:"issueDate" validate:"required,datetime=2006-01-02"`
+	ExpDate   string `json:"expDate" validate:"required,datetime=2006-01-02"`
+	Note      string `json:"note" validate:"max=1000"`
+}
+
+func (r *Renewal) Normalize() {
+	r.IssueDate = validation.NormalizeDate(r.IssueDate)
+	r.ExpDate = validation.NormalizeDate(r.ExpDate)
+	r.Note = strings.TrimSpace(r.Note)
+}
+
+func (r *Renewal) Check() validation.FieldErrors {
+	issued, err := validation.ParseDate(r.IssueDate)
+	if err != nil {
+		return nil
+	}
+	expires, err := validation.ParseDate(r.ExpDate)
+	if err != nil {
+		return nil
+	}
+	if expires.Before(issued) {
+		return validation.FieldErrors{"expDate": "must be on or after issueDate"}
+	}
+	return nil
+}
+
+// employee returns the tenant and employee a portal request is for.
+func employee(c *gin.Context) (string, int, bool) {
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return "", 0, false
+	}
+	return userSubStr, c.GetInt("portalEmployeeId"), true
+}
+
+func GetMe(db *sql.DB, c *gin.Context) {
+
+	userSubStr, employeeID, ok := employee(c)
+	if !ok {
+		return
+	}
+
+	var profile Profile
+	err := db.QueryRow(`
+        SELECT id, firstName, lastName, email, jobTitle
+        FROM employees
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, employeeID, userSubStr).Scan(&profile.ID, &profile.FirstName, &profile.LastName, &profile.Email, &profile.JobTitle)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func GetLicenses(db *sql.DB, c *gin.Context) {
+
+	userSubStr, employeeID, ok := employee(c)
+	if !ok {
+		return
+	}
+
+	invalid, err := licenses.Invalid(db, userSubStr, " and el.employeeId = ?", []interface{}{employeeID})
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check license prerequisites"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT el.id, el.licenseId, l.name, el.issueDate, el.expDate,
+            ( SELECT MAX(pc.id) FROM pendingChanges pc
+              WHERE pc.employeeLicenseId = el.id and pc.status = 'pending' ) as pendingChangeId
+        FROM employeeLicenses el
+        JOIN licenses l on el.licenseId = l.id
+        WHERE el.employeeId = ? and el.deleted IS NULL and el.createdBy = ?
+        ORDER BY el.expDate
+    `, employeeID, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query licenses"})
+		return
+	}
+	defer rows.Close()
+
+	held := []License{}
+	for rows.Next() {
+		var lic License
+		if err := rows.Scan(&lic.ID, &lic.LicenseID, &lic.LicenseName, &lic.IssueDate, &lic.ExpDate, &lic.PendingChangeID); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan license data"})
+			return
+		}
+		lic.InvalidDueTo = invalid[lic.ID]
+		if lic.InvalidDueTo == nil {
+			lic.InvalidDueTo = []licenses.Blocker{}
+		}
+		held = append(held, lic)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, held)
+}
+
+// ownsLicense checks that an employee license belongs to the portal user.
+// It writes the 404 itself.
+func ownsLicense(db *sql.DB, c *gin.Context, userSub string, employeeID int, id interface{}) bool {
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM employeeLicenses
+        WHERE id = ? and employeeId = ? and deleted IS NULL and createdBy = ?
+    `, id, employeeID, userSub).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve license"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "license not found"})
+		return false
+	}
+	return true
+}
+
+// PostRenewal files new dates for one of the employee's licenses as a
+// pending change.
+func PostRenewal(db *sql.DB, c *gin.Context) {
+
+	userSubStr, employeeID, ok := employee(c)
+	if !ok {
+		return
+	}
+
+	id := c.Param("id")
+
+	var renewal Renewal
+	if !validation.Bind(c, &renewal) {
+		return
+	}
+
+	if !ownsLicense(db, c, userSubStr, employeeID, id) {
+		return
+	}
+
+	var pending int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM pendingChanges
+        WHERE employeeLicenseId = ? and kind = 'renewal' and status = 'pending'
+    `, id).Scan(&pending)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit renewal"})
+		return
+	}
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A renewal for this license is already waiting for review"})
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]string{"issueDate": renewal.IssueDate, "expDate": renewal.ExpDate})
+
+	result, err := db.Exec(`
+        INSERT INTO pendingChanges (
+            employeeId, employeeLicenseId, kind, payload, note, createdBy
+        ) VALUES (?, ?, 'renewal', ?, ?, ?)
+    `, employeeID, id, payload, renewal.Note, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit renewal"})
+		return
+	}
+
+	changeID, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submitted renewal ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Renewal submitted for review", "id": changeID})
+}
+
+// PostDocument uploads a file. It can be attached to one of the employee's
+// pending changes with pendingChangeId; otherwise the upload becomes a
+// pending change of its own.
+func PostDocument(db *sql.DB, c *gin.Context) {
+
+	userSubStr, employeeID, ok := employee(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxDocumentSize+1<<20)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{"file": "is required"}})
+		return
+	}
+	if header.Size > maxDocumentSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{"file": fmt.Sprintf("must be at most %d MB", maxDocumentSize>>20)}})
+		return
+	}
+
+	var licenseID, changeID *int
+	for _, field := range []struct {
+		name   string
+		target **int
+	}{{"employeeLicenseId", &licenseID}, {"pendingChangeId", &changeID}} {
+		value := c.PostForm(field.name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{field.name: "must be an id"}})
+			return
+		}
+		*field.target = &id
+	}
+
+	if licenseID != nil && !ownsLicense(db, c, userSubStr, employeeID, *licenseID) {
+		return
+	}
+
+	if changeID != nil {
+		var changeLicenseID *int
+		err := db.QueryRow(`
+            SELECT employeeLicenseId FROM pendingChanges
+            WHERE id = ? and employeeId = ? and status = 'pending' and createdBy = ?
+        `, *changeID, employeeID, userSubStr).Scan(&changeLicenseID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "pending change not found"})
+			return
+		}
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pending change"})
+			return
+		}
+		if licenseID == nil {
+			licenseID = changeLicenseID
+		}
+	}
+
+	path, contentType, err := store(userSubStr, header)
+	if err == errUnsupportedType {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": validation.FieldErrors{"file": err.Error()}})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store document"})
+		return
+	}
+
+	// Don't leave the file behind if the database side fails.
+	committed := false
+	defer func() {
+		if !committed {
+			RemoveDocument(path)
+		}
+	}()
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+		return
+	}
+	defer tx.Rollback()
+
+	if changeID == nil {
+		result, err := tx.Exec(`
+            INSERT INTO pendingChanges (
+                employeeId, employeeLicenseId, kind, payload, note, createdBy
+            ) VALUES (?, ?, 'document', '{}', '', ?)
+        `, employeeID, licenseID, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+			return
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+			return
+		}
+		newID := int(id)
+		changeID = &newID
+	}
+
+	result, err := tx.Exec(`
+        INSERT INTO documents (
+            employeeId, employeeLicenseId, pendingChangeId, fileName,
+            contentType, size, storagePath, createdBy
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    `, employeeID, licenseID, changeID, header.Filename, contentType, header.Size, path, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+		return
+	}
+
+	documentID, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted document ID"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save document"})
+		return
+	}
+	committed = true
+
+	c.JSON(http.StatusOK, gin.H{"message": "Document uploaded for review", "id": documentID, "pendingChangeId": *changeID})
+}
+
+// GetSubmissions lists what the employee has sent in and where it stands.
+func GetSubmissions(db *sql.DB, c *gin.Context) {
+
+	userSubStr, employeeID, ok := employee(c)
+	if !ok {
+		return
+	}
+
+	changes, err := queryChanges(db, " and pc.employeeId = ?", []interface{}{userSubStr, employeeID})
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query submissions"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, changes)
+}
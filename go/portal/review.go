@@ -0,0 +1,344 @@
+package portal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/expiration"
+	"github.com/benfortenberry/accredi-track/onboarding"
+	"github.com/benfortenberry/accredi-track/timeline"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// PendingChange is something an employee submitted through the portal that
+// HR has to approve before it touches their records.
+type PendingChange struct {
+	ID                int               `json:"id"`
+	EmployeeID        int               `json:"employeeId"`
+	FirstName         string            `json:"firstName"`
+	LastName          string            `json:"lastName"`
+	EmployeeLicenseID *int              `json:"employeeLicenseId"`
+	LicenseName       *string           `json:"licenseName"`
+	Kind              string            `json:"kind"`
+	Changes           map[string]string `json:"changes"`
+	Note              string            `json:"note"`
+	Status            string            `json:"status"`
+	ReviewNote        string            `json:"reviewNote"`
+	Created           string            `json:"created"`
+	Reviewed          *string           `json:"reviewed"`
+	Documents         []Document        `json:"documents"`
+}
+
+type Review struct {
+	Note string `json:"note" validate:"max=1000"`
+	// ExpDateOverride keeps a renewal's expDate when it differs from the
+	// license type's expiration rule, as with employee license updates.
+	ExpDateOverride bool `json:"expDateOverride"`
+}
+
+func (r *Review) Normalize() {
+	r.Note = strings.TrimSpace(r.Note)
+}
+
+// queryChanges loads pending changes and their documents. args start with
+// the tenant, followed by the arguments of where.
+func queryChanges(db *sql.DB, where string, args []interface{}) ([]PendingChange, error) {
+	rows, err := db.Query(`
+        SELECT pc.id, pc.employeeId, e.firstName, e.lastName, pc.employeeLicenseId, l.name,
+            pc.kind, pc.payload, pc.note, pc.status, pc.reviewNote, pc.created, pc.reviewed
+        FROM pendingChanges pc
+        JOIN employees e on pc.employeeId = e.id
+        LEFT JOIN employeeLicenses el on pc.employeeLicenseId = el.id
+        LEFT JOIN licenses l on el.licenseId = l.id
+        WHERE pc.createdBy = ?`+where+`
+        ORDER BY pc.created DESC, pc.id DESC
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []PendingChange{}
+	index := map[int]int{}
+	for rows.Next() {
+		var pc PendingChange
+		var payload string
+		if err := rows.Scan(
+			&pc.ID, &pc.EmployeeID, &pc.FirstName, &pc.LastName, &pc.EmployeeLicenseID, &pc.LicenseName,
+			&pc.Kind, &payload, &pc.Note, &pc.Status, &pc.ReviewNote, &pc.Created, &pc.Reviewed,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(payload), &pc.Changes); err != nil {
+			return nil, err
+		}
+		pc.Documents = []Document{}
+		index[pc.ID] = len(changes)
+		changes = append(changes, pc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	docArgs := []interface{}{args[0]}
+	for _, pc := range changes {
+		docArgs = append(docArgs, pc.ID)
+	}
+
+	docRows, err := db.Query(`
+        SELECT id, employeeId, employeeLicenseId, pendingChangeId, fileName, contentType, size, status, created
+        FROM documents
+        WHERE createdBy = ? and deleted IS NULL
+          and pendingChangeId IN (`+strings.TrimSuffix(strings.Repeat("?,", len(changes)), ",")+`)
+        ORDER BY id
+    `, docArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer docRows.Close()
+
+	for docRows.Next() {
+		var doc Document
+		if err := docRows.Scan(
+			&doc.ID, &doc.EmployeeID, &doc.EmployeeLicenseID, &doc.PendingChangeID,
+			&doc.FileName, &doc.ContentType, &doc.Size, &doc.Status, &doc.Created,
+		); err != nil {
+			return nil, err
+		}
+		if i, ok := index[*doc.PendingChangeID]; ok {
+			changes[i].Documents = append(changes[i].Documents, doc)
+		}
+	}
+
+	return changes, docRows.Err()
+}
+
+// GetPendingChanges lists portal submissions for HR, pending ones only
+// unless ?status= says otherwise. Managers see their reports' submissions.
+func GetPendingChanges(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	status := c.DefaultQuery("status", "pending")
+	if status != "pending" && status != "approved" && status != "rejected" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, approved or rejected"})
+		return
+	}
+
+	scope, scopeArgs := access.Scope(c, "pc.employeeId")
+	args := append([]interface{}{userSubStr, status}, scopeArgs...)
+
+	changes, err := queryChanges(db, " and pc.status = ?"+scope, args)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query pending changes"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, changes)
+}
+
+// loadPending returns a pending change the caller may review. It writes the
+// error response itself.
+func loadPending(db *sql.DB, c *gin.Context, userSub string) (PendingChange, bool) {
+	scope, scopeArgs := access.Scope(c, "pc.employeeId")
+	args := append([]interface{}{userSub, c.Param("id")}, scopeArgs...)
+
+	changes, err := queryChanges(db, " and pc.id = ?"+scope, args)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pending change"})
+		return PendingChange{}, false
+	}
+	if len(changes) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pending change not found"})
+		return PendingChange{}, false
+	}
+	if changes[0].Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "This change has already been " + changes[0].Status})
+		return PendingChange{}, false
+	}
+	return changes[0], true
+}
+
+// ApproveChange applies a submission. Renewals overwrite the license dates
+// and are checked against the license type's expiration rule; documents are
+// just marked approved.
+func ApproveChange(db *sql.DB, c *gin.Context) {
+	review(db, c, "approved")
+}
+
+func RejectChange(db *sql.DB, c *gin.Context) {
+	review(db, c, "rejected")
+}
+
+func review(db *sql.DB, c *gin.Context, status string) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var req Review
+	if c.Request.ContentLength != 0 && !validation.Bind(c, &req) {
+		return
+	}
+
+	change, ok := loadPending(db, c, userSubStr)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review change"})
+		return
+	}
+	defer tx.Rollback()
+
+	if status == "approved" && change.Kind == "renewal" {
+		var licenseID int
+		err := tx.QueryRow(`
+            SELECT licenseId FROM employeeLicenses
+            WHERE id = ? and employeeId = ? and deleted IS NULL and createdBy = ?
+            FOR UPDATE
+        `, change.EmployeeLicenseID, change.EmployeeID, userSubStr).Scan(&licenseID)
+		if err == sql.ErrNoRows || change.EmployeeLicenseID == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "The license this renewal is for no longer exists"})
+			return
+		}
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply renewal"})
+			return
+		}
+
+		// Renewals go through the same expiration rule and version pinning
+		// as employee license updates.
+		resolved, fields, err := expiration.Resolve(tx, change.EmployeeID, licenseID,
+			change.Changes["issueDate"], change.Changes["expDate"], req.ExpDateOverride, userSubStr)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply renewal"})
+			return
+		}
+		if len(fields) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+			return
+		}
+
+		_, err = tx.Exec(`
+            UPDATE employeeLicenses
+            SET issueDate = ?, expDate = ?, expDateOverridden = ?, licenseVersionId = ?
+            WHERE id = ?
+        `, change.Changes["issueDate"], resolved.ExpDate, resolved.Overridden, resolved.VersionID, change.EmployeeLicenseID)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply renewal"})
+			return
+		}
+
+		if err := onboarding.Fulfill(tx, int64(*change.EmployeeLicenseID), userSubStr); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update onboarding placeholders"})
+			return
+		}
+
+		err = timeline.Record(tx, userSubStr, timeline.Entry{
+			EmployeeID:        change.EmployeeID,
+			EmployeeLicenseID: change.EmployeeLicenseID,
+			Kind:              timeline.LicenseRenewed,
+			Detail: gin.H{
+				"issueDate":       change.Changes["issueDate"],
+				"expDate":         resolved.ExpDate,
+				"pendingChangeId": change.ID,
+			},
+		})
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply renewal"})
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+        UPDATE pendingChanges
+        SET status = ?, reviewNote = ?, reviewedBy = ?, reviewed = current_timestamp()
+        WHERE id = ? and status = 'pending'
+    `, status, req.Note, c.GetString("callerSub"), change.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review change"})
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE documents SET status = ? WHERE pendingChangeId = ?`, status, change.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review change documents"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to review change"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Change " + status})
+}
+
+// GetDocument streams an uploaded document to HR.
+func GetDocument(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	scope, scopeArgs := access.Scope(c, "employeeId")
+
+	var fileName, contentType, path string
+	err := db.QueryRow(`
+        SELECT fileName, contentType, storagePath
+        FROM documents
+        WHERE id = ? and deleted IS NULL and createdBy = ?`+scope,
+		append([]interface{}{c.Param("id"), userSubStr}, scopeArgs...)...).Scan(&fileName, &contentType, &path)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve document"})
+		return
+	}
+
+	dir, err := documentsDir()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve document"})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.FileAttachment(filepath.Join(dir, path), fileName)
+}
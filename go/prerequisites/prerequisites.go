@@ -0,0 +1,125 @@
+package prerequisites
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/benfortenberry/accredi-track/utils"
+)
+
+// Blocker statuses.
+const (
+	BlockerMissing = "missing"
+	BlockerExpired = "expired"
+)
+
+// Blocker is the root cause of an invalid employee license: a prerequisite
+// the employee is missing or only holds expired. When a prerequisite is
+// itself invalid its own blockers are reported instead.
+type Blocker struct {
+	LicenseID   int     `json:"licenseId"`
+	LicenseName string  `json:"licenseName"`
+	Status      string  `json:"status"`
+	ExpDate     *string `json:"expDate"`
+}
+
+// prerequisiteCheck is one prerequisite of an employee license, with the
+// employee's latest record of it, if any.
+type prerequisiteCheck struct {
+	prerequisiteID int
+	name           string
+	heldID         sql.NullInt64
+	expDate        sql.NullString
+	expired        bool
+}
+
+// Invalid works out which employee licenses are invalid because a
+// prerequisite is missing or expired, keyed by employee license ID. scope is
+// a condition on el, usually its employeeId, selecting the licenses to check.
+func Invalid(db utils.DB, userSub string, scope string, scopeArgs []interface{}) (map[int][]Blocker, error) {
+	rows, err := db.Query(`
+        SELECT el.id, lp.prerequisiteId, p.name, held.id, held.expDate, held.expDate < CURDATE()
+        FROM employeeLicenses el
+        JOIN licensePrerequisites lp on lp.licenseId = el.licenseId
+        JOIN licenses p on lp.prerequisiteId = p.id and p.deleted IS NULL
+        LEFT JOIN employeeLicenses held on held.id = (
+            SELECT h.id FROM employeeLicenses h
+            WHERE h.employeeId = el.employeeId and h.licenseId = lp.prerequisiteId and h.deleted IS NULL
+            ORDER BY h.expDate DESC, h.id DESC
+            LIMIT 1
+        )
+        WHERE el.createdBy = ? and el.deleted IS NULL`+scope+`
+        ORDER BY el.id, p.name`,
+		append([]interface{}{userSub}, scopeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := map[int][]prerequisiteCheck{}
+	for rows.Next() {
+		var id int
+		var check prerequisiteCheck
+		var expired sql.NullBool
+		if err := rows.Scan(&id, &check.prerequisiteID, &check.name, &check.heldID, &check.expDate, &expired); err != nil {
+			return nil, err
+		}
+		check.expired = expired.Bool
+		checks[id] = append(checks[id], check)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resolved := map[int][]Blocker{}
+	var resolve func(id int, visiting map[int]bool) []Blocker
+	resolve = func(id int, visiting map[int]bool) []Blocker {
+		if blockers, ok := resolved[id]; ok {
+			return blockers
+		}
+		// A cycle can't be saved, but don't recurse forever if one exists.
+		if visiting[id] {
+			return nil
+		}
+		visiting[id] = true
+
+		var blockers []Blocker
+		for _, check := range checks[id] {
+			switch {
+			case !check.heldID.Valid:
+				blockers = append(blockers, Blocker{LicenseID: check.prerequisiteID, LicenseName: check.name, Status: BlockerMissing})
+			case check.expired:
+				expDate := check.expDate.String
+				blockers = append(blockers, Blocker{LicenseID: check.prerequisiteID, LicenseName: check.name, Status: BlockerExpired, ExpDate: &expDate})
+			default:
+				blockers = append(blockers, resolve(int(check.heldID.Int64), visiting)...)
+			}
+		}
+
+		resolved[id] = blockers
+		return blockers
+	}
+
+	invalid := map[int][]Blocker{}
+	for id := range checks {
+		if blockers := resolve(id, map[int]bool{}); len(blockers) > 0 {
+			invalid[id] = dedupe(blockers)
+		}
+	}
+	return invalid, nil
+}
+
+// dedupe drops repeated root causes, which happen when two prerequisites
+// share one.
+func dedupe(blockers []Blocker) []Blocker {
+	seen := map[int]bool{}
+	unique := blockers[:0:0]
+	for _, blocker := range blockers {
+		if !seen[blocker.LicenseID] {
+			seen[blocker.LicenseID] = true
+			unique = append(unique, blocker)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i].LicenseName < unique[j].LicenseName })
+	return unique
+}
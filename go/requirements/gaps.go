@@ -0,0 +1,445 @@
+package requirements
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/jurisdictions"
+	"github.com/benfortenberry/accredi-track/orgunits"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Gap statuses.
+const (
+	// GapMissing means the employee has never had the license on file.
+	GapMissing = "missing"
+	// GapExpired means every record of the license they hold has expired.
+	GapExpired = "expired"
+)
+
+// Gap is a required license type an employee doesn't currently hold, in
+// Jurisdiction when the requirement is for one. RequirementIDs lists the
+// requirements asking for it.
+type Gap struct {
+	EmployeeID     int     `json:"employeeId"`
+	FirstName      string  `json:"firstName"`
+	LastName       string  `json:"lastName"`
+	JobTitle       string  `json:"jobTitle"`
+	LicenseID      int     `json:"licenseId"`
+	LicenseName    string  `json:"licenseName"`
+	Jurisdiction   string  `json:"jurisdiction"`
+	Status         string  `json:"status"`
+	ExpDate        *string `json:"expDate"`
+	RequirementIDs []int   `json:"requirementIds"`
+}
+
+// matrix is the tenant's requirements with what is needed to match them
+// against employees.
+type matrix struct {
+	requirements []Requirement
+	// parents maps each department to the one above it.
+	parents map[int]int
+	// tags holds the tag IDs of each employee.
+	tags map[int]map[int]bool
+	// works holds where each employee works, when any requirement is for
+	// a jurisdiction.
+	works map[int][]string
+}
+
+type candidate struct {
+	id           int
+	firstName    string
+	lastName     string
+	jobTitle     string
+	departmentID *int
+}
+
+type holding struct {
+	expDate string
+	current bool
+}
+
+type pair struct {
+	employeeID int
+	licenseID  int
+}
+
+// need is a license type required of an employee, in a jurisdiction or
+// anywhere.
+type need struct {
+	licenseID    int
+	jurisdiction string
+}
+
+// jurisdictional reports whether any requirement is for a jurisdiction.
+func (m *matrix) jurisdictional() bool {
+	for _, req := range m.requirements {
+		if req.Jurisdiction != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// loadMatrix reads the requirements and, when there are any, the department
+// tree and the tags of the employees scope selects. scope is a condition on
+// e.id.
+func loadMatrix(db *sql.DB, userSub string, scope string, scopeArgs []interface{}) (*matrix, error) {
+	requirements, err := queryRequirements(db, userSub, "")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &matrix{requirements: requirements, parents: map[int]int{}, tags: map[int]map[int]bool{}, works: map[int][]string{}}
+	if len(requirements) == 0 {
+		return m, nil
+	}
+
+	rows, err := db.Query(`
+        SELECT id, parentId FROM orgUnits
+        WHERE kind = ? and parentId IS NOT NULL and deleted IS NULL and createdBy = ?
+    `, orgunits.Department, userSub)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parentID int
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		m.parents[id] = parentID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagRows, err := db.Query(`
+        SELECT et.employeeId, et.tagId
+        FROM employeeTags et
+        JOIN employees e on et.employeeId = e.id
+        WHERE e.createdBy = ? and e.deleted IS NULL`+scope,
+		append([]interface{}{userSub}, scopeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var employeeID, tagID int
+		if err := tagRows.Scan(&employeeID, &tagID); err != nil {
+			return nil, err
+		}
+		if m.tags[employeeID] == nil {
+			m.tags[employeeID] = map[int]bool{}
+		}
+		m.tags[employeeID][tagID] = true
+	}
+	if err := tagRows.Err(); err != nil {
+		return nil, err
+	}
+
+	if m.jurisdictional() {
+		if m.works, err = jurisdictions.Load(db, userSub, scope, scopeArgs); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// required returns the license types the matrix asks of an employee, each
+// with the requirements asking for it.
+func (m *matrix) required(emp candidate) map[need][]int {
+	required := map[need][]int{}
+	for _, req := range m.requirements {
+		if req.JobTitle != "" && req.JobTitle != emp.jobTitle {
+			continue
+		}
+		if req.DepartmentID != nil && !m.within(emp.departmentID, *req.DepartmentID) {
+			continue
+		}
+		if req.tagID != nil && !m.tags[emp.id][*req.tagID] {
+			continue
+		}
+		if req.Jurisdiction != "" && !jurisdictions.Contains(m.works[emp.id], req.Jurisdiction) {
+			continue
+		}
+		key := need{req.LicenseID, req.Jurisdiction}
+		required[key] = append(required[key], req.ID)
+	}
+	return required
+}
+
+// within reports whether department is ancestor or somewhere below it.
+func (m *matrix) within(department *int, ancestor int) bool {
+	if department == nil {
+		return false
+	}
+	// Bounded by the tree size so a cycle can't loop forever.
+	id := *department
+	for i := 0; i <= len(m.parents); i++ {
+		if id == ancestor {
+			return true
+		}
+		parentID, ok := m.parents[id]
+		if !ok {
+			return false
+		}
+		id = parentID
+	}
+	return false
+}
+
+// Required returns the license types the requirements matrix asks of an
+// employee, keyed by license ID, with the requirements asking for each.
+func Required(db *sql.DB, employeeID int64, userSub string) (map[int][]int, error) {
+	scope := " and e.id = ?"
+	scopeArgs := []interface{}{employeeID}
+
+	m, err := loadMatrix(db, userSub, scope, scopeArgs)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.requirements) == 0 {
+		return map[int][]int{}, nil
+	}
+
+	emp := candidate{id: int(employeeID)}
+	err = db.QueryRow(`
+        SELECT e.jobTitle, e.departmentId FROM employees e
+        WHERE e.createdBy = ? and e.deleted IS NULL`+scope,
+		append([]interface{}{userSub}, scopeArgs...)...).Scan(&emp.jobTitle, &emp.departmentID)
+	if err == sql.ErrNoRows {
+		return map[int][]int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	required := map[int][]int{}
+	for key, requirementIDs := range m.required(emp) {
+		required[key.licenseID] = append(required[key.licenseID], requirementIDs...)
+	}
+	return required, nil
+}
+
+// Find lists the gaps of the active employees scope selects, a condition on
+// e.id. A required license counts as held while any record of it is
+// unexpired; requirements waived through an onboarding placeholder don't
+// count. A requirement for a jurisdiction is only met by a license valid
+// there.
+func Find(db *sql.DB, userSub string, scope string, scopeArgs []interface{}) ([]Gap, error) {
+	m, err := loadMatrix(db, userSub, scope, scopeArgs)
+	if err != nil {
+		return nil, err
+	}
+	gaps := []Gap{}
+	if len(m.requirements) == 0 {
+		return gaps, nil
+	}
+
+	args := append([]interface{}{userSub}, scopeArgs...)
+
+	var employees []candidate
+	rows, err := db.Query(`
+        SELECT e.id, e.firstName, e.lastName, e.jobTitle, e.departmentId
+        FROM employees e
+        WHERE e.createdBy = ? and e.deleted IS NULL and e.offboarded IS NULL`+scope, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var emp candidate
+		if err := rows.Scan(&emp.id, &emp.firstName, &emp.lastName, &emp.jobTitle, &emp.departmentID); err != nil {
+			return nil, err
+		}
+		employees = append(employees, emp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	held := map[pair]holding{}
+	heldRows, err := db.Query(`
+        SELECT el.employeeId, el.licenseId, MAX(el.expDate), MAX(el.expDate) >= CURDATE()
+        FROM employeeLicenses el
+        JOIN employees e on el.employeeId = e.id
+        WHERE e.createdBy = ? and el.deleted IS NULL`+scope+`
+        GROUP BY el.employeeId, el.licenseId`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer heldRows.Close()
+	for heldRows.Next() {
+		var key pair
+		var h holding
+		if err := heldRows.Scan(&key.employeeID, &key.licenseID, &h.expDate, &h.current); err != nil {
+			return nil, err
+		}
+		held[key] = h
+	}
+	if err := heldRows.Err(); err != nil {
+		return nil, err
+	}
+
+	waived := map[pair]bool{}
+	waivedRows, err := db.Query(`
+        SELECT p.employeeId, p.licenseId
+        FROM credentialPlaceholders p
+        JOIN employees e on p.employeeId = e.id
+        WHERE e.createdBy = ? and p.status = 'waived'`+scope, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer waivedRows.Close()
+	for waivedRows.Next() {
+		var key pair
+		if err := waivedRows.Scan(&key.employeeID, &key.licenseID); err != nil {
+			return nil, err
+		}
+		waived[key] = true
+	}
+	if err := waivedRows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Where each held license is valid, latest expiration first.
+	records := map[pair][]jurisdictions.Record{}
+	if m.jurisdictional() {
+		loaded, err := jurisdictions.Records(db, userSub, scope, scopeArgs)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range loaded {
+			key := pair{r.EmployeeID, r.LicenseID}
+			records[key] = append(records[key], r)
+		}
+	}
+	today := time.Now().Format(validation.DateLayout)
+
+	names := map[int]string{}
+	for _, req := range m.requirements {
+		names[req.LicenseID] = req.LicenseName
+	}
+
+	for _, emp := range employees {
+		for needed, requirementIDs := range m.required(emp) {
+			licenseID := needed.licenseID
+			key := pair{emp.id, licenseID}
+			h, ok := held[key]
+			if needed.jurisdiction != "" {
+				h, ok = heldIn(records[key], needed.jurisdiction, today)
+			}
+			if (ok && h.current) || waived[key] {
+				continue
+			}
+
+			gap := Gap{
+				EmployeeID:     emp.id,
+				FirstName:      emp.firstName,
+				LastName:       emp.lastName,
+				JobTitle:       emp.jobTitle,
+				LicenseID:      licenseID,
+				LicenseName:    names[licenseID],
+				Jurisdiction:   needed.jurisdiction,
+				Status:         GapMissing,
+				RequirementIDs: requirementIDs,
+			}
+			if ok {
+				expDate := h.expDate
+				gap.Status = GapExpired
+				gap.ExpDate = &expDate
+			}
+			gaps = append(gaps, gap)
+		}
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		a, b := gaps[i], gaps[j]
+		if a.LastName != b.LastName {
+			return a.LastName < b.LastName
+		}
+		if a.FirstName != b.FirstName {
+			return a.FirstName < b.FirstName
+		}
+		if a.EmployeeID != b.EmployeeID {
+			return a.EmployeeID < b.EmployeeID
+		}
+		if a.LicenseName != b.LicenseName {
+			return a.LicenseName < b.LicenseName
+		}
+		return a.Jurisdiction < b.Jurisdiction
+	})
+
+	return gaps, nil
+}
+
+// heldIn is the holding of the latest of records valid in jurisdiction.
+func heldIn(records []jurisdictions.Record, jurisdiction string, today string) (holding, bool) {
+	for _, r := range records {
+		if r.Covers(jurisdiction) {
+			return holding{expDate: r.ExpDate, current: r.ExpDate >= today}, true
+		}
+	}
+	return holding{}, false
+}
+
+// GetGaps lists every employee missing a required credential. Managers see
+// their reports; locationId and departmentId narrow the list like the
+// employee list, and licenseId and status narrow it to one license type or
+// kind of gap.
+func GetGaps(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	scope, scopeArgs := access.Scope(c, "e.id")
+
+	unitScope, unitArgs, err := orgunits.Scope(db, c, "e.id")
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location or department"})
+		return
+	}
+
+	licenseID := 0
+	if param := c.Query("licenseId"); param != "" {
+		if licenseID, err = strconv.Atoi(param); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid licenseId"})
+			return
+		}
+	}
+
+	status := c.Query("status")
+	if status != "" && status != GapMissing && status != GapExpired {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be missing or expired"})
+		return
+	}
+
+	gaps, err := Find(db, userSubStr, scope+unitScope, append(scopeArgs, unitArgs...))
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute requirement gaps"})
+		return
+	}
+
+	filtered := []Gap{}
+	for _, gap := range gaps {
+		if (licenseID == 0 || gap.LicenseID == licenseID) && (status == "" || gap.Status == status) {
+			filtered = append(filtered, gap)
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, filtered)
+}
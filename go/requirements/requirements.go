@@ -0,0 +1,277 @@
+package requirements
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/orgunits"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Requirement says employees with the given job title, in the given
+// department or below it, carrying the given tag and working in the given
+// jurisdiction must hold a license type. Every criterion that is set has to
+// match. With a jurisdiction, only a license valid there meets it.
+type Requirement struct {
+	ID           int    `json:"id"`
+	LicenseID    int    `json:"licenseId" validate:"required,gt=0"`
+	LicenseName  string `json:"licenseName"`
+	JobTitle     string `json:"jobTitle" validate:"max=100"`
+	DepartmentID *int   `json:"departmentId" validate:"omitempty,gt=0"`
+	Tag          string `json:"tag" validate:"max=50"`
+	Jurisdiction string `json:"jurisdiction" validate:"max=100"`
+
+	tagID *int
+}
+
+func (req *Requirement) Normalize() {
+	req.JobTitle = strings.TrimSpace(req.JobTitle)
+	req.Tag = strings.TrimSpace(req.Tag)
+	req.Jurisdiction = strings.ToUpper(strings.TrimSpace(req.Jurisdiction))
+}
+
+func (req *Requirement) Check() validation.FieldErrors {
+	if req.JobTitle == "" && req.DepartmentID == nil && req.Tag == "" && req.Jurisdiction == "" {
+		return validation.FieldErrors{"jobTitle": "jobTitle, departmentId, tag or jurisdiction is required"}
+	}
+	return nil
+}
+
+// nullable stores an empty job title or jurisdiction as NULL, meaning any.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// queryRequirements loads the tenant's requirements on live license types,
+// or just one when id is set.
+func queryRequirements(db *sql.DB, userSub string, id string) ([]Requirement, error) {
+	query := `
+        SELECT r.id, r.licenseId, l.name, COALESCE(r.jobTitle, ''), r.departmentId, r.tagId, COALESCE(t.name, ''),
+            COALESCE(r.jurisdiction, '')
+        FROM credentialRequirements r
+        JOIN licenses l on r.licenseId = l.id and l.deleted IS NULL
+        LEFT JOIN tags t on r.tagId = t.id
+        WHERE r.createdBy = ? and r.deleted IS NULL`
+	args := []interface{}{userSub}
+	if id != "" {
+		query += " and r.id = ?"
+		args = append(args, id)
+	}
+	query += " ORDER BY l.name, r.id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requirements := []Requirement{}
+	for rows.Next() {
+		var req Requirement
+		if err := rows.Scan(&req.ID, &req.LicenseID, &req.LicenseName, &req.JobTitle, &req.DepartmentID, &req.tagID, &req.Tag, &req.Jurisdiction); err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, req)
+	}
+
+	return requirements, rows.Err()
+}
+
+// checkReferences makes sure the license type, department and tag exist for
+// the tenant and looks up the tag's ID. It writes the 400 itself.
+func checkReferences(db *sql.DB, c *gin.Context, req *Requirement, userSub string) bool {
+	fields := validation.FieldErrors{}
+
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM licenses
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, req.LicenseID, userSub).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate requirement"})
+		return false
+	}
+	if count == 0 {
+		fields["licenseId"] = "does not exist"
+	}
+
+	if req.DepartmentID != nil {
+		exists, err := orgunits.Exists(db, orgunits.Department, *req.DepartmentID, userSub)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate requirement"})
+			return false
+		}
+		if !exists {
+			fields["departmentId"] = "does not exist"
+		}
+	}
+
+	req.tagID = nil
+	if req.Tag != "" {
+		var tagID int
+		err := db.QueryRow(`SELECT id FROM tags WHERE name = ? and createdBy = ?`, req.Tag, userSub).Scan(&tagID)
+		switch {
+		case err == sql.ErrNoRows:
+			fields["tag"] = "does not exist"
+		case err != nil:
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate requirement"})
+			return false
+		default:
+			req.tagID = &tagID
+		}
+	}
+
+	if len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return false
+	}
+	return true
+}
+
+func Get(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	requirements, err := queryRequirements(db, userSubStr, "")
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query requirements"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, requirements)
+}
+
+func Post(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var req Requirement
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	if !checkReferences(db, c, &req, userSubStr) {
+		return
+	}
+
+	result, err := db.Exec(`
+        INSERT INTO credentialRequirements (licenseId, jobTitle, departmentId, tagId, jurisdiction, createdBy)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, req.LicenseID, nullable(req.JobTitle), req.DepartmentID, req.tagID, nullable(req.Jurisdiction), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert requirement"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted requirement ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Requirement inserted successfully", "id": id})
+}
+
+func Put(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+
+	var req Requirement
+	if !validation.Bind(c, &req) {
+		return
+	}
+
+	if !checkReferences(db, c, &req, userSubStr) {
+		return
+	}
+
+	_, err = db.Exec(`
+        UPDATE credentialRequirements
+        SET licenseId = ?, jobTitle = ?, departmentId = ?, tagId = ?, jurisdiction = ?
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, req.LicenseID, nullable(req.JobTitle), req.DepartmentID, req.tagID, nullable(req.Jurisdiction), id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update requirement"})
+		return
+	}
+
+	updated, err := queryRequirements(db, userSubStr, c.Param("id"))
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve requirement"})
+		return
+	}
+	if len(updated) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "requirement not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated[0])
+}
+
+func Delete(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE credentialRequirements
+        SET deleted = current_timestamp()
+        WHERE id = ? and deleted IS NULL and createdBy = ?
+    `, c.Param("id"), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete requirement"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "requirement not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Requirement deleted successfully"})
+}
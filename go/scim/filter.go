@@ -0,0 +1,164 @@
+package scim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// userNameColumn is what a user's userName resolves to. Employees that were
+// not provisioned through SCIM fall back to their email, then their ID.
+const userNameColumn = "COALESCE(s.userName, NULLIF(e.email, ''), CAST(e.id AS CHAR))"
+
+// filterColumns maps the filterable User attributes, lower-cased, to SQL on
+// employees e joined to scimUsers s.
+var filterColumns = map[string]string{
+	"id":              "CAST(e.id AS CHAR)",
+	"username":        userNameColumn,
+	"externalid":      "s.externalId",
+	"name.givenname":  "e.firstName",
+	"name.familyname": "e.lastName",
+	"emails":          "e.email",
+	"emails.value":    "e.email",
+	"phonenumbers":    "e.phone1",
+	"title":           "e.jobTitle",
+	"active":          "active",
+}
+
+// compileFilter turns a SCIM filter into a SQL condition. It supports the
+// attribute operators eq, ne, co, sw, ew and pr joined with and/or, which
+// covers what identity providers send in practice. Grouping and not are
+// rejected.
+func compileFilter(filter string) (string, []interface{}, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sql strings.Builder
+	var args []interface{}
+
+	for i := 0; i < len(tokens); {
+		if i > 0 {
+			joiner := strings.ToLower(tokens[i].text)
+			if tokens[i].quoted || (joiner != "and" && joiner != "or") {
+				return "", nil, fmt.Errorf("expected and/or, got %q", tokens[i].text)
+			}
+			sql.WriteString(" " + strings.ToUpper(joiner) + " ")
+			i++
+		}
+
+		if i+1 >= len(tokens) {
+			return "", nil, fmt.Errorf("incomplete filter expression")
+		}
+
+		attr := strings.ToLower(tokens[i].text)
+		column, ok := filterColumns[attr]
+		if !ok || tokens[i].quoted {
+			return "", nil, fmt.Errorf("unsupported filter attribute %q", tokens[i].text)
+		}
+		op := strings.ToLower(tokens[i+1].text)
+		i += 2
+
+		if op == "pr" {
+			if column == "active" {
+				sql.WriteString("1 = 1")
+			} else {
+				fmt.Fprintf(&sql, "(%s IS NOT NULL and %s <> '')", column, column)
+			}
+			continue
+		}
+
+		if i >= len(tokens) {
+			return "", nil, fmt.Errorf("operator %q needs a value", op)
+		}
+		value := tokens[i]
+		i++
+
+		if column == "active" {
+			if op != "eq" && op != "ne" {
+				return "", nil, fmt.Errorf("active only supports eq and ne")
+			}
+			active := strings.EqualFold(value.text, "true")
+			if !active && !strings.EqualFold(value.text, "false") {
+				return "", nil, fmt.Errorf("active must be compared to true or false")
+			}
+			if op == "ne" {
+				active = !active
+			}
+			// Matches the active attribute users are returned with.
+			if active {
+				sql.WriteString("(e.deleted IS NULL and e.offboarded IS NULL)")
+			} else {
+				sql.WriteString("(e.deleted IS NOT NULL or e.offboarded IS NOT NULL)")
+			}
+			continue
+		}
+
+		switch op {
+		case "eq":
+			fmt.Fprintf(&sql, "%s = ?", column)
+			args = append(args, value.text)
+		case "ne":
+			fmt.Fprintf(&sql, "(%s IS NULL or %s <> ?)", column, column)
+			args = append(args, value.text)
+		case "co":
+			fmt.Fprintf(&sql, "%s LIKE ?", column)
+			args = append(args, "%"+escapeLike(value.text)+"%")
+		case "sw":
+			fmt.Fprintf(&sql, "%s LIKE ?", column)
+			args = append(args, escapeLike(value.text)+"%")
+		case "ew":
+			fmt.Fprintf(&sql, "%s LIKE ?", column)
+			args = append(args, "%"+escapeLike(value.text))
+		default:
+			return "", nil, fmt.Errorf("unsupported filter operator %q", op)
+		}
+	}
+
+	if sql.Len() == 0 {
+		return "", nil, fmt.Errorf("empty filter")
+	}
+	return "(" + sql.String() + ")", args, nil
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(filter string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(filter); {
+		switch ch := filter[i]; {
+		case ch == ' ':
+			i++
+		case ch == '(' || ch == ')' || ch == '[' || ch == ']':
+			return nil, fmt.Errorf("grouping in filters is not supported")
+		case ch == '"':
+			var text strings.Builder
+			i++
+			for ; i < len(filter) && filter[i] != '"'; i++ {
+				if filter[i] == '\\' && i+1 < len(filter) {
+					i++
+				}
+				text.WriteByte(filter[i])
+			}
+			if i >= len(filter) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			i++
+			tokens = append(tokens, token{text: text.String(), quoted: true})
+		default:
+			start := i
+			for i < len(filter) && !strings.ContainsRune(" ()[]\"", rune(filter[i])) {
+				i++
+			}
+			tokens = append(tokens, token{text: filter[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
@@ -0,0 +1,166 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type PatchRequest struct {
+	Schemas    []string  `json:"schemas"`
+	Operations []PatchOp `json:"Operations"`
+}
+
+// PatchOp is one operation of a SCIM PATCH. Value is left raw because its
+// shape depends on the path.
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (op PatchOp) apply(user *User) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return fmt.Errorf("unsupported patch op %q", op.Op)
+	}
+
+	// Without a path the value is a partial User, e.g. {"active": false}.
+	if op.Path == "" {
+		if kind == "remove" {
+			return fmt.Errorf("remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return fmt.Errorf("value must be an object when path is omitted")
+		}
+		for path, value := range values {
+			if err := setPath(user, path, value, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return setPath(user, op.Path, op.Value, kind == "remove")
+}
+
+// setPath sets or, when remove is true, clears the attribute at path.
+// Value filters on emails and phoneNumbers, such as emails[type eq
+// "work"].value, address the single value an employee has.
+func setPath(user *User, path string, value json.RawMessage, remove bool) error {
+	attr := strings.ToLower(path)
+	if i := strings.Index(attr, "["); i >= 0 {
+		attr = attr[:i]
+	}
+	attr = strings.TrimSuffix(attr, ".value")
+
+	switch attr {
+	case "active":
+		if remove {
+			return fmt.Errorf("active cannot be removed")
+		}
+		active, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		user.Active = &active
+
+	case "username":
+		if remove {
+			return fmt.Errorf("userName cannot be removed")
+		}
+		return setString(&user.UserName, value, false)
+
+	case "externalid":
+		return setString(&user.ExternalID, value, remove)
+
+	case "name":
+		if remove {
+			user.Name = Name{}
+			return nil
+		}
+		var name Name
+		if err := json.Unmarshal(value, &name); err != nil {
+			return fmt.Errorf("name must be an object")
+		}
+		if name.GivenName != "" {
+			user.Name.GivenName = name.GivenName
+		}
+		if name.FamilyName != "" {
+			user.Name.FamilyName = name.FamilyName
+		}
+
+	case "name.givenname":
+		return setString(&user.Name.GivenName, value, remove)
+
+	case "name.familyname":
+		return setString(&user.Name.FamilyName, value, remove)
+
+	case "title":
+		return setString(&user.Title, value, remove)
+
+	case "emails":
+		return setMulti(&user.Emails, value, remove)
+
+	case "phonenumbers":
+		return setMulti(&user.PhoneNumbers, value, remove)
+
+	default:
+		return fmt.Errorf("unsupported patch path %q", path)
+	}
+
+	return nil
+}
+
+func setString(target *string, value json.RawMessage, remove bool) error {
+	if remove {
+		*target = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return fmt.Errorf("value must be a string")
+	}
+	*target = s
+	return nil
+}
+
+// setMulti accepts either a list of values or a bare string, which is what
+// providers send when the path points at .value.
+func setMulti(target *[]MultiValue, value json.RawMessage, remove bool) error {
+	if remove {
+		*target = nil
+		return nil
+	}
+
+	var values []MultiValue
+	if err := json.Unmarshal(value, &values); err == nil {
+		*target = values
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return fmt.Errorf("value must be a string or a list of values")
+	}
+	*target = []MultiValue{{Value: s, Type: "work", Primary: true}}
+	return nil
+}
+
+// parseBool accepts JSON booleans and the "True"/"False" strings some
+// identity providers send instead.
+func parseBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("active must be true or false")
+}
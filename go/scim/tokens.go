@@ -0,0 +1,195 @@
+package scim
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// tokenPrefix marks SCIM bearer tokens so they are easy to spot in an
+// identity provider's config or a leaked log.
+const tokenPrefix = "scim_"
+
+// Token is a bearer credential an identity provider uses to provision one
+// tenant. Only a hash is stored; the secret is returned once on creation.
+type Token struct {
+	ID       int     `json:"id"`
+	Name     string  `json:"name" validate:"required,max=100"`
+	Created  string  `json:"created"`
+	LastUsed *string `json:"lastUsed"`
+}
+
+func (token *Token) Normalize() {
+	token.Name = strings.TrimSpace(token.Name)
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Auth authenticates SCIM requests by bearer token and sets userSub to the
+// tenant the token was issued for, so the rest of the app sees a normal
+// tenant request.
+func Auth(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || !strings.HasPrefix(secret, tokenPrefix) {
+			writeError(c, http.StatusUnauthorized, "", "Bearer token is missing")
+			c.Abort()
+			return
+		}
+
+		hash := hashToken(secret)
+
+		var userSub string
+		err := db.QueryRow(`
+            SELECT createdBy FROM scimTokens
+            WHERE tokenHash = ? and revoked IS NULL
+        `, hash).Scan(&userSub)
+		if err == sql.ErrNoRows {
+			writeError(c, http.StatusUnauthorized, "", "Invalid token")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			fmt.Println("Error: ", err)
+			writeError(c, http.StatusInternalServerError, "", "Failed to check token")
+			c.Abort()
+			return
+		}
+
+		if _, err := db.Exec(`UPDATE scimTokens SET lastUsed = current_timestamp() WHERE tokenHash = ?`, hash); err != nil {
+			fmt.Println("Error: ", err)
+		}
+
+		c.Set("userSub", userSub)
+		c.Next()
+	}
+}
+
+func GetTokens(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, name, created, lastUsed
+        FROM scimTokens
+        WHERE revoked IS NULL and createdBy = ?
+        ORDER BY created DESC
+    `, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query SCIM tokens"})
+		return
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		var token Token
+		if err := rows.Scan(&token.ID, &token.Name, &token.Created, &token.LastUsed); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan SCIM token data"})
+			return
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, tokens)
+}
+
+// PostToken issues a new token. The response is the only place the secret
+// appears.
+func PostToken(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	var token Token
+	if !validation.Bind(c, &token) {
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate SCIM token"})
+		return
+	}
+	secret := tokenPrefix + hex.EncodeToString(raw)
+
+	result, err := db.Exec(`
+        INSERT INTO scimTokens (name, tokenHash, createdBy)
+        VALUES (?, ?, ?)
+    `, token.Name, hashToken(secret), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert SCIM token"})
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inserted SCIM token ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SCIM token created successfully", "id": id, "token": secret})
+}
+
+func DeleteToken(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	result, err := db.Exec(`
+        UPDATE scimTokens
+        SET revoked = current_timestamp()
+        WHERE id = ? and revoked IS NULL and createdBy = ?
+    `, c.Param("id"), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke SCIM token"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SCIM token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SCIM token revoked successfully"})
+}
@@ -0,0 +1,613 @@
+package scim
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/employees"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/benfortenberry/accredi-track/validation"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	userSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	listSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	errorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	patchSchema  = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	configSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	contentType  = "application/scim+json"
+)
+
+const (
+	defaultCount = 100
+	maxCount     = 200
+)
+
+type Name struct {
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue is an entry of a multi-valued attribute such as emails.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// User is the SCIM core User resource as it maps onto an employee. Active
+// false means the employee is in the trash.
+type User struct {
+	Schemas      []string     `json:"schemas"`
+	ID           string       `json:"id,omitempty"`
+	ExternalID   string       `json:"externalId,omitempty"`
+	UserName     string       `json:"userName"`
+	Name         Name         `json:"name"`
+	Emails       []MultiValue `json:"emails,omitempty"`
+	PhoneNumbers []MultiValue `json:"phoneNumbers,omitempty"`
+	Title        string       `json:"title,omitempty"`
+	Active       *bool        `json:"active,omitempty"`
+	Meta         *Meta        `json:"meta,omitempty"`
+}
+
+// stored is a user as loaded, along with the employee columns SCIM doesn't
+// own and must leave alone on replace.
+type stored struct {
+	user       User
+	employee   employees.Employee
+	mapped     bool
+	offboarded bool
+}
+
+// fieldNames translates employee validation errors back to SCIM attributes.
+var fieldNames = map[string]string{
+	"firstName": "name.givenName",
+	"lastName":  "name.familyName",
+	"email":     "emails",
+	"phone1":    "phoneNumbers",
+	"jobTitle":  "title",
+}
+
+func writeError(c *gin.Context, status int, scimType string, detail string) {
+	body := gin.H{"schemas": []string{errorSchema}, "status": strconv.Itoa(status), "detail": detail}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	c.Header("Content-Type", contentType)
+	c.JSON(status, body)
+}
+
+func write(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", contentType)
+	c.JSON(status, body)
+}
+
+func location(c *gin.Context, id string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + "/scim/v2/Users/" + id
+}
+
+func primary(values []MultiValue) string {
+	for _, v := range values {
+		if v.Primary {
+			return strings.TrimSpace(v.Value)
+		}
+	}
+	if len(values) > 0 {
+		return strings.TrimSpace(values[0].Value)
+	}
+	return ""
+}
+
+// toEmployee applies a user onto the employee it replaces and validates the
+// result the same way the employee endpoints do.
+func toEmployee(user User, current employees.Employee) (employees.Employee, string) {
+	emp := current
+	emp.FirstName = user.Name.GivenName
+	emp.LastName = user.Name.FamilyName
+	emp.Email = primary(user.Emails)
+	emp.Phone1 = primary(user.PhoneNumbers)
+	emp.JobTitle = user.Title
+
+	fields := validation.Validate(&emp)
+	if len(fields) == 0 {
+		return emp, ""
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		name := key
+		if scimName, ok := fieldNames[key]; ok {
+			name = scimName
+		}
+		problems = append(problems, name+" "+fields[key])
+	}
+	return emp, strings.Join(problems, "; ")
+}
+
+func queryUsers(db *sql.DB, c *gin.Context, userSub string, where string, args []interface{}, limit int, offset int) ([]stored, error) {
+	query := `
+        SELECT e.id, e.firstName, e.lastName, e.phone1, e.email, e.jobTitle,
+            e.locationId, e.departmentId, e.supervisorId, e.birthDate, e.deleted IS NULL and e.offboarded IS NULL,
+            ` + userNameColumn + `, COALESCE(s.externalId, ''), s.employeeId IS NOT NULL,
+            e.offboarded IS NOT NULL
+        FROM employees e
+        LEFT JOIN scimUsers s on s.employeeId = e.id
+        WHERE e.createdBy = ? and (e.deleted IS NULL or s.employeeId IS NOT NULL)` + where + `
+        ORDER BY e.id
+        LIMIT ? OFFSET ?`
+
+	rows, err := db.Query(query, append(append([]interface{}{userSub}, args...), limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []stored{}
+	for rows.Next() {
+		var s stored
+		var active bool
+		emp := &s.employee
+		if err := rows.Scan(
+			&emp.ID, &emp.FirstName, &emp.LastName, &emp.Phone1, &emp.Email, &emp.JobTitle,
+			&emp.LocationID, &emp.DepartmentID, &emp.SupervisorID, &emp.BirthDate, &active,
+			&s.user.UserName, &s.user.ExternalID, &s.mapped, &s.offboarded,
+		); err != nil {
+			return nil, err
+		}
+
+		id := strconv.Itoa(emp.ID)
+		s.user.Schemas = []string{userSchema}
+		s.user.ID = id
+		s.user.Name = Name{GivenName: emp.FirstName, FamilyName: emp.LastName}
+		if emp.Email != "" {
+			s.user.Emails = []MultiValue{{Value: emp.Email, Type: "work", Primary: true}}
+		}
+		if emp.Phone1 != "" {
+			s.user.PhoneNumbers = []MultiValue{{Value: emp.Phone1, Type: "work", Primary: true}}
+		}
+		s.user.Title = emp.JobTitle
+		s.user.Active = &active
+		s.user.Meta = &Meta{ResourceType: "User", Location: location(c, id)}
+		users = append(users, s)
+	}
+
+	return users, rows.Err()
+}
+
+func loadUser(db *sql.DB, c *gin.Context, userSub string, id string) (stored, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return stored{}, sql.ErrNoRows
+	}
+	users, err := queryUsers(db, c, userSub, " and e.id = ?", []interface{}{id}, 1, 0)
+	if err != nil {
+		return stored{}, err
+	}
+	if len(users) == 0 {
+		return stored{}, sql.ErrNoRows
+	}
+	return users[0], nil
+}
+
+// userNameTaken reports whether another employee already answers to
+// userName.
+func userNameTaken(db *sql.DB, userSub string, userName string, exceptID int) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+        SELECT COUNT(*) FROM scimUsers
+        WHERE createdBy = ? and userName = ? and employeeId <> ?
+    `, userSub, userName, exceptID).Scan(&count)
+	return count > 0, err
+}
+
+// save writes user over current in one transaction. Deactivating a user
+// offboards the employee; a user still in the trash from before offboarding
+// existed is restored when reactivated. A user that is and stays inactive
+// only has its SCIM identifiers updated, since those employees are frozen.
+func save(db *sql.DB, userSub string, current stored, user User, emp employees.Employee, isNew bool) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id := int64(current.employee.ID)
+	wasActive := isNew || *current.user.Active
+	active := user.Active == nil || *user.Active
+
+	if isNew && current.employee.ID == 0 {
+		if id, err = employees.Insert(tx, emp, userSub); err != nil {
+			return 0, err
+		}
+	} else {
+		if !wasActive && active {
+			if _, _, err := employees.Restore(tx, id, userSub); err != nil {
+				return 0, err
+			}
+		}
+		if active || wasActive {
+			if err := employees.Update(tx, id, emp, userSub); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if wasActive && !active {
+		sep := employees.Separation{
+			SeparationDate: time.Now().Format(validation.DateLayout),
+			Reason:         "Deactivated by SCIM provisioning",
+		}
+		if _, err := employees.Offboard(tx, id, sep, userSub); err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO scimUsers (employeeId, userName, externalId, createdBy)
+        VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE userName = VALUES(userName), externalId = VALUES(externalId)
+    `, id, user.UserName, user.ExternalID, userSub)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// ListUsers answers GET /Users with filter, startIndex and count.
+func ListUsers(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return
+	}
+
+	var where string
+	var args []interface{}
+	if filter := c.Query("filter"); filter != "" {
+		condition, conditionArgs, err := compileFilter(filter)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		where, args = " and "+condition, conditionArgs
+	}
+
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(defaultCount)))
+	if err != nil || count < 0 {
+		count = defaultCount
+	}
+	if count > maxCount {
+		count = maxCount
+	}
+
+	var total int
+	err = db.QueryRow(`
+        SELECT COUNT(*)
+        FROM employees e
+        LEFT JOIN scimUsers s on s.employeeId = e.id
+        WHERE e.createdBy = ? and (e.deleted IS NULL or s.employeeId IS NOT NULL)`+where,
+		append([]interface{}{userSubStr}, args...)...).Scan(&total)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to count users")
+		return
+	}
+
+	users, err := queryUsers(db, c, userSubStr, where, args, count, startIndex-1)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to query users")
+		return
+	}
+
+	resources := make([]User, len(users))
+	for i, s := range users {
+		resources[i] = s.user
+	}
+
+	write(c, http.StatusOK, gin.H{
+		"schemas":      []string{listSchema},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
+
+func GetUser(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return
+	}
+
+	s, err := loadUser(db, c, userSubStr, c.Param("id"))
+	if err == sql.ErrNoRows {
+		writeError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to retrieve user")
+		return
+	}
+
+	write(c, http.StatusOK, s.user)
+}
+
+// PostUser provisions a user. An active employee that was added by hand
+// with the same email is adopted rather than duplicated.
+func PostUser(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return
+	}
+
+	var user User
+	if err := c.ShouldBindJSON(&user); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+	user.UserName = strings.TrimSpace(user.UserName)
+	if user.UserName == "" {
+		writeError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	taken, err := userNameTaken(db, userSubStr, user.UserName, 0)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to check userName")
+		return
+	}
+	if taken {
+		writeError(c, http.StatusConflict, "uniqueness", "userName is already in use")
+		return
+	}
+
+	var current stored
+	emp, problem := toEmployee(user, current.employee)
+	if problem != "" {
+		writeError(c, http.StatusBadRequest, "invalidValue", problem)
+		return
+	}
+
+	if emp.Email != "" {
+		matches, err := queryUsers(db, c, userSubStr,
+			" and e.email = ? and e.deleted IS NULL and e.offboarded IS NULL and s.employeeId IS NULL", []interface{}{emp.Email}, 1, 0)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			writeError(c, http.StatusInternalServerError, "", "Failed to look up existing employee")
+			return
+		}
+		if len(matches) > 0 {
+			current = matches[0]
+			emp, _ = toEmployee(user, current.employee)
+		}
+	}
+
+	id, err := save(db, userSubStr, current, user, emp, true)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to create user")
+		return
+	}
+
+	created, err := loadUser(db, c, userSubStr, strconv.FormatInt(id, 10))
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to retrieve user")
+		return
+	}
+
+	c.Header("Location", created.user.Meta.Location)
+	write(c, http.StatusCreated, created.user)
+}
+
+func PutUser(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return
+	}
+
+	var user User
+	if err := c.ShouldBindJSON(&user); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	replace(db, c, userSubStr, func(current User) (User, error) {
+		return user, nil
+	})
+}
+
+// PatchUser applies a SCIM PatchOp to the current user and saves the result
+// as a replace.
+func PatchUser(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return
+	}
+
+	var req PatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	replace(db, c, userSubStr, func(current User) (User, error) {
+		for _, op := range req.Operations {
+			if err := op.apply(&current); err != nil {
+				return current, err
+			}
+		}
+		return current, nil
+	})
+}
+
+// replace loads the user named in the path, lets build produce its new
+// state and saves it.
+func replace(db *sql.DB, c *gin.Context, userSub string, build func(current User) (User, error)) {
+	current, err := loadUser(db, c, userSub, c.Param("id"))
+	if err == sql.ErrNoRows {
+		writeError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to retrieve user")
+		return
+	}
+
+	user, err := build(current.user)
+	if err != nil {
+		writeError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	user.UserName = strings.TrimSpace(user.UserName)
+	if user.UserName == "" {
+		writeError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	taken, err := userNameTaken(db, userSub, user.UserName, current.employee.ID)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to check userName")
+		return
+	}
+	if taken {
+		writeError(c, http.StatusConflict, "uniqueness", "userName is already in use")
+		return
+	}
+
+	if current.offboarded && (user.Active == nil || *user.Active) {
+		writeError(c, http.StatusConflict, "mutability", "User has been offboarded and can't be reactivated")
+		return
+	}
+
+	emp, problem := toEmployee(user, current.employee)
+	if problem != "" {
+		writeError(c, http.StatusBadRequest, "invalidValue", problem)
+		return
+	}
+
+	if _, err := save(db, userSub, current, user, emp, false); err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to update user")
+		return
+	}
+
+	updated, err := loadUser(db, c, userSub, c.Param("id"))
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to retrieve user")
+		return
+	}
+
+	write(c, http.StatusOK, updated.user)
+}
+
+// DeleteUser moves the employee to the trash and drops the SCIM mapping, so
+// the user stops existing as far as the identity provider is concerned
+// while HR can still restore the employee.
+func DeleteUser(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		return
+	}
+
+	current, err := loadUser(db, c, userSubStr, c.Param("id"))
+	if err == sql.ErrNoRows {
+		writeError(c, http.StatusNotFound, "", "User not found")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to retrieve user")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to delete user")
+		return
+	}
+	defer tx.Rollback()
+
+	id := int64(current.employee.ID)
+	if *current.user.Active {
+		if _, err := employees.SoftDelete(tx, id, userSubStr); err != nil {
+			fmt.Println("Error: ", err)
+			writeError(c, http.StatusInternalServerError, "", "Failed to delete user")
+			return
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM scimUsers WHERE employeeId = ? and createdBy = ?`, id, userSubStr); err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to delete user")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		writeError(c, http.StatusInternalServerError, "", "Failed to delete user")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetServiceProviderConfig tells identity providers which optional SCIM
+// features are available.
+func GetServiceProviderConfig(c *gin.Context) {
+	write(c, http.StatusOK, gin.H{
+		"schemas":        []string{configSchema},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": maxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Token issued from POST /scim/tokens",
+		}},
+	})
+}
@@ -0,0 +1,186 @@
+package timeline
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/benfortenberry/accredi-track/access"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLimit caps how many entries Get returns without ?limit.
+const defaultLimit = 50
+
+// Kinds of activity recorded against an employee. Get adds license.expired,
+// document.uploaded, employee.merged and notification.<kind> entries from
+// the tables that already hold them.
+const (
+	EmployeeCreated    = "employee.created"
+	EmployeeUpdated    = "employee.updated"
+	EmployeeOffboarded = "employee.offboarded"
+	LicenseAdded       = "license.added"
+	LicenseUpdated     = "license.updated"
+	LicenseRenewed     = "license.renewed"
+	LicenseRemoved     = "license.removed"
+)
+
+type Entry struct {
+	At                string      `json:"at"`
+	Kind              string      `json:"kind"`
+	EmployeeID        int         `json:"employeeId"`
+	EmployeeLicenseID *int        `json:"employeeLicenseId"`
+	LicenseName       *string     `json:"licenseName"`
+	Detail            interface{} `json:"detail"`
+}
+
+// Record stores an entry for the tenant. At and LicenseName are filled in
+// when the timeline is read.
+func Record(db utils.DB, userSub string, e Entry) error {
+	detail, err := json.Marshal(e.Detail)
+	if err != nil {
+		return err
+	}
+	if e.Detail == nil {
+		detail = []byte("{}")
+	}
+
+	_, err = db.Exec(`
+        INSERT INTO employeeActivity (employeeId, employeeLicenseId, kind, detail, createdBy)
+        VALUES (?, ?, ?, ?, ?)
+    `, e.EmployeeID, e.EmployeeLicenseID, e.Kind, detail, userSub)
+	return err
+}
+
+// Get returns an employee's timeline newest first, paged with ?limit and
+// ?offset.
+func Get(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	allowed, err := access.Allows(db, c, id)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM employees WHERE id = ? and deleted IS NULL and createdBy = ?`, id, userSubStr).Scan(&count)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit <= 0 || limit > defaultLimit {
+		limit = defaultLimit
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// One row past the page tells us whether there is another page.
+	query := `
+    SELECT t.at, t.kind, t.employeeLicenseId, l.name, t.detail
+    FROM (
+        SELECT a.created as at, a.kind, a.employeeLicenseId, a.detail, a.id as seq
+        FROM employeeActivity a
+        WHERE a.employeeId = ? and a.createdBy = ?
+
+        UNION ALL
+
+        SELECT CAST(el.expDate AS DATETIME), 'license.expired', el.id,
+            JSON_OBJECT('expDate', el.expDate), 0
+        FROM employeeLicenses el
+        WHERE el.employeeId = ? and el.deleted IS NULL and el.expDate < CURDATE()
+            and el.createdBy = ?
+
+        UNION ALL
+
+        SELECT n.created, CONCAT('notification.', n.kind), n.employeeLicenseId,
+            JSON_OBJECT('recipient', n.recipient, 'message', n.message), n.id
+        FROM notifications n
+        WHERE n.employeeId = ? and n.userSub = ?
+
+        UNION ALL
+
+        SELECT d.created, 'document.uploaded', d.employeeLicenseId,
+            JSON_OBJECT('documentId', d.id, 'fileName', d.fileName, 'status', d.status), d.id
+        FROM documents d
+        WHERE d.employeeId = ? and d.deleted IS NULL and d.createdBy = ?
+
+        UNION ALL
+
+        SELECT m.created, 'employee.merged', NULL,
+            JSON_OBJECT('duplicateId', m.duplicateId, 'licensesMoved', m.licensesMoved), m.id
+        FROM employeeMerges m
+        WHERE m.survivorId = ? and m.createdBy = ?
+    ) t
+    LEFT JOIN employeeLicenses el on t.employeeLicenseId = el.id
+    LEFT JOIN licenses l on el.licenseId = l.id
+    ORDER BY t.at DESC, t.seq DESC
+    LIMIT ? OFFSET ?`
+
+	rows, err := db.Query(query,
+		id, userSubStr, id, userSubStr, id, userSubStr, id, userSubStr, id, userSubStr,
+		limit+1, offset,
+	)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query timeline"})
+		return
+	}
+	defer rows.Close()
+
+	employeeID, _ := strconv.Atoi(id)
+	entries := []Entry{}
+	for rows.Next() {
+		e := Entry{EmployeeID: employeeID}
+		var detail string
+		if err := rows.Scan(&e.At, &e.Kind, &e.EmployeeLicenseID, &e.LicenseName, &detail); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan timeline data"})
+			return
+		}
+		e.Detail = json.RawMessage(detail)
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"limit":   limit,
+		"offset":  offset,
+		"hasMore": hasMore,
+	})
+}
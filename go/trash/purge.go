@@ -0,0 +1,212 @@
+package trash
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/benfortenberry/accredi-track/portal"
+)
+
+// purgeInterval is how often the retention job looks for expired trash.
+const purgeInterval = 24 * time.Hour
+
+// purgeableEmployees selects employees past retention with no employee
+// licenses left once expired ones are gone.
+const purgeableEmployees = `SELECT e.id FROM employees e
+        WHERE e.deleted < DATE_SUB(NOW(), INTERVAL ? DAY)
+          and NOT EXISTS (SELECT 1 FROM employeeLicenses el WHERE el.employeeId = e.id)`
+
+// purgeableLicenses is purgeableEmployees for license types.
+const purgeableLicenses = `SELECT l.id FROM licenses l
+        WHERE l.deleted < DATE_SUB(NOW(), INTERVAL ? DAY)
+          and NOT EXISTS (SELECT 1 FROM employeeLicenses el WHERE el.licenseId = l.id)`
+
+// Purge hard-deletes every record that has been in the trash for longer than
+// retentionDays. Employee licenses go first, and only on their own deleted
+// date; an employee or license type is kept while any of its employee
+// licenses, in the trash or not, still is. Documents and portal submissions
+// go with the rows they belong to, as do the requirements, templates and
+// merge history naming a purged license type. Stored files are removed once
+// the purge has committed.
+func Purge(db *sql.DB, retentionDays int) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	expiredLicenses := `SELECT id FROM employeeLicenses WHERE deleted < DATE_SUB(NOW(), INTERVAL ? DAY)`
+
+	files, err := purgeDocuments(tx, `
+        deleted < DATE_SUB(NOW(), INTERVAL ? DAY)
+           OR employeeLicenseId IN (`+expiredLicenses+`)
+           OR pendingChangeId IN (SELECT id FROM pendingChanges WHERE employeeLicenseId IN (`+expiredLicenses+`))`,
+		retentionDays, retentionDays, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM pendingChanges WHERE employeeLicenseId IN (`+expiredLicenses+`)`, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	// History and notes outlive the employee licenses they mention.
+	for _, table := range []string{"notes", "employeeActivity", "notifications", "credentialPlaceholders"} {
+		_, err = tx.Exec(`
+        UPDATE `+table+`
+        SET employeeLicenseId = NULL
+        WHERE employeeLicenseId IN (`+expiredLicenses+`)
+    `, retentionDays)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM employeeLicenses WHERE deleted < DATE_SUB(NOW(), INTERVAL ? DAY)`, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM ceActivities WHERE deleted < DATE_SUB(NOW(), INTERVAL ? DAY)`, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	employeeFiles, err := purgeDocuments(tx, `employeeId IN (`+purgeableEmployees+`)`, retentionDays)
+	if err != nil {
+		return err
+	}
+	files = append(files, employeeFiles...)
+
+	for _, table := range []string{"noteRevisions", "noteMentions"} {
+		_, err = tx.Exec(`
+        DELETE FROM `+table+`
+        WHERE noteId IN (SELECT n.id FROM notes n WHERE n.employeeId IN (`+purgeableEmployees+`))
+    `, retentionDays)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Rows keyed only by employee ID have nothing else pointing at them once
+	// the employee is gone.
+	for _, table := range []string{"employeeCustomFieldValues", "employeeTags", "employeeJurisdictions", "employeeExternalIds", "scimUsers", "credentialPlaceholders", "employeeActivity", "notes", "ceActivities", "pendingChanges"} {
+		_, err = tx.Exec(`
+        DELETE FROM `+table+`
+        WHERE employeeId IN (`+purgeableEmployees+`)
+    `, retentionDays)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM employees
+        WHERE deleted < DATE_SUB(NOW(), INTERVAL ? DAY)
+          and NOT EXISTS (SELECT 1 FROM employeeLicenses el WHERE el.employeeId = employees.id)
+    `, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"credentialRequirements", "onboardingTemplateItems", "credentialPlaceholders"} {
+		_, err = tx.Exec(`
+        DELETE FROM `+table+`
+        WHERE licenseId IN (`+purgeableLicenses+`)
+    `, retentionDays)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM licenseMerges
+        WHERE survivorId IN (`+purgeableLicenses+`)
+           OR duplicateId IN (`+purgeableLicenses+`)
+    `, retentionDays, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM licensePrerequisites
+        WHERE licenseId IN (`+purgeableLicenses+`)
+           OR prerequisiteId IN (`+purgeableLicenses+`)
+    `, retentionDays, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	// Versions that employee licenses are still pinned to, such as those of
+	// a merged duplicate, are kept.
+	_, err = tx.Exec(`
+        DELETE FROM licenseVersions
+        WHERE licenseId IN (`+purgeableLicenses+`)
+          and id NOT IN (SELECT licenseVersionId FROM employeeLicenses WHERE licenseVersionId IS NOT NULL)
+    `, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+        DELETE FROM licenses
+        WHERE deleted < DATE_SUB(NOW(), INTERVAL ? DAY)
+          and NOT EXISTS (SELECT 1 FROM employeeLicenses el WHERE el.licenseId = licenses.id)
+    `, retentionDays)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		portal.RemoveDocument(file)
+	}
+	return nil
+}
+
+// purgeDocuments hard-deletes the documents matching condition and returns
+// where their files are stored.
+func purgeDocuments(tx *sql.Tx, condition string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(`SELECT storagePath FROM documents WHERE `+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM documents WHERE `+condition, args...)
+	return files, err
+}
+
+// StartPurgeJob runs Purge once a day in the background using the configured
+// retention window.
+func StartPurgeJob(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := Purge(db, RetentionDays()); err != nil {
+				log.Printf("Failed to purge trash: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,357 @@
+package trash
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/benfortenberry/accredi-track/employees"
+	"github.com/benfortenberry/accredi-track/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRetentionDays is how long soft-deleted records stay restorable when
+// TRASH_RETENTION_DAYS is not set.
+const defaultRetentionDays = 30
+
+type DeletedEmployee struct {
+	ID           int    `json:"id"`
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	Email        string `json:"email"`
+	LicenseCount int    `json:"licenseCount"`
+	Deleted      string `json:"deleted"`
+	PurgeAfter   string `json:"purgeAfter"`
+}
+
+type DeletedLicense struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Deleted    string `json:"deleted"`
+	PurgeAfter string `json:"purgeAfter"`
+}
+
+type DeletedEmployeeLicense struct {
+	ID              int    `json:"id"`
+	EmployeeID      int    `json:"employeeId"`
+	FirstName       string `json:"firstName"`
+	LastName        string `json:"lastName"`
+	LicenseID       int    `json:"licenseId"`
+	LicenseName     string `json:"licenseName"`
+	IssueDate       string `json:"issueDate"`
+	ExpDate         string `json:"expDate"`
+	EmployeeDeleted bool   `json:"employeeDeleted"`
+	Deleted         string `json:"deleted"`
+	PurgeAfter      string `json:"purgeAfter"`
+}
+
+// RetentionDays returns the number of days a record stays in the trash before
+// the purge job removes it for good.
+func RetentionDays() int {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		return defaultRetentionDays
+	}
+	return days
+}
+
+func GetEmployees(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	query := `
+	SELECT
+		e.id,
+		e.firstName,
+		e.lastName,
+		e.email,
+		( SELECT COUNT(*) FROM employeeLicenses el
+		  WHERE el.employeeId = e.id and el.deleted = e.deleted ) as licenseCount,
+		e.deleted,
+		DATE_ADD(e.deleted, INTERVAL ? DAY) as purgeAfter
+	FROM employees e
+	WHERE e.deleted IS NOT NULL and e.createdBy = ?
+	ORDER BY e.deleted DESC`
+
+	rows, err := db.Query(query, RetentionDays(), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query deleted employees"})
+		return
+	}
+	defer rows.Close()
+
+	deleted := []DeletedEmployee{}
+	for rows.Next() {
+		var emp DeletedEmployee
+		if err := rows.Scan(
+			&emp.ID, &emp.FirstName, &emp.LastName, &emp.Email,
+			&emp.LicenseCount, &emp.Deleted, &emp.PurgeAfter,
+		); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan deleted employee data"})
+			return
+		}
+		deleted = append(deleted, emp)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, deleted)
+}
+
+func GetLicenses(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	query := `
+	SELECT id, name, deleted, DATE_ADD(deleted, INTERVAL ? DAY) as purgeAfter
+	FROM licenses
+	WHERE deleted IS NOT NULL and createdBy = ?
+	ORDER BY deleted DESC`
+
+	rows, err := db.Query(query, RetentionDays(), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query deleted licenses"})
+		return
+	}
+	defer rows.Close()
+
+	deleted := []DeletedLicense{}
+	for rows.Next() {
+		var lic DeletedLicense
+		if err := rows.Scan(&lic.ID, &lic.Name, &lic.Deleted, &lic.PurgeAfter); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan deleted license data"})
+			return
+		}
+		deleted = append(deleted, lic)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, deleted)
+}
+
+func GetEmployeeLicenses(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	query := `
+	SELECT
+		el.id,
+		el.employeeId,
+		e.firstName,
+		e.lastName,
+		el.licenseId,
+		l.name as licenseName,
+		el.issueDate,
+		el.expDate,
+		e.deleted IS NOT NULL as employeeDeleted,
+		el.deleted,
+		DATE_ADD(el.deleted, INTERVAL ? DAY) as purgeAfter
+	FROM employeeLicenses el
+	left join employees e on el.employeeId = e.id
+	left join licenses l on el.licenseId = l.id
+	WHERE el.deleted IS NOT NULL and el.createdBy = ?
+	ORDER BY el.deleted DESC`
+
+	rows, err := db.Query(query, RetentionDays(), userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query deleted employee licenses"})
+		return
+	}
+	defer rows.Close()
+
+	deleted := []DeletedEmployeeLicense{}
+	for rows.Next() {
+		var lic DeletedEmployeeLicense
+		if err := rows.Scan(
+			&lic.ID, &lic.EmployeeID, &lic.FirstName, &lic.LastName,
+			&lic.LicenseID, &lic.LicenseName, &lic.IssueDate, &lic.ExpDate,
+			&lic.EmployeeDeleted, &lic.Deleted, &lic.PurgeAfter,
+		); err != nil {
+			fmt.Println("Error: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan deleted employee license data"})
+			return
+		}
+		deleted = append(deleted, lic)
+	}
+
+	if err := rows.Err(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating over rows"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, deleted)
+}
+
+// RestoreEmployee brings an employee back along with the licenses that were
+// deleted in the same operation. Licenses removed on their own beforehand
+// stay in the trash. Duplicates folded into another employee by a merge
+// can't be restored.
+func RestoreEmployee(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee id"})
+		return
+	}
+
+	var merged int
+	err = db.QueryRow(`
+        SELECT COUNT(*) FROM employeeMerges
+        WHERE duplicateId = ? and createdBy = ?
+    `, id, userSubStr).Scan(&merged)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore employee"})
+		return
+	}
+
+	if merged > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This employee was merged into another employee and can't be restored"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore employee"})
+		return
+	}
+	defer tx.Rollback()
+
+	licensesRestored, found, err := employees.Restore(tx, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore employee"})
+		return
+	}
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deleted employee not found"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore employee"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Employee restored successfully", "licensesRestored": licensesRestored})
+}
+
+func RestoreLicense(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	result, err := db.Exec(`
+        UPDATE licenses
+        SET deleted = NULL
+        WHERE id = ? and createdBy = ? and deleted IS NOT NULL
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore license"})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve affected rows"})
+		return
+	}
+
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deleted license not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "License restored successfully"})
+}
+
+func RestoreEmployeeLicense(db *sql.DB, c *gin.Context) {
+
+	userSubStr, ok := utils.GetUserSub(c)
+	if !ok {
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "User Not Found"})
+		return
+	}
+
+	id := c.Param("id")
+
+	var employeeDeleted bool
+	err := db.QueryRow(`
+        SELECT e.deleted IS NOT NULL
+        FROM employeeLicenses el
+        JOIN employees e on el.employeeId = e.id
+        WHERE el.id = ? and el.createdBy = ? and el.deleted IS NOT NULL
+    `, id, userSubStr).Scan(&employeeDeleted)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deleted employee license not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve employee license"})
+		return
+	}
+
+	if employeeDeleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "The employee for this license is deleted; restore the employee first"})
+		return
+	}
+
+	_, err = db.Exec(`
+        UPDATE employeeLicenses
+        SET deleted = NULL
+        WHERE id = ? and createdBy = ?
+    `, id, userSubStr)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore employee license"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Employee License restored successfully"})
+}
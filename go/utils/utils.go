@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"database/sql"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -23,3 +24,10 @@ func GetUserSub(c *gin.Context) (string, bool) {
 
 	return userSubStr, true
 }
+
+// DB is satisfied by both *sql.DB and *sql.Tx.
+type DB interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
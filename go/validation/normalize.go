@@ -0,0 +1,109 @@
+package validation
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DateLayout is the format every date in the API is exchanged in.
+const DateLayout = "2006-01-02"
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// callingCodes maps the regions we accept for PHONE_DEFAULT_REGION to their
+// country calling code and whether national numbers carry a leading trunk 0.
+var callingCodes = map[string]struct {
+	code      string
+	trunkZero bool
+}{
+	"US": {"1", false},
+	"CA": {"1", false},
+	"PR": {"1", false},
+	"MX": {"52", false},
+	"GB": {"44", true},
+	"IE": {"353", true},
+	"AU": {"61", true},
+	"NZ": {"64", true},
+	"DE": {"49", true},
+	"FR": {"33", true},
+	"IN": {"91", true},
+	"PH": {"63", true},
+	"ZA": {"27", true},
+}
+
+// DefaultRegion returns the region used to interpret phone numbers entered
+// without a country code, from PHONE_DEFAULT_REGION (default US).
+func DefaultRegion() string {
+	region := strings.ToUpper(strings.TrimSpace(os.Getenv("PHONE_DEFAULT_REGION")))
+	if _, ok := callingCodes[region]; !ok {
+		return "US"
+	}
+	return region
+}
+
+// NormalizePhone converts a free-text phone number to E.164. Numbers without
+// a country code are read in the default region. If the input can't be
+// understood it is returned trimmed but otherwise untouched so validation
+// can report it.
+func NormalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	if phone == "" {
+		return ""
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+
+	var normalized string
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		normalized = "+" + digits
+	case strings.HasPrefix(digits, "00"):
+		normalized = "+" + digits[2:]
+	default:
+		region := callingCodes[DefaultRegion()]
+		national := digits
+		if region.code == "1" && len(national) == 11 && strings.HasPrefix(national, "1") {
+			national = national[1:]
+		}
+		if region.code == "1" && len(national) != 10 {
+			return phone
+		}
+		if region.trunkZero {
+			national = strings.TrimPrefix(national, "0")
+		}
+		normalized = "+" + region.code + national
+	}
+
+	if !e164Pattern.MatchString(normalized) {
+		return phone
+	}
+	return normalized
+}
+
+// NormalizeEmail trims and lower-cases an email address.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeDate trims a date and drops any time portion, so
+// "2025-04-01T00:00:00Z" is accepted as "2025-04-01".
+func NormalizeDate(date string) string {
+	date = strings.TrimSpace(date)
+	if len(date) > len(DateLayout) && date[len(DateLayout)] == 'T' {
+		return date[:len(DateLayout)]
+	}
+	return date
+}
+
+// ParseDate parses a date in DateLayout.
+func ParseDate(date string) (time.Time, error) {
+	return time.Parse(DateLayout, date)
+}
@@ -0,0 +1,136 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldErrors maps a json field name to a human readable message.
+type FieldErrors map[string]string
+
+// Normalizer is implemented by request structs that clean up their own
+// fields (trimming, lower-casing, phone formatting) before validation runs.
+type Normalizer interface {
+	Normalize()
+}
+
+// Checker is implemented by request structs with rules that span more than
+// one field, such as an expiration date that must follow the issue date.
+type Checker interface {
+	Check() FieldErrors
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by their json names so messages line up with the payload.
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" || name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return e164Pattern.MatchString(fl.Field().String())
+	})
+
+	return v
+}
+
+// Bind decodes the JSON body into obj, normalizes it and runs the `validate`
+// struct tags. On failure it writes a 400 with per-field messages and returns
+// false, so handlers can simply return.
+func Bind(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return false
+	}
+
+	if fields := Validate(obj); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "fields": fields})
+		return false
+	}
+
+	return true
+}
+
+// Validate normalizes obj and returns every field that breaks a rule.
+func Validate(obj interface{}) FieldErrors {
+	if n, ok := obj.(Normalizer); ok {
+		n.Normalize()
+	}
+
+	fields := FieldErrors{}
+
+	var validationErrors validator.ValidationErrors
+	if err := validate.Struct(obj); errors.As(err, &validationErrors) {
+		for _, fe := range validationErrors {
+			fields[fieldName(fe)] = message(fe)
+		}
+	}
+
+	if checker, ok := obj.(Checker); ok {
+		for field, msg := range checker.Check() {
+			if _, exists := fields[field]; !exists {
+				fields[field] = msg
+			}
+		}
+	}
+
+	return fields
+}
+
+// fieldName drops the struct name from the namespace so nested fields read
+// as "fields[email]" rather than "MergeRequest.fields[email]".
+func fieldName(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return fe.Field()
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "phone":
+		return "must be a valid phone number"
+	case "datetime":
+		return "must be a date in YYYY-MM-DD format"
+	case "url", "http_url":
+		return "must be a valid URL"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "nefield":
+		return "must be different from " + fe.Param()
+	default:
+		return "is invalid"
+	}
+}